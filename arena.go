@@ -0,0 +1,299 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turboalloc
+
+import (
+	"errors"
+	"fmt"
+	"unsafe"
+
+	"github.com/TimeWtr/TurboAlloc/common"
+	"github.com/TimeWtr/TurboAlloc/syscall"
+)
+
+// DefaultArenaChunkSize is the default size of the chunks an arena bump-allocates from,
+// the largest medium size class, so chunks come from the medium span allocator.
+const DefaultArenaChunkSize = 64 * common.KB
+
+// arenaAlign is the alignment of every arena allocation, enough for any Go type.
+const arenaAlign = 8
+
+var (
+	// ErrArenaReleased is returned when an arena is used after Release.
+	ErrArenaReleased = errors.New("arena released")
+	// ErrArenaBudget is returned when an allocation would exceed the byte budget of the
+	// arena or of one of its parents.
+	ErrArenaBudget = errors.New("arena budget exceeded")
+)
+
+// ArenaOption configures an Arena.
+type ArenaOption func(*Arena)
+
+// WithArenaBudget caps the bytes handed out by the arena and its nested arenas, zero
+// means unlimited.
+func WithArenaBudget(bytes int64) ArenaOption {
+	return func(a *Arena) {
+		a.budget = bytes
+	}
+}
+
+// WithArenaChunkSize sets the size of the chunks taken from the pool, it is rounded up
+// to a size class.
+func WithArenaChunkSize(size int) ArenaOption {
+	return func(a *Arena) {
+		a.chunkSize = size
+	}
+}
+
+type arenaChunk struct {
+	ptr  unsafe.Pointer
+	size int
+}
+
+// Arena bump-allocates from chunks taken from the pool's size class managers and frees
+// everything at once with Reset or Release, which suits request-scoped buffers. Arena
+// memory is not zeroed and individual allocations can not be freed. An Arena must not
+// be used concurrently.
+type Arena struct {
+	pool   *Pool
+	parent *Arena
+	// children holds the nested arenas that have not been released.
+	children []*Arena
+	// chunks holds the chunks taken from the pool, chunks[0] is the one bump-allocated
+	// from, the others are full chunks and dedicated chunks of large allocations.
+	chunks    []arenaChunk
+	offset    int
+	chunkSize int
+	// used is the number of bytes handed out by the arena and its nested arenas.
+	used     int64
+	budget   int64
+	released bool
+}
+
+// NewArena creates an arena allocating from the pool.
+func (p *Pool) NewArena(opts ...ArenaOption) *Arena {
+	a := &Arena{pool: p, chunkSize: DefaultArenaChunkSize}
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	if sc, ok := common.SizeClassOf(a.chunkSize); ok {
+		a.chunkSize = sc.Size()
+	} else {
+		a.chunkSize = DefaultArenaChunkSize
+	}
+
+	return a
+}
+
+// NewArena creates an arena nested in a. Its allocations count against the budgets of a
+// and its parents, and it is released when a is reset or released. Options not given
+// are inherited from a, except the budget.
+func (a *Arena) NewArena(opts ...ArenaOption) (*Arena, error) {
+	if a.released {
+		return nil, ErrArenaReleased
+	}
+
+	child := a.pool.NewArena(append([]ArenaOption{WithArenaChunkSize(a.chunkSize)}, opts...)...)
+	child.parent = a
+	a.children = append(a.children, child)
+	return child, nil
+}
+
+// Alloc returns size bytes aligned to 8 bytes. Allocations larger than a quarter of the
+// chunk size get a dedicated chunk, smaller ones are bumped from the current chunk.
+func (a *Arena) Alloc(size int) (unsafe.Pointer, error) {
+	if a.released {
+		return nil, ErrArenaReleased
+	}
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid arena alloc size: %d", size)
+	}
+
+	size = syscall.AlignUp(size, arenaAlign)
+	if err := a.charge(int64(size)); err != nil {
+		return nil, err
+	}
+
+	ptr, err := a.bump(size)
+	if err != nil {
+		a.refund(int64(size))
+		return nil, err
+	}
+
+	return ptr, nil
+}
+
+func (a *Arena) bump(size int) (unsafe.Pointer, error) {
+	if size > a.chunkSize/4 {
+		ptr, err := a.pool.Alloc(size)
+		if err != nil {
+			return nil, err
+		}
+
+		// Keep the current chunk first.
+		a.chunks = append(a.chunks, arenaChunk{ptr: ptr, size: size})
+		if len(a.chunks) == 1 {
+			a.offset = size
+		}
+		return ptr, nil
+	}
+
+	if len(a.chunks) == 0 || a.offset+size > a.chunks[0].size {
+		ptr, err := a.pool.Alloc(a.chunkSize)
+		if err != nil {
+			return nil, err
+		}
+
+		a.chunks = append(a.chunks, arenaChunk{ptr: ptr, size: a.chunkSize})
+		last := len(a.chunks) - 1
+		a.chunks[0], a.chunks[last] = a.chunks[last], a.chunks[0]
+		a.offset = 0
+	}
+
+	ptr := unsafe.Add(a.chunks[0].ptr, a.offset)
+	a.offset += size
+	return ptr, nil
+}
+
+// charge adds n bytes to the usage of a and its parents, failing without side effects
+// when a budget would be exceeded.
+func (a *Arena) charge(n int64) error {
+	for cur := a; cur != nil; cur = cur.parent {
+		if cur.budget > 0 && cur.used+n > cur.budget {
+			return fmt.Errorf("%w: %d bytes used of %d, %d requested", ErrArenaBudget, cur.used, cur.budget, n)
+		}
+	}
+
+	for cur := a; cur != nil; cur = cur.parent {
+		cur.used += n
+	}
+
+	return nil
+}
+
+// refund subtracts n bytes from the usage of a and its parents.
+func (a *Arena) refund(n int64) {
+	for cur := a; cur != nil; cur = cur.parent {
+		cur.used -= n
+	}
+}
+
+// Used returns the number of bytes handed out by the arena and its nested arenas.
+func (a *Arena) Used() int64 {
+	return a.used
+}
+
+// Reset invalidates every allocation of the arena and releases its nested arenas. The
+// current chunk is kept for reuse, the other chunks are returned to the pool.
+func (a *Arena) Reset() error {
+	if a.released {
+		return ErrArenaReleased
+	}
+
+	err := a.releaseChildren()
+	if len(a.chunks) > 0 {
+		keep := a.chunks[0]
+		if keep.size != a.chunkSize {
+			keep = arenaChunk{}
+		}
+		err = errors.Join(err, a.freeChunks(keep))
+	}
+
+	a.offset = 0
+	a.refund(a.used)
+	return err
+}
+
+// Release returns every chunk of the arena and of its nested arenas to the pool, the
+// arena can not be used afterwards.
+func (a *Arena) Release() error {
+	if a.released {
+		return nil
+	}
+
+	err := errors.Join(a.releaseChildren(), a.freeChunks(arenaChunk{}))
+	a.refund(a.used)
+	a.released = true
+	if a.parent != nil {
+		a.parent.detach(a)
+	}
+
+	return err
+}
+
+func (a *Arena) releaseChildren() error {
+	var err error
+	for len(a.children) > 0 {
+		err = errors.Join(err, a.children[len(a.children)-1].Release())
+	}
+
+	return err
+}
+
+func (a *Arena) detach(child *Arena) {
+	for i, c := range a.children {
+		if c == child {
+			a.children = append(a.children[:i], a.children[i+1:]...)
+			return
+		}
+	}
+}
+
+// freeChunks returns every chunk but keep to the pool.
+func (a *Arena) freeChunks(keep arenaChunk) error {
+	var err error
+	for _, c := range a.chunks {
+		if c.ptr != keep.ptr {
+			err = errors.Join(err, a.pool.Free(c.ptr, c.size))
+		}
+	}
+
+	a.chunks = a.chunks[:0]
+	if keep.ptr != nil {
+		a.chunks = append(a.chunks, keep)
+	}
+
+	return err
+}
+
+// ArenaNew returns a pointer to a zeroed T allocated from the arena. T must not contain
+// Go pointers.
+func ArenaNew[T any](a *Arena) (*T, error) {
+	s, err := ArenaSlice[T](a, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s[0], nil
+}
+
+// ArenaSlice returns a zeroed slice of n values of T allocated from the arena. T must
+// not contain Go pointers.
+func ArenaSlice[T any](a *Arena, n int) ([]T, error) {
+	size, err := sizeOf[T](n)
+	if err != nil {
+		return nil, err
+	}
+
+	ptr, err := a.Alloc(size)
+	if err != nil {
+		return nil, err
+	}
+
+	s := unsafe.Slice((*T)(ptr), n)
+	clear(s)
+	return s, nil
+}
@@ -0,0 +1,139 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turboalloc
+
+import (
+	"testing"
+	"unsafe"
+
+	"github.com/TimeWtr/TurboAlloc/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArena_BumpAllocation(t *testing.T) {
+	p := newTestPool(t)
+	a := p.NewArena(WithArenaChunkSize(common.KB * 8))
+
+	first, err := a.Alloc(3)
+	assert.NoError(t, err)
+	second, err := a.Alloc(100)
+	assert.NoError(t, err)
+	assert.Equal(t, uintptr(first)+arenaAlign, uintptr(second))
+	assert.Equal(t, int64(arenaAlign+104), a.Used())
+	assert.Equal(t, uint64(common.KB*8), p.TotalSize())
+
+	// Filling the chunk takes a second one from the pool.
+	for i := 0; i < 8; i++ {
+		_, err = a.Alloc(common.KB)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, uint64(common.KB*16), p.TotalSize())
+
+	// Allocations above a quarter of the chunk get a dedicated chunk.
+	big, err := a.Alloc(common.KB * 100)
+	assert.NoError(t, err)
+	data := unsafe.Slice((*byte)(big), common.KB*100)
+	data[len(data)-1] = 1
+	assert.Equal(t, uint64(common.KB*116), p.TotalSize())
+
+	assert.NoError(t, a.Reset())
+	assert.Zero(t, a.Used())
+	assert.Equal(t, uint64(common.KB*8), p.TotalSize())
+	again, err := a.Alloc(8)
+	assert.NoError(t, err)
+	assert.NotNil(t, again)
+
+	assert.NoError(t, a.Release())
+	assert.NoError(t, a.Release())
+	assert.Zero(t, p.TotalSize())
+	_, err = a.Alloc(8)
+	assert.ErrorIs(t, err, ErrArenaReleased)
+	assert.ErrorIs(t, a.Reset(), ErrArenaReleased)
+}
+
+func TestArena_Budget(t *testing.T) {
+	p := newTestPool(t)
+	a := p.NewArena(WithArenaBudget(common.KB))
+
+	_, err := a.Alloc(common.KB - 8)
+	assert.NoError(t, err)
+	_, err = a.Alloc(16)
+	assert.ErrorIs(t, err, ErrArenaBudget)
+	_, err = a.Alloc(8)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(common.KB), a.Used())
+
+	assert.NoError(t, a.Reset())
+	_, err = a.Alloc(common.KB)
+	assert.NoError(t, err)
+	assert.NoError(t, a.Release())
+}
+
+func TestArena_Nested(t *testing.T) {
+	p := newTestPool(t)
+	parent := p.NewArena(WithArenaBudget(common.KB * 4))
+	child, err := parent.NewArena()
+	assert.NoError(t, err)
+	grandchild, err := child.NewArena(WithArenaBudget(common.KB))
+	assert.NoError(t, err)
+
+	_, err = grandchild.Alloc(common.KB)
+	assert.NoError(t, err)
+	_, err = grandchild.Alloc(8)
+	assert.ErrorIs(t, err, ErrArenaBudget)
+	assert.Equal(t, int64(common.KB), child.Used())
+	assert.Equal(t, int64(common.KB), parent.Used())
+
+	// The parent budget also caps nested arenas.
+	_, err = child.Alloc(common.KB * 3)
+	assert.NoError(t, err)
+	_, err = child.Alloc(8)
+	assert.ErrorIs(t, err, ErrArenaBudget)
+
+	// Releasing a nested arena refunds its parents.
+	assert.NoError(t, grandchild.Release())
+	assert.Equal(t, int64(common.KB*3), parent.Used())
+
+	// Resetting the parent releases the remaining nested arenas.
+	assert.NoError(t, parent.Reset())
+	_, err = child.Alloc(8)
+	assert.ErrorIs(t, err, ErrArenaReleased)
+	assert.Zero(t, parent.Used())
+	assert.Zero(t, p.TotalSize())
+
+	assert.NoError(t, parent.Release())
+	assert.Zero(t, p.TotalSize())
+	_, err = parent.NewArena()
+	assert.ErrorIs(t, err, ErrArenaReleased)
+}
+
+func TestArena_Typed(t *testing.T) {
+	p := newTestPool(t)
+	a := p.NewArena()
+	defer func() {
+		assert.NoError(t, a.Release())
+	}()
+
+	v, err := ArenaNew[point](a)
+	assert.NoError(t, err)
+	assert.Equal(t, point{}, *v)
+
+	s, err := ArenaSlice[uint32](a, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, make([]uint32, 10), s)
+
+	_, err = ArenaSlice[string](a, 1)
+	assert.ErrorIs(t, err, ErrPointerType)
+}
@@ -0,0 +1,383 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turboalloc
+
+import (
+	"errors"
+	"io"
+	"net"
+	"unsafe"
+
+	"github.com/TimeWtr/TurboAlloc/common"
+)
+
+// BufferChainBlockSize is the size of the blocks a chained Buffer appends once it has
+// grown to that size.
+const BufferChainBlockSize = 4 * common.MB
+
+// minBufferRead is the free space a Buffer makes before every read of ReadFrom.
+const minBufferRead = 512
+
+// ErrBufferTooLarge is returned when an unchained Buffer would have to grow past the
+// largest size class.
+var ErrBufferTooLarge = errors.New("buffer too large")
+
+// BufferOption configures a Buffer.
+type BufferOption func(*Buffer)
+
+// WithBufferChain makes the buffer append blocks of BufferChainBlockSize bytes once it
+// reached that size instead of copying its contents into a larger block. The contents
+// are then exposed as a list of blocks by Buffers and written with writev by WriteTo.
+func WithBufferChain() BufferOption {
+	return func(b *Buffer) {
+		b.chain = true
+	}
+}
+
+type bufSegment struct {
+	ptr unsafe.Pointer
+	// buf views the block, its length is the number of bytes written and its capacity
+	// the block size.
+	buf []byte
+}
+
+// Buffer is a variable-sized byte buffer backed by pool blocks, a drop-in for
+// bytes.Buffer that does not allocate from the Go heap. It grows by moving its contents
+// to a block of the next size class and must be returned to the pool with Release. The
+// zero value is not usable, buffers are created with Pool.NewBuffer. A Buffer must not
+// be used concurrently.
+type Buffer struct {
+	pool *Pool
+	// segs holds the blocks of the buffer, there is more than one only in chain mode.
+	segs []bufSegment
+	// off is the read offset in the first block.
+	off   int
+	chain bool
+}
+
+// NewBuffer returns an empty buffer allocating from the pool, no memory is taken until
+// the first write.
+func (p *Pool) NewBuffer(opts ...BufferOption) *Buffer {
+	b := &Buffer{pool: p}
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	return b
+}
+
+// Len returns the number of unread bytes.
+func (b *Buffer) Len() int {
+	n := -b.off
+	for _, s := range b.segs {
+		n += len(s.buf)
+	}
+
+	return n
+}
+
+// Cap returns the total size of the blocks held by the buffer.
+func (b *Buffer) Cap() int {
+	n := 0
+	for _, s := range b.segs {
+		n += cap(s.buf)
+	}
+
+	return n
+}
+
+// Bytes returns the unread bytes of the first block, which are all the unread bytes
+// unless the buffer is chained across several blocks. The slice aliases pool memory
+// and is only valid until the next buffer modification.
+func (b *Buffer) Bytes() []byte {
+	if len(b.segs) == 0 {
+		return nil
+	}
+
+	return b.segs[0].buf[b.off:]
+}
+
+// Buffers returns the unread bytes of every block, for vectored writes. The slices
+// alias pool memory and are only valid until the next buffer modification.
+func (b *Buffer) Buffers() [][]byte {
+	bufs := make([][]byte, 0, len(b.segs))
+	for i, s := range b.segs {
+		if i == 0 {
+			s.buf = s.buf[b.off:]
+		}
+		if len(s.buf) > 0 {
+			bufs = append(bufs, s.buf)
+		}
+	}
+
+	return bufs
+}
+
+// Write appends p to the buffer.
+func (b *Buffer) Write(p []byte) (int, error) {
+	return write(b, p)
+}
+
+// WriteString appends s to the buffer.
+func (b *Buffer) WriteString(s string) (int, error) {
+	return write(b, s)
+}
+
+// WriteByte appends c to the buffer.
+func (b *Buffer) WriteByte(c byte) error {
+	_, err := write(b, []byte{c})
+	return err
+}
+
+func write[S []byte | string](b *Buffer, p S) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		if err := b.grow(len(p)); err != nil {
+			return n, err
+		}
+
+		last := &b.segs[len(b.segs)-1]
+		m := copy(last.buf[len(last.buf):cap(last.buf)], p)
+		last.buf = last.buf[:len(last.buf)+m]
+		n += m
+		p = p[m:]
+	}
+
+	return n, nil
+}
+
+// Read reads up to len(p) unread bytes into p, it returns io.EOF when the buffer is
+// empty and p is not.
+func (b *Buffer) Read(p []byte) (int, error) {
+	if b.Len() == 0 {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+
+	n := 0
+	for n < len(p) && len(b.segs) > 0 {
+		m := copy(p[n:], b.segs[0].buf[b.off:])
+		n += m
+		if err := b.discard(m); err != nil {
+			return n, err
+		}
+		if m == 0 {
+			break
+		}
+	}
+
+	return n, nil
+}
+
+// ReadByte reads the next unread byte, it returns io.EOF when the buffer is empty.
+func (b *Buffer) ReadByte() (byte, error) {
+	var c [1]byte
+	if _, err := b.Read(c[:]); err != nil {
+		return 0, err
+	}
+
+	return c[0], nil
+}
+
+// ReadFrom reads from r until io.EOF and appends the data to the buffer.
+func (b *Buffer) ReadFrom(r io.Reader) (int64, error) {
+	var n int64
+	for {
+		if err := b.grow(minBufferRead); err != nil {
+			return n, err
+		}
+
+		last := &b.segs[len(b.segs)-1]
+		m, err := r.Read(last.buf[len(last.buf):cap(last.buf)])
+		if m < 0 {
+			return n, errors.New("turboalloc.Buffer: reader returned negative count from Read")
+		}
+		last.buf = last.buf[:len(last.buf)+m]
+		n += int64(m)
+		if errors.Is(err, io.EOF) {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+}
+
+// WriteTo writes the unread bytes to w. A buffer chained across several blocks is
+// written with a single vectored write when w supports it, such as a net.Conn.
+func (b *Buffer) WriteTo(w io.Writer) (int64, error) {
+	if len(b.segs) <= 1 {
+		data := b.Bytes()
+		m, err := w.Write(data)
+		if err == nil && m < len(data) {
+			err = io.ErrShortWrite
+		}
+		if derr := b.discard(m); err == nil {
+			err = derr
+		}
+		return int64(m), err
+	}
+
+	bufs := net.Buffers(b.Buffers())
+	n, err := bufs.WriteTo(w)
+	if derr := b.discard(int(n)); err == nil {
+		err = derr
+	}
+
+	return n, err
+}
+
+// Reset empties the buffer, keeping its first block for reuse.
+func (b *Buffer) Reset() error {
+	if len(b.segs) == 0 {
+		return nil
+	}
+
+	err := b.free(b.segs[1:])
+	b.segs = b.segs[:1]
+	b.segs[0].buf = b.segs[0].buf[:0]
+	b.off = 0
+	return err
+}
+
+// Release returns every block to the pool. The buffer is empty afterwards and takes
+// new blocks on the next write.
+func (b *Buffer) Release() error {
+	err := b.free(b.segs)
+	b.segs = nil
+	b.off = 0
+	return err
+}
+
+func (b *Buffer) free(segs []bufSegment) error {
+	var err error
+	for _, s := range segs {
+		err = errors.Join(err, b.pool.Free(s.ptr, cap(s.buf)))
+	}
+
+	return err
+}
+
+// discard consumes n unread bytes. Fully read blocks other than the last are returned
+// to the pool, and an emptied buffer rewinds to the start of its block.
+func (b *Buffer) discard(n int) error {
+	var err error
+	for n > 0 {
+		first := &b.segs[0]
+		m := min(n, len(first.buf)-b.off)
+		b.off += m
+		n -= m
+		if b.off == len(first.buf) && len(b.segs) > 1 {
+			err = errors.Join(err, b.free(b.segs[:1]))
+			b.segs = b.segs[1:]
+			b.off = 0
+		}
+	}
+
+	if len(b.segs) == 1 && b.off == len(b.segs[0].buf) {
+		b.segs[0].buf = b.segs[0].buf[:0]
+		b.off = 0
+	}
+
+	return err
+}
+
+// grow makes room for n more bytes. An unchained buffer, or a chained one smaller than
+// BufferChainBlockSize, moves its unread bytes to the front of its block when they fit,
+// and otherwise to a block of the next size class large enough. A chained buffer that
+// reached BufferChainBlockSize appends a new block once its last block is full.
+func (b *Buffer) grow(n int) error {
+	if len(b.segs) == 0 {
+		if b.chain {
+			n = min(n, BufferChainBlockSize)
+		}
+		return b.appendSegment(n)
+	}
+
+	last := &b.segs[len(b.segs)-1]
+	free := cap(last.buf) - len(last.buf)
+	if free >= n {
+		return nil
+	}
+
+	if b.chain && cap(last.buf) >= BufferChainBlockSize {
+		if free > 0 {
+			return nil
+		}
+		return b.appendSegment(BufferChainBlockSize)
+	}
+
+	unread := len(last.buf) - b.off
+	if unread+n <= cap(last.buf) {
+		copy(last.buf[:unread], last.buf[b.off:])
+		last.buf = last.buf[:unread]
+		b.off = 0
+		return nil
+	}
+
+	need := unread + n
+	if b.chain {
+		need = min(need, BufferChainBlockSize)
+	}
+
+	sc, _ := common.SizeClassOf(cap(last.buf))
+	size := 0
+	if sc < common.SizeClassMax {
+		size = (sc + 1).Size()
+	}
+	if size < need {
+		next, ok := common.SizeClassOf(need)
+		if !ok {
+			return ErrBufferTooLarge
+		}
+		size = next.Size()
+	}
+	if size == 0 {
+		return ErrBufferTooLarge
+	}
+
+	ptr, err := b.pool.Alloc(size)
+	if err != nil {
+		return err
+	}
+
+	buf := unsafe.Slice((*byte)(ptr), size)[:unread]
+	copy(buf, last.buf[b.off:])
+	if err = b.pool.Free(last.ptr, cap(last.buf)); err != nil {
+		return err
+	}
+
+	*last = bufSegment{ptr: ptr, buf: buf}
+	b.off = 0
+	return nil
+}
+
+// appendSegment appends a block of the smallest size class holding n bytes.
+func (b *Buffer) appendSegment(n int) error {
+	sc, ok := common.SizeClassOf(n)
+	if !ok {
+		return ErrBufferTooLarge
+	}
+
+	ptr, err := b.pool.Alloc(sc.Size())
+	if err != nil {
+		return err
+	}
+
+	b.segs = append(b.segs, bufSegment{ptr: ptr, buf: unsafe.Slice((*byte)(ptr), sc.Size())[:0]})
+	return nil
+}
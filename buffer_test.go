@@ -0,0 +1,160 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turboalloc
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/TimeWtr/TurboAlloc/common"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	_ io.Reader     = (*Buffer)(nil)
+	_ io.Writer     = (*Buffer)(nil)
+	_ io.ReaderFrom = (*Buffer)(nil)
+	_ io.WriterTo   = (*Buffer)(nil)
+	_ io.ByteWriter = (*Buffer)(nil)
+)
+
+func newTestBuffer(t *testing.T, p *Pool, opts ...BufferOption) *Buffer {
+	t.Helper()
+	b := p.NewBuffer(opts...)
+	t.Cleanup(func() {
+		assert.NoError(t, b.Release())
+	})
+	return b
+}
+
+func TestBuffer_WriteRead(t *testing.T) {
+	p := newTestPool(t)
+	b := newTestBuffer(t, p)
+
+	n, err := b.WriteString("hello")
+	assert.NoError(t, err)
+	assert.Equal(t, 5, n)
+	assert.NoError(t, b.WriteByte(' '))
+	_, err = b.Write([]byte("world"))
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", string(b.Bytes()))
+	assert.Equal(t, common.B16, b.Cap())
+
+	c, err := b.ReadByte()
+	assert.NoError(t, err)
+	assert.Equal(t, byte('h'), c)
+	out := make([]byte, 4)
+	n, err = b.Read(out)
+	assert.NoError(t, err)
+	assert.Equal(t, "ello", string(out[:n]))
+	assert.Equal(t, 6, b.Len())
+
+	rest, err := io.ReadAll(b)
+	assert.NoError(t, err)
+	assert.Equal(t, " world", string(rest))
+	_, err = b.Read(out)
+	assert.ErrorIs(t, err, io.EOF)
+
+	// An emptied buffer rewinds instead of growing.
+	_, err = b.WriteString(strings.Repeat("x", common.B16))
+	assert.NoError(t, err)
+	assert.Equal(t, common.B16, b.Cap())
+}
+
+func TestBuffer_GrowsBySizeClass(t *testing.T) {
+	p := newTestPool(t)
+	b := newTestBuffer(t, p)
+
+	var want bytes.Buffer
+	caps := []int{}
+	for i := 0; i < 300; i++ {
+		chunk := bytes.Repeat([]byte{byte(i)}, 7)
+		_, err := b.Write(chunk)
+		assert.NoError(t, err)
+		want.Write(chunk)
+		if len(caps) == 0 || caps[len(caps)-1] != b.Cap() {
+			caps = append(caps, b.Cap())
+		}
+	}
+
+	assert.Equal(t, []int{common.B8, common.B16, common.B32, common.B64, common.B128,
+		common.B256, common.B512, common.KB, common.KB * 2, common.KB * 4}, caps)
+	assert.Equal(t, want.Bytes(), b.Bytes())
+	assert.Equal(t, uint64(common.KB*4), p.TotalSize())
+
+	// A write much larger than the next class jumps straight to a class holding it.
+	_, err := b.Write(make([]byte, common.KB*100))
+	assert.NoError(t, err)
+	assert.Equal(t, common.KB*128, b.Cap())
+
+	assert.NoError(t, b.Reset())
+	assert.Zero(t, b.Len())
+	assert.NoError(t, b.Release())
+	assert.Zero(t, p.TotalSize())
+}
+
+func TestBuffer_ReadFromWriteTo(t *testing.T) {
+	p := newTestPool(t)
+	b := newTestBuffer(t, p)
+
+	data := bytes.Repeat([]byte("0123456789"), 10000)
+	n, err := b.ReadFrom(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(data)), n)
+
+	var out bytes.Buffer
+	n, err = b.WriteTo(&out)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(data)), n)
+	assert.Equal(t, data, out.Bytes())
+	assert.Zero(t, b.Len())
+}
+
+func TestBuffer_Chain(t *testing.T) {
+	p := newTestPool(t)
+	b := newTestBuffer(t, p, WithBufferChain())
+
+	data := make([]byte, BufferChainBlockSize*2+common.MB)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	_, err := b.Write(data)
+	assert.NoError(t, err)
+	assert.Len(t, b.Buffers(), 3)
+	assert.Equal(t, BufferChainBlockSize*3, b.Cap())
+
+	// Partially reading releases the fully read blocks.
+	head := make([]byte, BufferChainBlockSize+10)
+	_, err = io.ReadFull(b, head)
+	assert.NoError(t, err)
+	assert.Equal(t, data[:len(head)], head)
+	assert.Len(t, b.Buffers(), 2)
+
+	var out bytes.Buffer
+	_, err = b.WriteTo(&out)
+	assert.NoError(t, err)
+	assert.Equal(t, data[len(head):], out.Bytes())
+	assert.Equal(t, BufferChainBlockSize, b.Cap())
+}
+
+func TestBuffer_TooLarge(t *testing.T) {
+	p := newTestPool(t)
+	b := newTestBuffer(t, p)
+
+	_, err := b.Write(make([]byte, common.SizeClassMax.Size()+1))
+	assert.ErrorIs(t, err, ErrBufferTooLarge)
+}
@@ -0,0 +1,232 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command turboalloc-replay replays a trace written by Pool.WriteTrace against a fresh
+// pool and reports the latency percentiles of the allocations and frees along with the
+// peak live bytes and the peak RSS of the process.
+//
+// Usage:
+//
+//	turboalloc-replay [flags] trace
+//
+// Frees are matched with the allocations of the same address, frees whose allocation
+// was dropped from the ring buffer are skipped and counted. The peak RSS covers the
+// whole process, including the decoded trace, so the RSS before the replay is printed
+// as a baseline.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+
+	turboalloc "github.com/TimeWtr/TurboAlloc"
+	"github.com/TimeWtr/TurboAlloc/core"
+)
+
+// percentiles are the latency percentiles reported for each operation.
+var percentiles = []float64{50, 90, 99, 99.9}
+
+// block is a live allocation of the replay.
+type block struct {
+	ptr  unsafe.Pointer
+	size int
+}
+
+// result holds the measurements of a replay.
+type result struct {
+	allocs, frees []time.Duration
+	unmatched     int
+	peakLive      int64
+}
+
+func main() {
+	var (
+		procs     = flag.Int("procs", 0, "GOMAXPROCS of the replay, which sets the shard counts, unchanged when zero")
+		pageSize  = flag.Int("page-size", 0, "page size of the pool, the OS page size when zero")
+		hugePages = flag.Bool("huge-pages", false, "back the pool with transparent huge pages")
+		ratio     = flag.Float64("compaction-ratio", 0, "free-to-used ratio above which the scavenger runs, zero disables it")
+		touch     = flag.Bool("touch", true, "write every page of the allocations, outside of the timed section, so they count in RSS")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: turboalloc-replay [flags] trace\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if *procs > 0 {
+		runtime.GOMAXPROCS(*procs)
+	}
+
+	trace, err := readTrace(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "turboalloc-replay:", err)
+		os.Exit(1)
+	}
+
+	p, err := turboalloc.NewPool(turboalloc.Config{
+		PageSize:        *pageSize,
+		EnableHugePage:  *hugePages,
+		CompactionRatio: *ratio,
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "turboalloc-replay:", err)
+		os.Exit(1)
+	}
+	defer p.Close()
+
+	baseline := resetPeakRSS()
+	res, err := replay(p, trace, *touch)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "turboalloc-replay:", err)
+		os.Exit(1)
+	}
+
+	report(os.Stdout, trace, res, baseline)
+}
+
+func readTrace(name string) (*core.Trace, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return core.ReadTrace(f)
+}
+
+// replay runs the events of trace against p in order and frees the blocks still live at
+// the end.
+func replay(p *turboalloc.Pool, trace *core.Trace, touch bool) (*result, error) {
+	res := new(result)
+	live := make(map[uint64]block)
+	var liveBytes int64
+	for _, e := range trace.Events {
+		switch e.Op {
+		case core.TraceAlloc:
+			start := time.Now()
+			ptr, err := p.Alloc(e.Size)
+			res.allocs = append(res.allocs, time.Since(start))
+			if err != nil {
+				return nil, fmt.Errorf("alloc of %d bytes: %w", e.Size, err)
+			}
+
+			if touch {
+				touchPages(ptr, e.Size, os.Getpagesize())
+			}
+			live[e.Addr] = block{ptr: ptr, size: e.Size}
+			liveBytes += int64(e.Size)
+			res.peakLive = max(res.peakLive, liveBytes)
+		case core.TraceFree:
+			b, ok := live[e.Addr]
+			if !ok {
+				res.unmatched++
+				continue
+			}
+
+			start := time.Now()
+			err := p.Free(b.ptr, b.size)
+			res.frees = append(res.frees, time.Since(start))
+			if err != nil {
+				return nil, fmt.Errorf("free of %d bytes: %w", b.size, err)
+			}
+			delete(live, e.Addr)
+			liveBytes -= int64(b.size)
+		}
+	}
+
+	for _, b := range live {
+		if err := p.Free(b.ptr, b.size); err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+// touchPages writes a byte in every page of the size bytes at ptr.
+func touchPages(ptr unsafe.Pointer, size, pageSize int) {
+	for off := 0; off < size; off += pageSize {
+		*(*byte)(unsafe.Add(ptr, off)) = 0
+	}
+}
+
+func report(w io.Writer, trace *core.Trace, res *result, baseline int64) {
+	fmt.Fprintf(w, "events:     %d (%d dropped from the ring buffer, %d unmatched frees)\n",
+		len(trace.Events), trace.Dropped, res.unmatched)
+	reportLatency(w, "alloc", res.allocs)
+	reportLatency(w, "free", res.frees)
+	fmt.Fprintf(w, "peak live:  %d bytes\n", res.peakLive)
+	if peak := procStatus("VmHWM"); peak >= 0 {
+		fmt.Fprintf(w, "peak RSS:   %d bytes (%d bytes before the replay)\n", peak, baseline)
+	}
+}
+
+func reportLatency(w io.Writer, op string, ds []time.Duration) {
+	if len(ds) == 0 {
+		return
+	}
+
+	slices.Sort(ds)
+	fmt.Fprintf(w, "%-6s      n=%d", op, len(ds))
+	for _, q := range percentiles {
+		i := min(len(ds)-1, int(float64(len(ds))*q/100))
+		fmt.Fprintf(w, " p%s=%s", strconv.FormatFloat(q, 'f', -1, 64), ds[i])
+	}
+	fmt.Fprintf(w, " max=%s\n", ds[len(ds)-1])
+}
+
+// resetPeakRSS resets the peak RSS of the process when the kernel allows it and returns
+// the current RSS, or -1 when it is unknown.
+func resetPeakRSS() int64 {
+	_ = os.WriteFile("/proc/self/clear_refs", []byte("5"), 0)
+	return procStatus("VmRSS")
+}
+
+// procStatus returns a field of /proc/self/status in bytes, or -1 when it is unknown.
+func procStatus(field string) int64 {
+	f, err := os.Open("/proc/self/status")
+	if err != nil {
+		return -1
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		value, ok := strings.CutPrefix(s.Text(), field+":")
+		if !ok {
+			continue
+		}
+
+		kb, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimSpace(value), " kB"), 10, 64)
+		if err != nil {
+			return -1
+		}
+		return kb * 1024
+	}
+
+	return -1
+}
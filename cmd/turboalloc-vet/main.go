@@ -0,0 +1,148 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command turboalloc-vet reports call sites storing types that hold Go pointers in
+// TurboAlloc pool memory, which the garbage collector does not scan.
+//
+// Usage:
+//
+//	turboalloc-vet [packages]
+//
+// Packages are given as go list patterns and default to ./... . Each finding is printed
+// as file:line:col: message, and the command exits with status 1 when there are
+// findings and 2 when the packages can not be loaded.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/TimeWtr/TurboAlloc/offheap"
+)
+
+// listedPackage is the subset of the go list -json output used by the command.
+type listedPackage struct {
+	Dir        string
+	ImportPath string
+	GoFiles    []string
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: turboalloc-vet [packages]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	patterns := flag.Args()
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+
+	n, err := run(os.Stdout, patterns)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "turboalloc-vet:", err)
+		os.Exit(2)
+	}
+
+	if n > 0 {
+		os.Exit(1)
+	}
+}
+
+// run vets the packages matching patterns, writes the findings to w and returns their
+// number.
+func run(w io.Writer, patterns []string) (int, error) {
+	pkgs, err := list(patterns)
+	if err != nil {
+		return 0, err
+	}
+
+	fset := token.NewFileSet()
+	imp := importer.ForCompiler(fset, "source", nil)
+	findings := 0
+	for _, pkg := range pkgs {
+		diags, err := vet(fset, imp, pkg)
+		if err != nil {
+			return findings, err
+		}
+
+		for _, d := range diags {
+			fmt.Fprintf(w, "%s: %s\n", fset.Position(d.Pos), d.Message)
+		}
+		findings += len(diags)
+	}
+
+	return findings, nil
+}
+
+// list resolves patterns with go list.
+func list(patterns []string) ([]listedPackage, error) {
+	args := append([]string{"list", "-e", "-json=Dir,ImportPath,GoFiles"}, patterns...)
+	var stderr bytes.Buffer
+	cmd := exec.Command("go", args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go list: %w: %s", err, stderr.String())
+	}
+
+	var pkgs []listedPackage
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		var pkg listedPackage
+		if err = dec.Decode(&pkg); errors.Is(err, io.EOF) {
+			return pkgs, nil
+		} else if err != nil {
+			return nil, err
+		}
+		pkgs = append(pkgs, pkg)
+	}
+}
+
+// vet parses and type-checks a package and analyzes it. Type errors are tolerated as
+// long as the package can be partially checked, like go vet does for broken code.
+func vet(fset *token.FileSet, imp types.Importer, pkg listedPackage) ([]offheap.Diagnostic, error) {
+	files := make([]*ast.File, 0, len(pkg.GoFiles))
+	for _, name := range pkg.GoFiles {
+		f, err := parser.ParseFile(fset, filepath.Join(pkg.Dir, name), nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+
+	info := &types.Info{
+		Types:     make(map[ast.Expr]types.TypeAndValue),
+		Defs:      make(map[*ast.Ident]types.Object),
+		Uses:      make(map[*ast.Ident]types.Object),
+		Instances: make(map[*ast.Ident]types.Instance),
+	}
+	conf := types.Config{Importer: imp, Error: func(error) {}}
+	_, _ = conf.Check(pkg.ImportPath, fset, files, info)
+
+	return offheap.Analyze(files, info), nil
+}
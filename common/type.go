@@ -14,6 +14,8 @@
 
 package common
 
+import "sort"
+
 type SizeClass int
 
 const (
@@ -54,10 +56,14 @@ func (s SizeClass) Int() int {
 }
 
 func (s SizeClass) String() string {
-	switch {
-	case s.Uint8() < SizeClass8KB.Uint8():
+	if !s.valid() {
+		return Unknown
+	}
+
+	switch s.Category() {
+	case SmallSizeCategory:
 		return s.smallString()
-	case s.Uint8() < SizeClass128KB.Uint8():
+	case MediumSizeCategory:
 		return s.mediumString()
 	default:
 		return s.largeString()
@@ -66,6 +72,14 @@ func (s SizeClass) String() string {
 
 func (s SizeClass) smallString() string {
 	switch s {
+	case SizeClass8B:
+		return "8B"
+	case SizeClass16B:
+		return "16B"
+	case SizeClass32B:
+		return "32B"
+	case SizeClass64B:
+		return "64B"
 	case SizeClass128B:
 		return "128B"
 	case SizeClass256B:
@@ -84,21 +98,6 @@ func (s SizeClass) smallString() string {
 }
 
 func (s SizeClass) mediumString() string {
-	switch s {
-	case SizeClass8B:
-		return "8B"
-	case SizeClass16B:
-		return "16B"
-	case SizeClass32B:
-		return "32B"
-	case SizeClass64B:
-		return "64B"
-	default:
-		return Unknown
-	}
-}
-
-func (s SizeClass) largeString() string {
 	switch s {
 	case SizeClass8KB:
 		return "8KB"
@@ -108,6 +107,13 @@ func (s SizeClass) largeString() string {
 		return "32KB"
 	case SizeClass64KB:
 		return "64KB"
+	default:
+		return Unknown
+	}
+}
+
+func (s SizeClass) largeString() string {
+	switch s {
 	case SizeClass128KB:
 		return "128KB"
 	case SizeClass256KB:
@@ -131,9 +137,8 @@ func (s SizeClass) largeString() string {
 	}
 }
 
-//nolint:unused  // will be used
 func (s SizeClass) valid() bool {
-	return s <= SizeClassMax
+	return s >= 0 && s <= SizeClassMax
 }
 
 const (
@@ -150,7 +155,7 @@ const (
 
 const (
 	SmallSizeClassNums  = 10
-	mediumSizeClassNums = 4
+	MediumSizeClassNums = 4
 	largeSizeClassNums  = 9
 )
 
@@ -194,3 +199,55 @@ const (
 	LargeSizeCategory
 	AllSizeCategory
 )
+
+func (c SizeCategory) String() string {
+	switch c {
+	case SmallSizeCategory:
+		return "small"
+	case MediumSizeCategory:
+		return "medium"
+	case LargeSizeCategory:
+		return "large"
+	case AllSizeCategory:
+		return "all"
+	default:
+		return Unknown
+	}
+}
+
+// sizeClassTable and sizeCategoryTable are flattened views of SizeClassSizes indexed
+// by SizeClass, so that the allocation hot path never has to touch the nested maps.
+var (
+	sizeClassTable    [SizeClassMax + 1]int
+	sizeCategoryTable [SizeClassMax + 1]SizeCategory
+)
+
+func init() {
+	for category, classes := range SizeClassSizes {
+		for sizeClass, size := range classes {
+			sizeClassTable[sizeClass] = size
+			sizeCategoryTable[sizeClass] = category
+		}
+	}
+}
+
+// SizeClassOf returns the smallest size class that can hold size bytes. The boolean
+// result is false when size is not positive or exceeds the largest size class.
+func SizeClassOf(size int) (SizeClass, bool) {
+	if size <= 0 || size > sizeClassTable[SizeClassMax] {
+		return 0, false
+	}
+
+	idx := sort.SearchInts(sizeClassTable[:], size)
+	return SizeClass(idx), true
+}
+
+// Size returns the block size in bytes of the size class.
+func (s SizeClass) Size() int {
+	return sizeClassTable[s]
+}
+
+// Category returns the size category the size class belongs to.
+func (s SizeClass) Category() SizeCategory {
+	return sizeCategoryTable[s]
+}
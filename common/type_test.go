@@ -0,0 +1,74 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSizeClassOf(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int
+		expected SizeClass
+		ok       bool
+	}{
+		{"zero", 0, 0, false},
+		{"negative", -1, 0, false},
+		{"one byte", 1, SizeClass8B, true},
+		{"exact 8B", B8, SizeClass8B, true},
+		{"9 bytes", B8 + 1, SizeClass16B, true},
+		{"exact 4KB", KB * 4, SizeClass4KB, true},
+		{"4KB plus one", KB*4 + 1, SizeClass8KB, true},
+		{"64KB plus one", KB*64 + 1, SizeClass128KB, true},
+		{"exact 32MB", MB * 32, SizeClass32MB, true},
+		{"over max", MB*32 + 1, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, ok := SizeClassOf(tt.size)
+			assert.Equal(t, tt.ok, ok)
+			if tt.ok {
+				assert.Equal(t, tt.expected, sc)
+			}
+		})
+	}
+}
+
+func TestSizeClass_SizeAndCategory(t *testing.T) {
+	for category, classes := range SizeClassSizes {
+		for sc, size := range classes {
+			assert.Equal(t, size, sc.Size())
+			assert.Equal(t, category, sc.Category())
+		}
+	}
+}
+
+func TestSizeClass_String(t *testing.T) {
+	names := []string{
+		"8B", "16B", "32B", "64B", "128B", "256B", "512B", "1KB", "2KB", "4KB",
+		"8KB", "16KB", "32KB", "64KB", "128KB", "256KB", "512KB",
+		"1MB", "2MB", "4MB", "8MB", "16MB", "32MB",
+	}
+	for sc := SizeClass8B; sc <= SizeClassMax; sc++ {
+		assert.Equal(t, names[sc], sc.String())
+	}
+	assert.Equal(t, Unknown, (SizeClassMax + 1).String())
+	assert.Equal(t, Unknown, SizeClass(-1).String())
+	assert.Equal(t, "medium", MediumSizeCategory.String())
+}
@@ -16,11 +16,95 @@ package turboalloc
 
 import (
 	"time"
+
+	"github.com/TimeWtr/TurboAlloc/core"
+	"github.com/TimeWtr/TurboAlloc/numa"
 )
 
 type Config struct {
-	EnableHugePage  bool
-	NumaNodes       int
+	EnableHugePage bool
+	NumaNodes      int
+	// CompactionRatio is the free-to-used ratio of a size class above which the
+	// scavenger returns its fully free pages to the OS, zero disables the scavenger.
 	CompactionRatio float64
-	StatsInterval   time.Duration
+	// StatsInterval is the period at which stats snapshots are pushed to OnStats and to
+	// the channels returned by Pool.SubscribeStats, zero disables the emitter.
+	StatsInterval time.Duration
+	// ShardSelector picks the small and medium shard serving each allocation,
+	// defaults to core.ProcPinSelector when nil.
+	ShardSelector core.ShardSelector
+	// PageSize is the size of the pages mapped from the OS, it must be a power of two
+	// multiple of the OS page size and defaults to it when zero.
+	PageSize int
+	// LargeRetainedBytes caps the free large-region bytes kept mapped for reuse,
+	// defaults to core.DefaultLargeRetainedBytes when zero.
+	LargeRetainedBytes int64
+	// NumaPolicy decides where memory goes when the local NUMA node is exhausted,
+	// only used when NumaNodes is positive.
+	NumaPolicy core.NUMAPolicy
+	// NumaTopology overrides the topology detected from sysfs, mainly for tests.
+	NumaTopology *numa.Topology
+	// ScavengeInterval is the period of the background scavenger started when
+	// CompactionRatio is positive, defaults to core.DefaultScavengeInterval when zero.
+	ScavengeInterval time.Duration
+	// LazyRelease makes the scavenger release pages with MADV_FREE, which is cheaper but
+	// only lowers RSS once the kernel is under memory pressure.
+	LazyRelease bool
+	// ZeroOnFree wipes every block when it is returned, so that recycled memory never
+	// carries data from one user to the next.
+	ZeroOnFree bool
+	// FreeCheck selects how blocks passed to Free are validated, double frees, foreign
+	// pointers and sizes of another class are always rejected.
+	FreeCheck core.FreeCheckMode
+	// OnFreeError receives every invalid free before the error is returned, for instance
+	// core.PanicOnFreeError or core.LogFreeErrors.
+	OnFreeError func(error)
+	// LeakTracking records the call stack of every allocation until it is freed, see
+	// Pool.LiveAllocations and Pool.CheckLeaks.
+	LeakTracking bool
+	// HeapProfileRate samples one allocation every HeapProfileRate bytes on average for
+	// Pool.WriteHeapProfile, like runtime.MemProfileRate. Zero disables profiling, see
+	// core.DefaultProfileRate for a typical value.
+	HeapProfileRate int
+	// TraceEvents keeps the last TraceEvents allocations and frees in a ring buffer for
+	// Pool.WriteTrace, which cmd/turboalloc-replay replays. Zero disables tracing.
+	TraceEvents int
+	// DebugMode surrounds blocks with canaries and guard pages and holds freed blocks in a
+	// poisoned quarantine, see core.WithDebug. It is meant for tests and is much slower.
+	DebugMode bool
+	// DebugQuarantineBytes caps the freed bytes held in quarantine by DebugMode,
+	// defaults to core.DefaultQuarantineBytes when zero.
+	DebugQuarantineBytes int64
+	// OnViolation receives the corruptions found by DebugMode outside of Free, it
+	// panics when nil.
+	OnViolation func(*core.Violation)
+	// OnStats receives a stats snapshot every StatsInterval, it runs on the emitter
+	// goroutine and should not block.
+	OnStats func(core.Stats)
+}
+
+// numaTopology returns the topology to use when NumaNodes is positive, nil otherwise.
+func (c Config) numaTopology() (*numa.Topology, error) {
+	if c.NumaNodes <= 0 {
+		return nil, nil
+	}
+
+	topo := c.NumaTopology
+	if topo == nil {
+		var err error
+		if topo, err = numa.Detect(); err != nil {
+			return nil, err
+		}
+	}
+
+	return topo.Truncate(c.NumaNodes), nil
+}
+
+// scavengeInterval returns the scavenger period.
+func (c Config) scavengeInterval() time.Duration {
+	if c.ScavengeInterval <= 0 {
+		return core.DefaultScavengeInterval
+	}
+
+	return c.ScavengeInterval
 }
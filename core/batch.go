@@ -0,0 +1,119 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"unsafe"
+
+	"github.com/TimeWtr/TurboAlloc/common"
+)
+
+// AllocBatch fills out with blocks of at least size bytes each. Small blocks are taken
+// from the free lists a whole chain at a time, other sizes are allocated one by one.
+// Either every entry of out is filled or, on error, none is and the blocks already
+// taken are returned.
+func (m *Manager) AllocBatch(size int, out []unsafe.Pointer) error {
+	sc, err := m.sizeClassOf(size)
+	if err != nil {
+		return err
+	}
+
+	if sc.Category() == common.SmallSizeCategory && m.debug == nil {
+		n, err := m.sm.allocBatch(sc, out)
+		if err != nil {
+			_, _ = m.sm.freeBatch(sc, out[:n])
+			clear(out[:n])
+			return err
+		}
+
+		for _, ptr := range out {
+			m.trackAlloc(ptr, size)
+		}
+		return nil
+	}
+
+	for i := range out {
+		if out[i], err = m.Alloc(size); err != nil {
+			_, _ = m.FreeBatch(size, out[:i])
+			clear(out[:i])
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FreeBatch returns blocks obtained from Alloc or AllocBatch with the same size. Small
+// blocks are pushed on the free list as a single chain. It returns the number of blocks
+// freed, which is short of len(ptrs) only when a block is rejected.
+func (m *Manager) FreeBatch(size int, ptrs []unsafe.Pointer) (int, error) {
+	sc, err := m.sizeClassOf(size)
+	if err != nil {
+		return 0, err
+	}
+
+	if sc.Category() == common.SmallSizeCategory && m.debug == nil {
+		// The blocks preceding a rejected one are still freed, the state bits are
+		// checked by freeBatch. The owner is only looked up when the page changes.
+		page, pageMask := ^uintptr(0), ^uintptr(m.sys.PageSize()-1)
+		for i, ptr := range ptrs {
+			err = ErrInvalidPointer
+			if ptr != nil {
+				err = nil
+				if uintptr(ptr)&pageMask != page {
+					page = uintptr(ptr) & pageMask
+					_, err = m.checkOwner(ptr, sc)
+				}
+			}
+			if err == nil {
+				err = m.trackFree(ptr, size)
+			}
+			if err != nil {
+				n, _ := m.freeSmallBatch(sc, size, ptrs[:i])
+				return n, m.report(err)
+			}
+		}
+
+		n, err := m.freeSmallBatch(sc, size, ptrs)
+		return n, m.report(err)
+	}
+
+	for i, ptr := range ptrs {
+		if err = m.Free(ptr, size); err != nil {
+			return i, err
+		}
+	}
+
+	return len(ptrs), nil
+}
+
+// freeSmallBatch frees the small blocks checked by trackFree with freeBatch and forgets
+// the accepted ones. Small chunks are never removed from the page map, so their owner
+// is still found. The blocks from the first one rejected by the state bits on are still
+// in use, so they are recorded again in exact mode.
+func (m *Manager) freeSmallBatch(sc common.SizeClass, size int, ptrs []unsafe.Pointer) (int, error) {
+	n, err := m.sm.freeBatch(sc, ptrs)
+	for _, ptr := range ptrs[:n] {
+		o, _ := m.pageMap.lookup(uintptr(ptr))
+		m.untrackFree(ptr, size, o)
+	}
+	if m.exact != nil {
+		for _, ptr := range ptrs[n:] {
+			m.exact.alloc(ptr, size)
+		}
+	}
+
+	return n, err
+}
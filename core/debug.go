@@ -0,0 +1,388 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"github.com/TimeWtr/TurboAlloc/common"
+	"github.com/TimeWtr/TurboAlloc/syscall"
+)
+
+const (
+	// DefaultQuarantineBytes is the default number of freed bytes held back by the debug
+	// mode before they are reused.
+	DefaultQuarantineBytes = 4 * common.MB
+	// debugCanarySize is the size of the canary in front of every debug block, it keeps
+	// the user pointer 16 byte aligned.
+	debugCanarySize = 16
+	// canaryByte fills the bytes around a debug block, poisonByte fills freed blocks.
+	canaryByte = 0xCB
+	poisonByte = 0xDD
+	// debugStackDepth is the number of frames recorded per allocation and free.
+	debugStackDepth = 32
+)
+
+// ErrCorruption is wrapped by every Violation.
+var ErrCorruption = errors.New("memory corruption detected")
+
+// ViolationKind classifies the corruption found by the debug mode.
+type ViolationKind uint8
+
+const (
+	// ViolationOverflow is a write past the end of a block.
+	ViolationOverflow ViolationKind = iota
+	// ViolationUnderflow is a write before the start of a block.
+	ViolationUnderflow
+	// ViolationUseAfterFree is a write to a block sitting in quarantine.
+	ViolationUseAfterFree
+	// ViolationDoubleFree is a free of a block sitting in quarantine.
+	ViolationDoubleFree
+)
+
+func (k ViolationKind) String() string {
+	switch k {
+	case ViolationOverflow:
+		return "buffer overflow"
+	case ViolationUnderflow:
+		return "buffer underflow"
+	case ViolationUseAfterFree:
+		return "use after free"
+	case ViolationDoubleFree:
+		return "double free"
+	default:
+		return common.Unknown
+	}
+}
+
+// Violation reports a corruption found by the debug mode along with the stack traces of
+// the allocation and of the free of the block involved.
+type Violation struct {
+	Kind ViolationKind
+	// Ptr and Size describe the block as returned by Alloc.
+	Ptr  uintptr
+	Size int
+	// Offset is the position of the first corrupted byte relative to Ptr.
+	Offset int
+	// AllocStack and FreeStack hold the program counters of the allocation and of the
+	// first free of the block, Stack those of the call that found the violation, if any.
+	AllocStack []uintptr
+	FreeStack  []uintptr
+	Stack      []uintptr
+}
+
+func (v *Violation) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s at %#x, offset %d of a %d byte block", ErrCorruption, v.Kind, v.Ptr, v.Offset, v.Size)
+	writeStack(&b, "detected at", v.Stack)
+	writeStack(&b, "allocated at", v.AllocStack)
+	writeStack(&b, "freed at", v.FreeStack)
+	return b.String()
+}
+
+func (v *Violation) Unwrap() error {
+	return ErrCorruption
+}
+
+func writeStack(b *strings.Builder, title string, pcs []uintptr) {
+	if len(pcs) == 0 {
+		return
+	}
+
+	fmt.Fprintf(b, "\n%s:", title)
+	frames := runtime.CallersFrames(pcs)
+	for {
+		f, more := frames.Next()
+		fmt.Fprintf(b, "\n\t%s\n\t\t%s:%d", f.Function, f.File, f.Line)
+		if !more {
+			return
+		}
+	}
+}
+
+// WithDebug enables the debug mode. Small and medium blocks are surrounded by canaries
+// checked on free, large regions are followed by a PROT_NONE guard page, and freed
+// blocks are poisoned and held in a quarantine of quarantineBytes bytes, checked when
+// they leave it. Violations found on free are returned by Free, the ones found when a
+// block leaves the quarantine are passed to onViolation, which panics when nil.
+func WithDebug(enable bool, quarantineBytes int64, onViolation func(*Violation)) Option {
+	return func(m *Manager) {
+		if !enable {
+			return
+		}
+
+		if quarantineBytes <= 0 {
+			quarantineBytes = DefaultQuarantineBytes
+		}
+		if onViolation == nil {
+			onViolation = func(v *Violation) { panic(v) }
+		}
+		m.debug = &debugAllocator{
+			m:           m,
+			live:        make(map[uintptr]*debugBlock),
+			freed:       make(map[uintptr]*debugBlock),
+			limit:       quarantineBytes,
+			onViolation: onViolation,
+		}
+	}
+}
+
+// debugBlock is the bookkeeping of a block handed out in debug mode. The user bytes
+// sit between a head and a tail canary inside a raw block, or right before the guard
+// page of a large raw region.
+type debugBlock struct {
+	raw     unsafe.Pointer
+	rawSize int
+	user    unsafe.Pointer
+	size    int
+	// guard is the PROT_NONE page ending the raw region of large blocks.
+	guard unsafe.Pointer
+	alloc []uintptr
+	free  []uintptr
+}
+
+// end returns the end of the bytes of the raw block that are checked.
+func (b *debugBlock) end() unsafe.Pointer {
+	if b.guard != nil {
+		return b.guard
+	}
+
+	return unsafe.Add(b.raw, b.rawSize)
+}
+
+type debugAllocator struct {
+	m  *Manager
+	mu sync.Mutex
+	// live holds the blocks handed out, keyed by user address.
+	live map[uintptr]*debugBlock
+	// quarantine holds the freed blocks oldest first, freed indexes them by user address.
+	quarantine  []*debugBlock
+	freed       map[uintptr]*debugBlock
+	quarantined int64
+	limit       int64
+	onViolation func(*Violation)
+}
+
+func callers() []uintptr {
+	pcs := make([]uintptr, debugStackDepth)
+	// Skip runtime.Callers, callers and the debug allocator method.
+	return pcs[:runtime.Callers(3, pcs)]
+}
+
+// alloc returns a block of size bytes surrounded by canaries, or followed by a guard
+// page for large sizes.
+func (d *debugAllocator) alloc(size int) (unsafe.Pointer, error) {
+	sc, err := d.m.sizeClassOf(size)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &debugBlock{size: size, alloc: callers()}
+	if sc.Category() == common.LargeSizeCategory {
+		pageSize := d.m.sys.PageSize()
+		region := syscall.AlignUp(size, pageSize)
+		b.rawSize = region + pageSize
+		if b.raw, err = d.m.lm.alloc(b.rawSize); err != nil {
+			return nil, err
+		}
+
+		b.guard = unsafe.Add(b.raw, region)
+		if err = d.m.sys.SetProtection(b.guard, syscall.ProtNone); err != nil {
+			_ = d.m.lm.free(b.raw, b.rawSize)
+			return nil, err
+		}
+		b.user = unsafe.Add(b.guard, -syscall.AlignUp(size, debugCanarySize))
+	} else {
+		b.rawSize = size + 2*debugCanarySize
+		if b.raw, err = d.m.alloc(b.rawSize); err != nil {
+			return nil, err
+		}
+		b.user = unsafe.Add(b.raw, debugCanarySize)
+	}
+
+	fillBytes(b.raw, int(uintptr(b.user)-uintptr(b.raw)), canaryByte)
+	tail := unsafe.Add(b.user, size)
+	fillBytes(tail, int(uintptr(b.end())-uintptr(tail)), canaryByte)
+
+	d.mu.Lock()
+	d.live[uintptr(b.user)] = b
+	delete(d.freed, uintptr(b.user))
+	d.mu.Unlock()
+	d.m.recordAlloc(b.user, size)
+	return b.user, nil
+}
+
+// free checks the canaries of the block, poisons it and moves it to the quarantine.
+// Blocks with damaged canaries are reported and never reused.
+func (d *debugAllocator) free(ptr unsafe.Pointer, size int) error {
+	stack := callers()
+	d.mu.Lock()
+	b, ok := d.live[uintptr(ptr)]
+	if !ok {
+		q, freed := d.freed[uintptr(ptr)]
+		d.mu.Unlock()
+		if freed {
+			return &Violation{
+				Kind:       ViolationDoubleFree,
+				Ptr:        uintptr(ptr),
+				Size:       q.size,
+				AllocStack: q.alloc,
+				FreeStack:  q.free,
+				Stack:      stack,
+			}
+		}
+		return fmt.Errorf("%w: %p was not allocated by this manager", ErrInvalidPointer, ptr)
+	}
+
+	if size != b.size {
+		d.mu.Unlock()
+		return fmt.Errorf("%w: %p was allocated with %d bytes, not %d", ErrSizeMismatch, ptr, b.size, size)
+	}
+
+	delete(d.live, uintptr(ptr))
+	o, _ := d.m.pageMap.lookup(uintptr(ptr))
+	d.m.recordFree(ptr, size, o)
+	b.free = stack
+	if v := b.checkCanaries(); v != nil {
+		d.mu.Unlock()
+		v.Stack = stack
+		return v
+	}
+
+	fillBytes(b.raw, int(uintptr(b.end())-uintptr(b.raw)), poisonByte)
+	d.quarantine = append(d.quarantine, b)
+	d.freed[uintptr(ptr)] = b
+	d.quarantined += int64(b.rawSize)
+	evicted := d.evictLocked(d.limit)
+	d.mu.Unlock()
+
+	d.release(evicted)
+	return nil
+}
+
+// sizeOf returns the size a live debug block was allocated with.
+func (d *debugAllocator) sizeOf(ptr unsafe.Pointer) (int, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	b, ok := d.live[uintptr(ptr)]
+	if !ok {
+		return 0, false
+	}
+
+	return b.size, true
+}
+
+// flush checks and releases every block of the quarantine.
+func (d *debugAllocator) flush() {
+	d.mu.Lock()
+	evicted := d.evictLocked(0)
+	d.mu.Unlock()
+
+	d.release(evicted)
+}
+
+// evictLocked removes the oldest blocks from the quarantine until it holds at most
+// limit bytes.
+func (d *debugAllocator) evictLocked(limit int64) []*debugBlock {
+	n := 0
+	for n < len(d.quarantine) && d.quarantined > limit {
+		b := d.quarantine[n]
+		d.quarantined -= int64(b.rawSize)
+		if d.freed[uintptr(b.user)] == b {
+			delete(d.freed, uintptr(b.user))
+		}
+		n++
+	}
+
+	evicted := d.quarantine[:n:n]
+	d.quarantine = d.quarantine[n:]
+	return evicted
+}
+
+// release checks that the evicted blocks are still poisoned and returns them to the
+// manager. Blocks written to while in quarantine are reported and never reused.
+func (d *debugAllocator) release(evicted []*debugBlock) {
+	for _, b := range evicted {
+		if off := mismatch(b.raw, int(uintptr(b.end())-uintptr(b.raw)), poisonByte); off >= 0 {
+			d.onViolation(&Violation{
+				Kind:       ViolationUseAfterFree,
+				Ptr:        uintptr(b.user),
+				Size:       b.size,
+				Offset:     off - int(uintptr(b.user)-uintptr(b.raw)),
+				AllocStack: b.alloc,
+				FreeStack:  b.free,
+			})
+			continue
+		}
+
+		if b.guard == nil {
+			_ = d.m.free(b.raw, b.rawSize)
+			continue
+		}
+
+		if d.m.sys.SetProtection(b.guard, syscall.ProtRead|syscall.ProtWrite) == nil {
+			_ = d.m.lm.free(b.raw, b.rawSize)
+		}
+	}
+}
+
+// checkCanaries returns the violation of the first damaged canary byte, or nil.
+func (b *debugBlock) checkCanaries() *Violation {
+	v := &Violation{Ptr: uintptr(b.user), Size: b.size, AllocStack: b.alloc, FreeStack: b.free}
+	head := int(uintptr(b.user) - uintptr(b.raw))
+	if off := mismatch(b.raw, head, canaryByte); off >= 0 {
+		v.Kind, v.Offset = ViolationUnderflow, off-head
+		return v
+	}
+
+	tail := unsafe.Add(b.user, b.size)
+	if off := mismatch(tail, int(uintptr(b.end())-uintptr(tail)), canaryByte); off >= 0 {
+		v.Kind, v.Offset = ViolationOverflow, b.size+off
+		return v
+	}
+
+	return nil
+}
+
+func fillBytes(ptr unsafe.Pointer, n int, c byte) {
+	data := unsafe.Slice((*byte)(ptr), n)
+	for i := range data {
+		data[i] = c
+	}
+}
+
+// mismatch returns the offset of the first of the n bytes at ptr that differs from c,
+// or -1 when they all match.
+func mismatch(ptr unsafe.Pointer, n int, c byte) int {
+	data := unsafe.Slice((*byte)(ptr), n)
+	if bytes.Count(data, []byte{c}) == n {
+		return -1
+	}
+
+	for i, v := range data {
+		if v != c {
+			return i
+		}
+	}
+
+	return -1
+}
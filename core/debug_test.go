@@ -0,0 +1,117 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"errors"
+	"testing"
+	"unsafe"
+
+	"github.com/TimeWtr/TurboAlloc/common"
+	"github.com/TimeWtr/TurboAlloc/syscall"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestDebugManager(t *testing.T, quarantineBytes int64) (*Manager, *syscall.FakeSyscall, *[]*Violation) {
+	t.Helper()
+	var violations []*Violation
+	m, sys := newTestScavengeManager(t, WithDebug(true, quarantineBytes, func(v *Violation) {
+		violations = append(violations, v)
+	}))
+	return m, sys, &violations
+}
+
+func TestManager_DebugCanaries(t *testing.T) {
+	for _, size := range []int{common.B64 - 5, common.KB * 16} {
+		m, _, _ := newTestDebugManager(t, 0)
+		ptr, err := m.Alloc(size)
+		assert.NoError(t, err)
+		assert.Zero(t, uintptr(ptr)%debugCanarySize)
+		*(*byte)(unsafe.Add(ptr, size+2)) = 1
+
+		var v *Violation
+		err = m.Free(ptr, size)
+		assert.ErrorIs(t, err, ErrCorruption)
+		assert.True(t, errors.As(err, &v))
+		assert.Equal(t, ViolationOverflow, v.Kind)
+		assert.Equal(t, size+2, v.Offset)
+		assert.NotEmpty(t, v.AllocStack)
+		assert.Contains(t, err.Error(), "TestManager_DebugCanaries")
+
+		ptr, err = m.Alloc(size)
+		assert.NoError(t, err)
+		*(*byte)(unsafe.Add(ptr, -1)) = 1
+		err = m.Free(ptr, size)
+		assert.True(t, errors.As(err, &v))
+		assert.Equal(t, ViolationUnderflow, v.Kind)
+		assert.Equal(t, -1, v.Offset)
+	}
+}
+
+func TestManager_DebugGuardPage(t *testing.T) {
+	m, sys, _ := newTestDebugManager(t, common.MB)
+	size := common.MB + 100
+	ptr, err := m.Alloc(size)
+	assert.NoError(t, err)
+
+	guard := unsafe.Add(ptr, syscall.AlignUp(size, debugCanarySize))
+	assert.Zero(t, uintptr(guard)%uintptr(sys.PageSize()))
+	assert.Equal(t, syscall.ProtNone, sys.Protection(guard))
+
+	// The region exceeds the quarantine, it is released right away and its guard lifted.
+	assert.NoError(t, m.Free(ptr, size))
+	assert.Equal(t, syscall.ProtRead|syscall.ProtWrite, sys.Protection(guard))
+}
+
+func TestManager_DebugQuarantine(t *testing.T) {
+	m, _, violations := newTestDebugManager(t, common.MB)
+	ptr, err := m.Alloc(common.B64)
+	assert.NoError(t, err)
+	assert.NoError(t, m.Free(ptr, common.B64))
+
+	// Freed blocks are poisoned and not handed out again.
+	assert.Equal(t, -1, mismatch(ptr, common.B64, poisonByte))
+	again, err := m.Alloc(common.B64)
+	assert.NoError(t, err)
+	assert.NotEqual(t, ptr, again)
+	assert.NoError(t, m.Free(again, common.B64))
+
+	err = m.Free(ptr, common.B64)
+	var v *Violation
+	assert.True(t, errors.As(err, &v))
+	assert.Equal(t, ViolationDoubleFree, v.Kind)
+	assert.NotEmpty(t, v.FreeStack)
+
+	*(*byte)(unsafe.Add(ptr, 3)) = 0
+	m.debug.flush()
+	assert.Len(t, *violations, 1)
+	assert.Equal(t, ViolationUseAfterFree, (*violations)[0].Kind)
+	assert.Equal(t, 3, (*violations)[0].Offset)
+	assert.NotEmpty(t, (*violations)[0].FreeStack)
+}
+
+func TestManager_DebugSizeOf(t *testing.T) {
+	m, _, _ := newTestDebugManager(t, 0)
+	ptr, err := m.Alloc(100)
+	assert.NoError(t, err)
+	size, err := m.SizeOf(ptr)
+	assert.NoError(t, err)
+	assert.Equal(t, 100, size)
+	assert.ErrorIs(t, m.Free(ptr, 50), ErrInvalidPointer)
+
+	size, err = m.FreeUnsized(ptr)
+	assert.NoError(t, err)
+	assert.Equal(t, 100, size)
+}
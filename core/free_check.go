@@ -0,0 +1,203 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"sync"
+	"unsafe"
+
+	"github.com/TimeWtr/TurboAlloc/common"
+	"github.com/TimeWtr/TurboAlloc/utils/log"
+)
+
+// FreeCheckMode selects how thoroughly the blocks passed to Free are validated.
+type FreeCheckMode uint8
+
+const (
+	// FreeCheckStateBits is the default mode. Freed pointers are looked up in the page
+	// map, which rejects foreign pointers and sizes of another class, and the state bit
+	// of the block rejects double frees.
+	FreeCheckStateBits FreeCheckMode = iota
+	// FreeCheckExact additionally records the size of every live block, so that frees
+	// must pass the exact size given to Alloc. It serializes allocations on a lock and is
+	// meant for tests.
+	FreeCheckExact
+)
+
+func (f FreeCheckMode) String() string {
+	switch f {
+	case FreeCheckStateBits:
+		return "state bits"
+	case FreeCheckExact:
+		return "exact"
+	default:
+		return common.Unknown
+	}
+}
+
+// WithFreeCheck sets the free validation mode. Every invalid free is passed to onError
+// when it is not nil, before the error is returned.
+func WithFreeCheck(mode FreeCheckMode, onError func(error)) Option {
+	return func(m *Manager) {
+		m.onFreeError = onError
+		if mode == FreeCheckExact {
+			m.exact = &exactTracker{blocks: make(map[uintptr]exactBlock)}
+		}
+	}
+}
+
+// PanicOnFreeError is an error handler for WithFreeCheck that panics.
+func PanicOnFreeError(err error) {
+	panic(err)
+}
+
+// LogFreeErrors returns an error handler for WithFreeCheck that logs to logger.
+func LogFreeErrors(logger log.Logger) func(error) {
+	return func(err error) {
+		logger.Error("invalid free", log.ErrorField(err))
+	}
+}
+
+// exactBlock is the record of a block that was handed out at least once.
+type exactBlock struct {
+	size int
+	live bool
+}
+
+// exactTracker records every block handed out along with its requested size. Freed
+// blocks are kept as dead records, which tells double frees from wild pointers.
+type exactTracker struct {
+	mu     sync.Mutex
+	blocks map[uintptr]exactBlock
+}
+
+func (t *exactTracker) alloc(ptr unsafe.Pointer, size int) {
+	t.mu.Lock()
+	t.blocks[uintptr(ptr)] = exactBlock{size: size, live: true}
+	t.mu.Unlock()
+}
+
+// free marks the block at ptr as freed, size is only checked when positive.
+func (t *exactTracker) free(ptr unsafe.Pointer, size int) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b, ok := t.blocks[uintptr(ptr)]
+	switch {
+	case !ok:
+		return fmt.Errorf("%w: %p was never handed out", ErrInvalidPointer, ptr)
+	case !b.live:
+		return fmt.Errorf("%w: %p", ErrDoubleFree, ptr)
+	case size > 0 && size != b.size:
+		return fmt.Errorf("%w: %p was allocated with %d bytes, not %d", ErrSizeMismatch, ptr, b.size, size)
+	}
+
+	t.blocks[uintptr(ptr)] = exactBlock{size: b.size}
+	return nil
+}
+
+// trackAlloc records a block handed out in exact mode and, unless it is the raw block of
+// a debug block, for the leak tracker and the heap profile. Debug blocks are recorded
+// by the debug allocator, under the address handed to the caller.
+func (m *Manager) trackAlloc(ptr unsafe.Pointer, size int) {
+	if m.exact != nil {
+		m.exact.alloc(ptr, size)
+	}
+	if m.debug == nil {
+		m.recordAlloc(ptr, size)
+	}
+}
+
+// trackFree checks a block being freed in exact mode, size is only checked when positive.
+// The block is forgotten with untrackFree once its manager accepted the free.
+func (m *Manager) trackFree(ptr unsafe.Pointer, size int) error {
+	if m.exact != nil {
+		return m.exact.free(ptr, size)
+	}
+
+	return nil
+}
+
+// untrackFree forgets a freed block like trackAlloc recorded it, o is the owner of the
+// block looked up before the free cleared it from the page map.
+func (m *Manager) untrackFree(ptr unsafe.Pointer, size int, o Owner) {
+	if m.debug == nil {
+		m.recordFree(ptr, size, o)
+	}
+}
+
+// recordAlloc records a block handed out to the caller for the leak tracker, the heap
+// profile and the tracer.
+func (m *Manager) recordAlloc(ptr unsafe.Pointer, size int) {
+	if m.leaks != nil {
+		m.leaks.alloc(ptr, size)
+	}
+	if m.profiler != nil {
+		m.profiler.alloc(ptr, size)
+	}
+	if m.tracer != nil {
+		o, _ := m.pageMap.lookup(uintptr(ptr))
+		m.tracer.record(TraceAlloc, ptr, size, o)
+	}
+}
+
+// recordFree forgets a block accepted by its manager, it must not be called for a
+// rejected free so that a block still in use stays recorded.
+func (m *Manager) recordFree(ptr unsafe.Pointer, size int, o Owner) {
+	if m.leaks != nil {
+		m.leaks.free(ptr)
+	}
+	if m.profiler != nil {
+		m.profiler.free(ptr)
+	}
+	if m.tracer != nil {
+		m.tracer.record(TraceFree, ptr, size, o)
+	}
+}
+
+// checkFree validates a block freed with size bytes before it is routed to class sc and
+// returns its owner. The state bits are checked by the size category managers.
+func (m *Manager) checkFree(ptr unsafe.Pointer, size int, sc common.SizeClass) (Owner, error) {
+	o, err := m.checkOwner(ptr, sc)
+	if err != nil {
+		return o, err
+	}
+
+	return o, m.trackFree(ptr, size)
+}
+
+// checkOwner checks that the page containing ptr belongs to class sc and returns its owner.
+func (m *Manager) checkOwner(ptr unsafe.Pointer, sc common.SizeClass) (Owner, error) {
+	o, err := m.Owner(ptr)
+	if err != nil {
+		return o, err
+	}
+
+	if o.Class != sc {
+		return o, fmt.Errorf("%w: %p is a %s block, not %s", ErrSizeMismatch, ptr, o.Class, sc)
+	}
+
+	return o, nil
+}
+
+// report passes a free error to the error handler and returns it.
+func (m *Manager) report(err error) error {
+	if err != nil && m.onFreeError != nil {
+		m.onFreeError(err)
+	}
+
+	return err
+}
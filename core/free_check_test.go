@@ -0,0 +1,137 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"testing"
+	"unsafe"
+
+	"github.com/TimeWtr/TurboAlloc/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManager_FreeCheckStateBits(t *testing.T) {
+	for _, size := range []int{common.B64, common.KB * 16, common.MB} {
+		var reported []error
+		m, _ := newTestScavengeManager(t, WithFreeCheck(FreeCheckStateBits, func(err error) {
+			reported = append(reported, err)
+		}))
+
+		ptr, err := m.Alloc(size)
+		assert.NoError(t, err)
+		assert.ErrorIs(t, m.Free(ptr, size*4), ErrSizeMismatch, size)
+		assert.NoError(t, m.Free(ptr, size))
+		assert.ErrorIs(t, m.Free(ptr, size), ErrInvalidPointer, size)
+
+		var local [64]byte
+		assert.ErrorIs(t, m.Free(unsafe.Pointer(&local), size), ErrForeignPointer, size)
+		assert.Len(t, reported, 3, size)
+
+		// The rejected free did not push the block twice.
+		a, err := m.Alloc(size)
+		assert.NoError(t, err)
+		b, err := m.Alloc(size)
+		assert.NoError(t, err)
+		assert.NotEqual(t, a, b, size)
+	}
+}
+
+func TestManager_FreeCheckSizeMismatch(t *testing.T) {
+	// Sizes of the same class that round to different page counts.
+	m, _ := newTestScavengeManager(t)
+	ptr, err := m.Alloc(common.KB * 200)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, m.Free(ptr, common.KB*180), ErrSizeMismatch)
+	_, err = m.Realloc(ptr, common.KB*180, common.MB)
+	assert.ErrorIs(t, err, ErrSizeMismatch)
+	assert.NoError(t, m.Free(ptr, common.KB*200))
+
+	m, _ = newTestScavengeManager(t, WithDebug(true, 0, nil))
+	for _, size := range []int{60, common.KB * 200} {
+		ptr, err = m.Alloc(size)
+		assert.NoError(t, err)
+		assert.ErrorIs(t, m.Free(ptr, size-4), ErrSizeMismatch, size)
+		assert.NoError(t, m.Free(ptr, size), size)
+	}
+}
+
+func TestManager_FreeCheckDoubleFree(t *testing.T) {
+	for _, size := range []int{common.B64, common.KB * 16} {
+		m, _ := newTestScavengeManager(t)
+		ptr, err := m.Alloc(size)
+		assert.NoError(t, err)
+		assert.NoError(t, m.Free(ptr, size))
+		assert.ErrorIs(t, m.Free(ptr, size), ErrDoubleFree, size)
+
+		// A block of an owned page that was never handed out.
+		assert.ErrorIs(t, m.Free(unsafe.Add(ptr, size), size), ErrDoubleFree, size)
+	}
+}
+
+func TestManager_FreeCheckBatch(t *testing.T) {
+	m, _ := newTestScavengeManager(t)
+	out := make([]unsafe.Pointer, 4)
+	assert.NoError(t, m.AllocBatch(common.B64, out))
+
+	n, err := m.FreeBatch(common.B64, []unsafe.Pointer{out[0], out[1], out[0], out[2]})
+	assert.ErrorIs(t, err, ErrDoubleFree)
+	assert.Equal(t, 2, n)
+	n, err = m.FreeBatch(common.B64, out[2:])
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+}
+
+func TestManager_FreeCheckExact(t *testing.T) {
+	m, _ := newTestScavengeManager(t, WithFreeCheck(FreeCheckExact, nil))
+	ptr, err := m.Alloc(60)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, m.Free(ptr, common.B64), ErrSizeMismatch)
+
+	ptr, err = m.Realloc(ptr, 60, 50)
+	assert.NoError(t, err)
+	size, err := m.FreeUnsized(ptr)
+	assert.NoError(t, err)
+	assert.Equal(t, common.B64, size)
+	assert.ErrorIs(t, m.Free(ptr, 50), ErrDoubleFree)
+
+	large, err := m.AllocAligned(common.MB, common.MB*2)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, m.FreeAligned(large, common.MB+1, common.MB*2), ErrSizeMismatch)
+	assert.NoError(t, m.FreeAligned(large, common.MB, common.MB*2))
+}
+
+func TestManager_FreeCheckExactBatch(t *testing.T) {
+	m, _ := newTestScavengeManager(t, WithFreeCheck(FreeCheckExact, nil))
+	out := make([]unsafe.Pointer, 3)
+	assert.NoError(t, m.AllocBatch(common.B64, out))
+
+	// Freed behind the exact tracker's back, the state bits reject it in the batch.
+	assert.NoError(t, m.sm.free(out[1], common.SizeClass64B))
+	n, err := m.FreeBatch(common.B64, out)
+	assert.ErrorIs(t, err, ErrDoubleFree)
+	assert.Equal(t, 1, n)
+
+	// The block behind the rejected one is still live for the exact tracker.
+	assert.NoError(t, m.Free(out[2], common.B64))
+}
+
+func TestManager_FreeCheckPanic(t *testing.T) {
+	m, _ := newTestScavengeManager(t, WithFreeCheck(FreeCheckStateBits, PanicOnFreeError))
+	ptr, err := m.Alloc(common.B64)
+	assert.NoError(t, err)
+	assert.NoError(t, m.Free(ptr, common.B64))
+	assert.PanicsWithError(t, fmt.Sprintf("%s: %p", ErrDoubleFree, ptr), func() { _ = m.Free(ptr, common.B64) })
+}
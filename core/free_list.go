@@ -0,0 +1,136 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+const (
+	// addrBits is the number of low bits of a tagged head that hold the block address.
+	// User space addresses on amd64 and arm64 fit in 48 bits.
+	addrBits = 48
+	addrMask = 1<<addrBits - 1
+	// maxBlockAddr is the first address that can not be represented in a tagged head.
+	maxBlockAddr = 1 << addrBits
+)
+
+// block is the header written into the first word of every free block. Blocks live in
+// off-heap memory, so the link is kept as a plain address to stay invisible to the
+// garbage collector and its write barriers.
+type block struct {
+	next uintptr
+}
+
+// blockAt converts an address of off-heap memory to a block pointer.
+func blockAt(addr uintptr) *block {
+	return (*block)(addrToPtr(addr))
+}
+
+// addrToPtr converts an address of off-heap memory to an unsafe.Pointer.
+func addrToPtr(addr uintptr) unsafe.Pointer {
+	return *(*unsafe.Pointer)(unsafe.Pointer(&addr))
+}
+
+// taggedStack is a lock-free Treiber stack of blocks. The head packs the address of the
+// top block in its low 48 bits and a modification tag in the high 16 bits. Every
+// successful CAS bumps the tag, so a pop that raced with a pop+push of the same top
+// block (the ABA problem) sees a different head value and retries instead of
+// installing a stale next link.
+type taggedStack struct {
+	head atomic.Uint64
+}
+
+func packHead(addr uintptr, tag uint64) uint64 {
+	return uint64(addr)&addrMask | tag<<addrBits
+}
+
+// push places a single block on top of the stack.
+func (s *taggedStack) push(b *block) {
+	s.pushChain(b, b)
+}
+
+// pushChain places an already linked chain of blocks, from first to last, on top of
+// the stack with a single CAS.
+func (s *taggedStack) pushChain(first, last *block) {
+	addr := uintptr(unsafe.Pointer(first))
+	for {
+		old := s.head.Load()
+		last.next = uintptr(old & addrMask)
+		if s.head.CompareAndSwap(old, packHead(addr, old>>addrBits+1)) {
+			return
+		}
+	}
+}
+
+// pop removes the top block, it returns nil when the stack is empty. Reading the next
+// link of a block that was concurrently popped and reused is harmless, because the
+// tag comparison makes the following CAS fail.
+func (s *taggedStack) pop() *block {
+	for {
+		old := s.head.Load()
+		addr := uintptr(old & addrMask)
+		if addr == 0 {
+			return nil
+		}
+
+		next := blockAt(addr).next
+		if s.head.CompareAndSwap(old, packHead(next, old>>addrBits+1)) {
+			return blockAt(addr)
+		}
+	}
+}
+
+// popAll detaches every block with a single CAS and returns the top one, it returns nil
+// when the stack is empty. Unlike a chain of pops, only the caller can reach the
+// detached blocks, so their links can be followed safely.
+func (s *taggedStack) popAll() *block {
+	for {
+		old := s.head.Load()
+		addr := uintptr(old & addrMask)
+		if addr == 0 {
+			return nil
+		}
+
+		if s.head.CompareAndSwap(old, packHead(0, old>>addrBits+1)) {
+			return blockAt(addr)
+		}
+	}
+}
+
+// pushList places a chain starting at first and ending with a zero link on top of the
+// stack without walking it. On an empty stack this takes a single CAS, blocks pushed in
+// the meantime are detached and put in front of the chain.
+func (s *taggedStack) pushList(first *block) {
+	for {
+		old := s.head.Load()
+		if old&addrMask != 0 {
+			if top := s.popAll(); top != nil {
+				last := top
+				for last.next != 0 {
+					last = blockAt(last.next)
+				}
+				last.next = uintptr(unsafe.Pointer(first))
+				first = top
+			}
+			continue
+		}
+
+		if s.head.CompareAndSwap(old, packHead(uintptr(unsafe.Pointer(first)), old>>addrBits+1)) {
+			return
+		}
+	}
+}
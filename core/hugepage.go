@@ -0,0 +1,85 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import "github.com/TimeWtr/TurboAlloc/syscall"
+
+// HugePageStats reports how much of the memory mapped by the manager is backed by
+// huge pages.
+type HugePageStats struct {
+	// HugeTLBBytes is the number of medium arena bytes mapped from hugetlbfs.
+	HugeTLBBytes int64
+	// TransparentBytes is the number of bytes the kernel currently backs with
+	// transparent huge pages, as reported by /proc/self/smaps.
+	TransparentBytes int64
+}
+
+// Total returns the number of bytes backed by huge pages.
+func (h HugePageStats) Total() int64 {
+	return h.HugeTLBBytes + h.TransparentBytes
+}
+
+// WithHugePage reserves the medium arenas and the large regions of at least one huge
+// page in huge page aligned regions backed by hugetlbfs or transparent huge pages.
+// It has no effect when the configured Syscall does not implement
+// syscall.HugePageSyscall.
+func WithHugePage(enable bool) Option {
+	return func(m *Manager) {
+		m.hugePage = enable
+	}
+}
+
+// enableHugePages wires the huge page capable syscall into the medium and large managers.
+func (m *Manager) enableHugePages() {
+	huge, ok := m.sys.(syscall.HugePageSyscall)
+	if !m.hugePage || !ok {
+		return
+	}
+
+	// The per-node heaps of NUMA map their huge arenas through their own node.
+	for _, heap := range m.mm.heaps {
+		heap.huge, _ = heap.sys.(syscall.HugePageSyscall)
+	}
+	m.lm.huge = huge
+}
+
+// HugePageStats returns the number of bytes currently backed by huge pages.
+func (m *Manager) HugePageStats() (HugePageStats, error) {
+	huge, ok := m.sys.(syscall.HugePageSyscall)
+	if !m.hugePage || !ok {
+		return HugePageStats{}, nil
+	}
+
+	var (
+		hugeTLBBytes int64
+		regions      []syscall.Region
+	)
+	for _, heap := range m.mm.heaps {
+		heap.mu.Lock()
+		hugeTLBBytes += heap.hugeTLBBytes
+		regions = append(regions, heap.transparent...)
+		heap.mu.Unlock()
+	}
+
+	transparent, err := huge.HugePageBytes(append(regions, m.lm.regions()...))
+	if err != nil {
+		return HugePageStats{}, err
+	}
+
+	return HugePageStats{
+		HugeTLBBytes:     hugeTLBBytes,
+		TransparentBytes: int64(transparent),
+	}, nil
+}
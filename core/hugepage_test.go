@@ -0,0 +1,69 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"testing"
+
+	"github.com/TimeWtr/TurboAlloc/common"
+	"github.com/TimeWtr/TurboAlloc/syscall"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManager_HugePageArenas(t *testing.T) {
+	sys := newTestSyscall(t)
+	sys.SetHugeTLBPages(2)
+	m, err := NewManager(0.5, 0.5, 0, WithSyscall(sys), WithHugePage(true))
+	assert.NoError(t, err)
+
+	// The first medium arena (4MB) consumes both hugetlbfs pages, the second falls
+	// back to transparent huge pages.
+	medium, err := m.Alloc(common.KB * 64)
+	assert.NoError(t, err)
+	assert.Zero(t, uintptr(medium)%syscall.HugePageSize)
+	assert.NoError(t, m.mm.heaps[0].grow(1))
+
+	// A 3MB large allocation maps two huge pages and retains the 1MB remainder.
+	large, err := m.Alloc(common.MB * 3)
+	assert.NoError(t, err)
+	assert.Zero(t, uintptr(large)%syscall.HugePageSize)
+	assert.Equal(t, int64(common.MB), m.lm.freeBytes)
+	assert.Equal(t, int64(common.MB*4), m.lm.mapped.Load())
+
+	stats, err := m.HugePageStats()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(heapArenaSize), stats.HugeTLBBytes)
+	assert.Equal(t, int64(heapArenaSize+common.MB*4), stats.TransparentBytes)
+	assert.Equal(t, stats.HugeTLBBytes+stats.TransparentBytes, stats.Total())
+
+	assert.NoError(t, m.Free(medium, common.KB*64))
+	assert.NoError(t, m.Free(large, common.MB*3))
+}
+
+func TestManager_HugePageDisabled(t *testing.T) {
+	sys := newTestSyscall(t)
+	m, err := NewManager(0.5, 0.5, 0, WithSyscall(sys))
+	assert.NoError(t, err)
+
+	large, err := m.Alloc(common.MB * 3)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(common.MB*3), m.lm.mapped.Load())
+	assert.Zero(t, m.lm.freeBytes)
+
+	stats, err := m.HugePageStats()
+	assert.NoError(t, err)
+	assert.Zero(t, stats.Total())
+	assert.NoError(t, m.Free(large, common.MB*3))
+}
@@ -15,20 +15,518 @@
 package core
 
 import (
+	"fmt"
+	"sort"
+	"sync"
 	"sync/atomic"
 	"unsafe"
+
+	"github.com/TimeWtr/TurboAlloc/common"
+	"github.com/TimeWtr/TurboAlloc/syscall"
 )
 
+// DefaultLargeRetainedBytes is the default number of free large-region bytes kept mapped
+// for reuse before regions are returned to the OS.
+const DefaultLargeRetainedBytes = 64 * common.MB
+
 type largePage struct {
 	addr     unsafe.Pointer
 	size     int64
 	isUsed   atomic.Bool
 	shardIdx uint16
+	// released is set on free regions whose pages are not backed by physical memory.
+	released bool
+	// zeroed is set on free regions whose pages read as zero.
+	zeroed bool
+}
+
+func (p *largePage) end() uintptr {
+	return uintptr(p.addr) + uintptr(p.size)
 }
 
+// LargeManager serves the large size classes from dedicated mmap regions. Freed regions
+// are retained for best-fit reuse, split when they are larger than needed and coalesced
+// with adjacent free regions. Once the retained bytes exceed maxRetained the largest
+// free regions are unmapped.
 type LargeManager struct {
-	largePages     []*largePage
+	// mu protects largePages, freePages and freeBytes.
+	mu sync.Mutex
+	// largePages maps the start address of every region in use to its metadata.
+	largePages     map[uintptr]*largePage
 	largePageCount atomic.Uint32
-	freePages      []*largePage
-	freePageCount  atomic.Uint32
+	// freePages holds the retained free regions sorted by address.
+	freePages     []*largePage
+	freePageCount atomic.Uint32
+	// freeBytes is the total size of freePages.
+	freeBytes int64
+	// maxRetained caps freeBytes.
+	maxRetained int64
+	// mapped is the number of bytes currently mapped from the OS.
+	mapped atomic.Int64
+	// sys maps and unmaps the regions.
+	sys syscall.Syscall
+	// huge is set when regions of at least one huge page use transparent huge pages.
+	huge syscall.HugePageSyscall
+	// classes counts the activity of every large size class, allocations are attributed
+	// to the smallest class holding their size.
+	classes [largeClassNums]largeClassCounters
+	// zeroOnFree releases the pages of freed regions so that they read as zero.
+	zeroOnFree bool
+	// pageMap records the owner of every page of the regions in use.
+	pageMap *pageMap
+}
+
+// largeClassNums is the number of large size classes.
+const largeClassNums = int(common.SizeClassMax-common.SizeClass128KB) + 1
+
+type largeClassCounters struct {
+	allocs  atomic.Uint64
+	frees   atomic.Uint64
+	refills atomic.Uint64
+	objects atomic.Int64
+	bytes   atomic.Int64
+}
+
+// classOf returns the large class an allocation of size bytes is attributed to.
+func classOf(size int) common.SizeClass {
+	sc, ok := common.SizeClassOf(size)
+	if !ok || sc < common.SizeClass128KB {
+		sc = common.SizeClass128KB
+	}
+
+	return sc
+}
+
+// counters returns the counters of the class holding size bytes.
+func (l *LargeManager) counters(size int) *largeClassCounters {
+	return &l.classes[classOf(size)-common.SizeClass128KB]
+}
+
+// track records the need bytes at ptr in the page map as a region of size bytes.
+func (l *LargeManager) track(ptr unsafe.Pointer, need int64, size int) {
+	l.pageMap.set(uintptr(ptr), int(need), Owner{Class: classOf(size), Category: common.LargeSizeCategory})
+}
+
+func (c *largeClassCounters) alloc(size int64) {
+	c.allocs.Add(1)
+	c.objects.Add(1)
+	c.bytes.Add(size)
+}
+
+func newLargeManager(sys syscall.Syscall, maxRetained int64) *LargeManager {
+	return &LargeManager{
+		sys:         sys,
+		largePages:  make(map[uintptr]*largePage),
+		maxRetained: maxRetained,
+	}
+}
+
+// alloc returns a region of at least size bytes, reusing a retained free region when one
+// is large enough.
+func (l *LargeManager) alloc(size int) (unsafe.Pointer, error) {
+	ptr, _, err := l.allocFresh(size)
+	return ptr, err
+}
+
+// allocFresh is alloc also reporting whether the region is known to be zero.
+func (l *LargeManager) allocFresh(size int) (unsafe.Pointer, bool, error) {
+	need := int64(syscall.AlignUp(size, l.sys.PageSize()))
+	c := l.counters(size)
+	ptr, fresh, err := l.allocRegion(need, c)
+	if err != nil {
+		return nil, false, err
+	}
+
+	l.track(ptr, need, size)
+	c.alloc(need)
+	return ptr, fresh, nil
+}
+
+// allocAligned returns a region of at least size bytes aligned to align, which must be
+// a power of two. Regions are page aligned, larger alignments are carved out of a region
+// padded by align bytes whose unaligned head and unused tail are retained as free regions.
+func (l *LargeManager) allocAligned(size, align int) (unsafe.Pointer, error) {
+	pageSize := l.sys.PageSize()
+	if align <= pageSize {
+		return l.alloc(size)
+	}
+
+	need := int64(syscall.AlignUp(size, pageSize))
+	c := l.counters(size)
+	ptr, fresh, err := l.allocRegion(need+int64(align-pageSize), c)
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	p := l.largePages[uintptr(ptr)]
+	head := syscall.AlignUp(int(uintptr(ptr)), align) - int(uintptr(ptr))
+	aligned := unsafe.Add(ptr, head)
+	if head > 0 {
+		delete(l.largePages, uintptr(ptr))
+		l.insertFree(&largePage{addr: ptr, size: int64(head), zeroed: fresh})
+		p.addr, p.size = aligned, p.size-int64(head)
+		l.largePages[uintptr(aligned)] = p
+	}
+
+	if tail := p.size - need; tail > 0 {
+		p.size = need
+		l.insertFree(&largePage{addr: unsafe.Add(aligned, need), size: tail, zeroed: fresh})
+	}
+	if err = l.trim(); err != nil {
+		return nil, err
+	}
+
+	l.track(aligned, need, size)
+	c.alloc(need)
+	return aligned, nil
+}
+
+// allocRegion returns a region of need bytes, reusing a retained free region when one
+// is large enough and counting a refill on c when a new region is mapped. It reports
+// whether the region is known to be zero.
+func (l *LargeManager) allocRegion(need int64, c *largeClassCounters) (unsafe.Pointer, bool, error) {
+	if p := l.reuse(need); p != nil {
+		return p.addr, p.zeroed, nil
+	}
+
+	ptr, mapSize, err := l.mapRegion(need)
+	if err != nil {
+		return nil, false, err
+	}
+	l.mapped.Add(mapSize)
+	c.refills.Add(1)
+
+	p := &largePage{addr: ptr, size: need}
+	p.isUsed.Store(true)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.largePages[uintptr(ptr)] = p
+	l.largePageCount.Add(1)
+	if mapSize > need {
+		l.insertFree(&largePage{
+			addr:     unsafe.Add(ptr, need),
+			size:     mapSize - need,
+			released: true,
+			zeroed:   true,
+		})
+	}
+
+	return ptr, true, nil
+}
+
+// mapRegion maps a region for an allocation of need bytes. With huge pages enabled,
+// allocations of at least one huge page get a huge page aligned region advised for
+// transparent huge pages, rounded up to whole huge pages. The remainder is retained
+// as a free region. hugetlbfs is not used because retained regions are split and
+// partially unmapped at page granularity.
+func (l *LargeManager) mapRegion(need int64) (unsafe.Pointer, int64, error) {
+	if l.huge != nil && need >= syscall.HugePageSize {
+		size := int64(syscall.AlignUp(int(need), syscall.HugePageSize))
+		if ptr, _, err := l.huge.AllocHugePages(int(size), false); err == nil {
+			return ptr, size, nil
+		}
+	}
+
+	ptr, err := l.sys.AllocPages(int(need))
+	return ptr, need, err
+}
+
+// regions returns every region mapped by the manager, in use or retained.
+func (l *LargeManager) regions() []syscall.Region {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	regions := make([]syscall.Region, 0, len(l.largePages)+len(l.freePages))
+	for _, p := range l.largePages {
+		regions = append(regions, syscall.Region{Ptr: p.addr, Size: int(p.size)})
+	}
+	for _, p := range l.freePages {
+		regions = append(regions, syscall.Region{Ptr: p.addr, Size: int(p.size)})
+	}
+
+	return regions
+}
+
+// reuse takes the smallest free region of at least need bytes, splitting off and
+// retaining the remainder.
+func (l *LargeManager) reuse(need int64) *largePage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	best := -1
+	for i, p := range l.freePages {
+		if p.size >= need && (best < 0 || p.size < l.freePages[best].size) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return nil
+	}
+
+	p := l.freePages[best]
+	if p.size > need {
+		l.freePages[best] = &largePage{
+			addr:     unsafe.Add(p.addr, need),
+			size:     p.size - need,
+			released: p.released,
+			zeroed:   p.zeroed,
+		}
+		p.size = need
+	} else {
+		l.freePages = append(l.freePages[:best], l.freePages[best+1:]...)
+	}
+
+	l.freeBytes -= need
+	l.freePageCount.Store(uint32(len(l.freePages)))
+	p.isUsed.Store(true)
+	l.largePages[uintptr(p.addr)] = p
+	l.largePageCount.Add(1)
+	return p
+}
+
+// free retains the region starting at ptr for reuse, merging it with adjacent free
+// regions, and unmaps regions when the retained bytes exceed the cap.
+func (l *LargeManager) free(ptr unsafe.Pointer, size int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	p, ok := l.largePages[uintptr(ptr)]
+	if !ok {
+		return fmt.Errorf("%w: %p was not allocated by the large manager", ErrInvalidPointer, ptr)
+	}
+	if p.size != int64(syscall.AlignUp(size, l.sys.PageSize())) {
+		return fmt.Errorf("%w: %p has size %d, not %d", ErrSizeMismatch, ptr, p.size, size)
+	}
+
+	delete(l.largePages, uintptr(ptr))
+	l.largePageCount.Add(^uint32(0))
+	c := l.counters(size)
+	c.frees.Add(1)
+	c.objects.Add(-1)
+	c.bytes.Add(-p.size)
+	l.pageMap.clear(uintptr(p.addr), int(p.size))
+	p.isUsed.Store(false)
+	p.released, p.zeroed = false, false
+	l.wipe(p)
+	l.insertFree(p)
+	return l.trim()
+}
+
+// sizeOf returns the size of the region in use starting at ptr.
+func (l *LargeManager) sizeOf(ptr unsafe.Pointer) (int, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	p, ok := l.largePages[uintptr(ptr)]
+	if !ok {
+		return 0, false
+	}
+
+	return int(p.size), true
+}
+
+// wipe clears a region that is being freed when zeroOnFree is set. The pages are
+// released with MADV_DONTNEED, which is cheaper than clearing them, and are only
+// cleared when releasing fails.
+func (l *LargeManager) wipe(p *largePage) {
+	if !l.zeroOnFree {
+		return
+	}
+
+	if l.sys.ReleasePages(p.addr, int(p.size), false) == nil {
+		p.released = true
+	} else {
+		clear(unsafe.Slice((*byte)(p.addr), p.size))
+	}
+	p.zeroed = true
+}
+
+// resize changes the size of the region at ptr to newSize bytes and returns its address.
+// A shrinking region returns its tail to the free regions, a growing region takes the
+// adjacent free region when it is large enough and is otherwise moved with mremap when
+// sys supports it. It returns nil when the region can only be resized by copying.
+func (l *LargeManager) resize(ptr unsafe.Pointer, oldSize, newSize int) (unsafe.Pointer, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	p, ok := l.largePages[uintptr(ptr)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %p was not allocated by the large manager", ErrInvalidPointer, ptr)
+	}
+	if p.size != int64(syscall.AlignUp(oldSize, l.sys.PageSize())) {
+		return nil, fmt.Errorf("%w: %p has size %d, not %d", ErrSizeMismatch, ptr, p.size, oldSize)
+	}
+
+	oldAddr, oldLen := p.addr, p.size
+	need := int64(syscall.AlignUp(newSize, l.sys.PageSize()))
+	switch {
+	case need == p.size:
+	case need < p.size:
+		tail := &largePage{addr: unsafe.Add(p.addr, need), size: p.size - need}
+		p.size = need
+		l.wipe(tail)
+		l.insertFree(tail)
+		if err := l.trim(); err != nil {
+			return nil, err
+		}
+	case l.growInPlace(p, need):
+	default:
+		remap, ok := l.sys.(syscall.RemapSyscall)
+		if !ok {
+			return nil, nil
+		}
+
+		moved, err := remap.RemapPages(p.addr, int(p.size), int(need))
+		if err != nil {
+			// The region may span several mappings, let the caller copy it.
+			return nil, nil
+		}
+
+		delete(l.largePages, uintptr(p.addr))
+		l.mapped.Add(need - p.size)
+		p.addr, p.size = moved, need
+		l.largePages[uintptr(moved)] = p
+	}
+
+	l.pageMap.clear(uintptr(oldAddr), int(oldLen))
+	l.track(p.addr, p.size, newSize)
+	from, to := l.counters(oldSize), l.counters(newSize)
+	from.objects.Add(-1)
+	from.bytes.Add(-int64(syscall.AlignUp(oldSize, l.sys.PageSize())))
+	to.objects.Add(1)
+	to.bytes.Add(p.size)
+	return p.addr, nil
+}
+
+// growInPlace extends p to need bytes with the free region that starts where p ends.
+func (l *LargeManager) growInPlace(p *largePage, need int64) bool {
+	idx := sort.Search(len(l.freePages), func(i int) bool {
+		return uintptr(l.freePages[i].addr) >= p.end()
+	})
+	if idx == len(l.freePages) || uintptr(l.freePages[idx].addr) != p.end() {
+		return false
+	}
+
+	next, delta := l.freePages[idx], need-p.size
+	if next.size < delta {
+		return false
+	}
+
+	if next.size == delta {
+		l.freePages = append(l.freePages[:idx], l.freePages[idx+1:]...)
+		l.freePageCount.Store(uint32(len(l.freePages)))
+	} else {
+		next.addr = unsafe.Add(next.addr, delta)
+		next.size -= delta
+	}
+
+	l.freeBytes -= delta
+	p.size = need
+	return true
+}
+
+// insertFree adds p to freePages keeping them sorted by address and coalesces it with
+// its neighbours.
+func (l *LargeManager) insertFree(p *largePage) {
+	l.freeBytes += p.size
+	idx := sort.Search(len(l.freePages), func(i int) bool {
+		return uintptr(l.freePages[i].addr) > uintptr(p.addr)
+	})
+
+	if idx < len(l.freePages) && p.end() == uintptr(l.freePages[idx].addr) {
+		p.size += l.freePages[idx].size
+		p.released = p.released && l.freePages[idx].released
+		p.zeroed = p.zeroed && l.freePages[idx].zeroed
+		l.freePages = append(l.freePages[:idx], l.freePages[idx+1:]...)
+	}
+
+	if idx > 0 && l.freePages[idx-1].end() == uintptr(p.addr) {
+		l.freePages[idx-1].size += p.size
+		l.freePages[idx-1].released = l.freePages[idx-1].released && p.released
+		l.freePages[idx-1].zeroed = l.freePages[idx-1].zeroed && p.zeroed
+	} else {
+		l.freePages = append(l.freePages, nil)
+		copy(l.freePages[idx+1:], l.freePages[idx:])
+		l.freePages[idx] = p
+	}
+
+	l.freePageCount.Store(uint32(len(l.freePages)))
+}
+
+// trim unmaps the largest free regions until the retained bytes fit the cap.
+func (l *LargeManager) trim() error {
+	for l.freeBytes > l.maxRetained && len(l.freePages) > 0 {
+		largest := 0
+		for i, p := range l.freePages {
+			if p.size > l.freePages[largest].size {
+				largest = i
+			}
+		}
+
+		p := l.freePages[largest]
+		if err := l.sys.FreePages(p.addr, int(p.size)); err != nil {
+			return err
+		}
+
+		l.freePages = append(l.freePages[:largest], l.freePages[largest+1:]...)
+		l.freeBytes -= p.size
+		l.mapped.Add(-p.size)
+	}
+
+	l.freePageCount.Store(uint32(len(l.freePages)))
+	return nil
+}
+
+// fragmentation returns the retained free bytes and the bytes handed out.
+func (l *LargeManager) fragmentation() Fragmentation {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.fragmentationLocked()
+}
+
+func (l *LargeManager) fragmentationLocked() Fragmentation {
+	return Fragmentation{FreeBytes: l.freeBytes, UsedBytes: l.mapped.Load() - l.freeBytes}
+}
+
+// scavenge returns the pages of the retained free regions to the OS when the retained
+// bytes exceed ratio times the bytes in use. The regions stay mapped for reuse. It
+// returns the number of bytes released.
+func (l *LargeManager) scavenge(ratio float64, lazy bool) int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.fragmentationLocked().Exceeds(ratio) {
+		return 0
+	}
+
+	var released int64
+	for _, p := range l.freePages {
+		if p.released || l.sys.ReleasePages(p.addr, int(p.size), lazy) != nil {
+			continue
+		}
+
+		p.released = true
+		p.zeroed = !lazy
+		released += p.size
+	}
+
+	return released
+}
+
+// classStats returns the statistics of a large size class. Retained free regions are
+// not attributed to a class, so CachedBytes is always zero.
+func (l *LargeManager) classStats(sc common.SizeClass) ClassStats {
+	c := &l.classes[sc-common.SizeClass128KB]
+	return ClassStats{Class: sc, AllocStats: AllocStats{
+		InUseObjects: c.objects.Load(),
+		InUseBytes:   c.bytes.Load(),
+		Allocs:       c.allocs.Load(),
+		Frees:        c.frees.Load(),
+		Refills:      c.refills.Load(),
+		MappedBytes:  c.bytes.Load(),
+	}}
 }
@@ -0,0 +1,177 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"testing"
+	"unsafe"
+
+	"github.com/TimeWtr/TurboAlloc/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLargeManager_ReuseBestFitAndSplit(t *testing.T) {
+	l := newLargeManager(newTestSyscall(t), DefaultLargeRetainedBytes)
+	small, err := l.alloc(common.KB * 256)
+	assert.NoError(t, err)
+	// The separator keeps the two free regions from being coalesced.
+	sep, err := l.alloc(common.KB * 128)
+	assert.NoError(t, err)
+	big, err := l.alloc(common.MB)
+	assert.NoError(t, err)
+	assert.NoError(t, l.free(small, common.KB*256))
+	assert.NoError(t, l.free(big, common.MB))
+	assert.Equal(t, uint32(1), l.largePageCount.Load())
+	mapped := l.mapped.Load()
+
+	// 200KB fits both free regions, best fit picks the 256KB one.
+	ptr, err := l.alloc(common.KB * 200)
+	assert.NoError(t, err)
+	assert.Equal(t, small, ptr)
+
+	// 512KB is split off the front of the 1MB region, the rest stays free.
+	half, err := l.alloc(common.KB * 512)
+	assert.NoError(t, err)
+	assert.Equal(t, big, half)
+	assert.Equal(t, int64(common.KB*(56+512)), l.freeBytes)
+	assert.Equal(t, mapped, l.mapped.Load())
+
+	assert.NoError(t, l.free(ptr, common.KB*200))
+	assert.NoError(t, l.free(half, common.KB*512))
+	assert.NoError(t, l.free(sep, common.KB*128))
+}
+
+func TestLargeManager_CoalesceAdjacent(t *testing.T) {
+	l := newLargeManager(newTestSyscall(t), DefaultLargeRetainedBytes)
+	region, err := l.alloc(common.MB)
+	assert.NoError(t, err)
+	assert.NoError(t, l.free(region, common.MB))
+
+	a, err := l.alloc(common.KB * 256)
+	assert.NoError(t, err)
+	b, err := l.alloc(common.KB * 256)
+	assert.NoError(t, err)
+	c, err := l.alloc(common.KB * 512)
+	assert.NoError(t, err)
+	assert.Equal(t, unsafe.Add(a, common.KB*256), b)
+	assert.Empty(t, l.freePages)
+
+	assert.NoError(t, l.free(a, common.KB*256))
+	assert.NoError(t, l.free(c, common.KB*512))
+	assert.Len(t, l.freePages, 2)
+
+	// b bridges a and c, so all three merge back into the original region.
+	assert.NoError(t, l.free(b, common.KB*256))
+	assert.Len(t, l.freePages, 1)
+	assert.Equal(t, region, l.freePages[0].addr)
+	assert.Equal(t, int64(common.MB), l.freePages[0].size)
+}
+
+func TestLargeManager_TrimAboveRetainedCap(t *testing.T) {
+	l := newLargeManager(newTestSyscall(t), common.MB)
+	a, err := l.alloc(common.MB)
+	assert.NoError(t, err)
+	b, err := l.alloc(common.MB * 2)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(common.MB*3), l.mapped.Load())
+
+	assert.NoError(t, l.free(a, common.MB))
+	assert.Equal(t, int64(common.MB), l.freeBytes)
+
+	// Retaining b as well would exceed the cap, so the largest free region is unmapped.
+	assert.NoError(t, l.free(b, common.MB*2))
+	assert.LessOrEqual(t, l.freeBytes, int64(common.MB))
+	assert.LessOrEqual(t, l.mapped.Load(), int64(common.MB))
+}
+
+func TestLargeManager_FreeInvalid(t *testing.T) {
+	l := newLargeManager(newTestSyscall(t), DefaultLargeRetainedBytes)
+	ptr, err := l.alloc(common.KB * 128)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, l.free(unsafe.Add(ptr, common.KB*4), common.KB*128), ErrInvalidPointer)
+	assert.ErrorIs(t, l.free(ptr, common.MB), ErrInvalidPointer)
+	assert.NoError(t, l.free(ptr, common.KB*128))
+	assert.ErrorIs(t, l.free(ptr, common.KB*128), ErrInvalidPointer)
+}
+
+func TestLargeManager_Resize(t *testing.T) {
+	sys := newTestSyscall(t)
+	l := newLargeManager(sys, DefaultLargeRetainedBytes)
+	region, err := l.alloc(common.MB * 2)
+	assert.NoError(t, err)
+	assert.NoError(t, l.free(region, common.MB*2))
+
+	// The region takes the front of the free 2MB, growing eats into the remainder.
+	ptr, err := l.alloc(common.MB)
+	assert.NoError(t, err)
+	grown, err := l.resize(ptr, common.MB, common.KB*1536)
+	assert.NoError(t, err)
+	assert.Equal(t, ptr, grown)
+	assert.Equal(t, int64(common.KB*512), l.freeBytes)
+
+	// Shrinking returns the tail, which merges with the free remainder.
+	shrunk, err := l.resize(grown, common.KB*1536, common.KB*256)
+	assert.NoError(t, err)
+	assert.Equal(t, ptr, shrunk)
+	assert.Len(t, l.freePages, 1)
+	assert.Equal(t, int64(common.KB*1792), l.freeBytes)
+
+	// Without a free neighbour large enough the region is remapped.
+	*(*uint64)(shrunk) = 42
+	moved, err := l.resize(shrunk, common.KB*256, common.MB*4)
+	assert.NoError(t, err)
+	assert.NotEqual(t, shrunk, moved)
+	assert.Equal(t, 1, sys.Remaps())
+	assert.Equal(t, uint64(42), *(*uint64)(moved))
+	assert.Equal(t, int64(common.MB*6-common.KB*256), l.mapped.Load())
+
+	_, err = l.resize(shrunk, common.KB*256, common.MB)
+	assert.ErrorIs(t, err, ErrInvalidPointer)
+	assert.NoError(t, l.free(moved, common.MB*4))
+}
+
+func TestLargeManager_AllocAligned(t *testing.T) {
+	l := newLargeManager(newTestSyscall(t), DefaultLargeRetainedBytes)
+	ptr, err := l.allocAligned(common.KB*128, common.MB*2)
+	assert.NoError(t, err)
+	assert.Zero(t, uintptr(ptr)%(common.MB*2))
+
+	// The region is padded by the alignment less a page, only the aligned block is in
+	// use and the padding is retained.
+	padded := int64(common.MB*2 + common.KB*124)
+	assert.Equal(t, padded, l.mapped.Load())
+	assert.Equal(t, padded-common.KB*128, l.freeBytes)
+	assert.Len(t, l.largePages, 1)
+
+	assert.ErrorIs(t, l.free(ptr, common.MB*2), ErrInvalidPointer)
+	assert.NoError(t, l.free(ptr, common.KB*128))
+	assert.Len(t, l.freePages, 1)
+	assert.Equal(t, padded, l.freeBytes)
+}
+
+func TestLargeManager_AllocAlignedTrims(t *testing.T) {
+	sys := newTestSyscall(t)
+	l := newLargeManager(sys, common.KB*256)
+	ptr, err := l.allocAligned(common.KB*128, common.MB*2)
+	assert.NoError(t, err)
+	assert.Zero(t, uintptr(ptr)%(common.MB*2))
+
+	// The padding exceeds the retained bytes cap, so the largest leftovers are unmapped.
+	assert.LessOrEqual(t, l.freeBytes, l.maxRetained)
+	assert.Equal(t, int64(common.KB*128)+l.freeBytes, l.mapped.Load())
+	assert.Equal(t, int(l.mapped.Load()), sys.LiveBytes())
+	assert.NoError(t, l.free(ptr, common.KB*128))
+	assert.LessOrEqual(t, l.freeBytes, l.maxRetained)
+}
@@ -0,0 +1,198 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"github.com/TimeWtr/TurboAlloc/common"
+)
+
+const (
+	// leakStackDepth is the number of frames recorded per live allocation, enough to
+	// reach past the frames of the allocator.
+	leakStackDepth = 32
+	leakShardCount = 64
+)
+
+// ErrLeak is returned by CheckLeaks when allocations are still live.
+var ErrLeak = errors.New("allocations still live")
+
+// modulePath is the import path of the allocator module, the frames of its packages are
+// skipped when attributing an allocation to its call site.
+var modulePath = strings.TrimSuffix(reflect.TypeFor[Manager]().PkgPath(), "/core")
+
+// LiveAllocation groups the allocations still live from one call site.
+type LiveAllocation struct {
+	// Site is the function, file and line of the call site, outside of the allocator.
+	Site string
+	// Stack holds the program counters of one of the allocations, starting at the call site.
+	Stack []uintptr
+	Count int
+	Bytes int64
+}
+
+// WithLeakTracking records the call stack of every allocation until it is freed, see
+// Manager.LiveAllocations. It costs a stack walk and a locked map update per call.
+func WithLeakTracking(enable bool) Option {
+	return func(m *Manager) {
+		if enable {
+			m.leaks = new(leakTracker)
+		}
+	}
+}
+
+type leakRecord struct {
+	size  int
+	depth int
+	stack [leakStackDepth]uintptr
+}
+
+// leakTracker holds the live allocations in maps sharded by address.
+type leakTracker struct {
+	shards [leakShardCount]leakShard
+}
+
+type leakShard struct {
+	mu   sync.Mutex
+	live map[uintptr]*leakRecord
+	_    [cacheLineSize - 16]byte
+}
+
+func (t *leakTracker) shard(ptr unsafe.Pointer) *leakShard {
+	// Blocks are at least 8 byte aligned, mix the higher bits into the shard index.
+	addr := uintptr(ptr) >> 3
+	return &t.shards[(addr^addr>>6^addr>>12)%leakShardCount]
+}
+
+func (t *leakTracker) alloc(ptr unsafe.Pointer, size int) *leakRecord {
+	r := &leakRecord{size: size}
+	// Skip runtime.Callers and alloc, the frames of the allocator are skipped later.
+	r.depth = runtime.Callers(2, r.stack[:])
+	s := t.shard(ptr)
+	s.mu.Lock()
+	if s.live == nil {
+		s.live = make(map[uintptr]*leakRecord)
+	}
+	s.live[uintptr(ptr)] = r
+	s.mu.Unlock()
+	return r
+}
+
+func (t *leakTracker) free(ptr unsafe.Pointer) {
+	s := t.shard(ptr)
+	s.mu.Lock()
+	delete(s.live, uintptr(ptr))
+	s.mu.Unlock()
+}
+
+// each calls fn with every live record, one shard locked at a time.
+func (t *leakTracker) each(fn func(*leakRecord)) {
+	for i := range t.shards {
+		s := &t.shards[i]
+		s.mu.Lock()
+		for _, r := range s.live {
+			fn(r)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// snapshot groups the live allocations by call site, largest first.
+func (t *leakTracker) snapshot() []LiveAllocation {
+	sites := make(map[string]*LiveAllocation)
+	t.each(func(r *leakRecord) {
+		site, stack := callSite(r.stack[:r.depth])
+		a, ok := sites[site]
+		if !ok {
+			a = &LiveAllocation{Site: site, Stack: stack}
+			sites[site] = a
+		}
+		a.Count++
+		a.Bytes += int64(r.size)
+	})
+
+	live := make([]LiveAllocation, 0, len(sites))
+	for _, a := range sites {
+		live = append(live, *a)
+	}
+	sort.Slice(live, func(i, j int) bool {
+		if live[i].Bytes != live[j].Bytes {
+			return live[i].Bytes > live[j].Bytes
+		}
+		return live[i].Site < live[j].Site
+	})
+	return live
+}
+
+// callSite returns the first frame of stack outside of the allocator, along with the
+// stack starting at it. Test files of the allocator's packages count as callers. Each
+// program counter is expanded on its own since the allocator may be inlined into the
+// caller.
+func callSite(stack []uintptr) (string, []uintptr) {
+	for i := range stack {
+		frames := runtime.CallersFrames(stack[i : i+1])
+		for {
+			f, more := frames.Next()
+			if !inModule(f.Function) || strings.HasSuffix(f.File, "_test.go") {
+				return fmt.Sprintf("%s (%s:%d)", f.Function, f.File, f.Line), stack[i:]
+			}
+			if !more {
+				break
+			}
+		}
+	}
+
+	return common.Unknown, nil
+}
+
+// inModule reports whether function belongs to one of the allocator's packages.
+func inModule(function string) bool {
+	rest, ok := strings.CutPrefix(function, modulePath)
+	return ok && (strings.HasPrefix(rest, ".") || strings.HasPrefix(rest, "/"))
+}
+
+// LiveAllocations returns the allocations that were not freed yet grouped by call site,
+// largest first. It is nil unless leak tracking is enabled.
+func (m *Manager) LiveAllocations() []LiveAllocation {
+	if m.leaks == nil {
+		return nil
+	}
+
+	return m.leaks.snapshot()
+}
+
+// CheckLeaks returns an error wrapping ErrLeak and listing the call sites of the live
+// allocations when there are any. Tests call it at teardown once everything was freed.
+func (m *Manager) CheckLeaks() error {
+	live := m.LiveAllocations()
+	if len(live) == 0 {
+		return nil
+	}
+
+	var b strings.Builder
+	for _, a := range live {
+		fmt.Fprintf(&b, "\n\t%d bytes in %d allocations from %s", a.Bytes, a.Count, a.Site)
+	}
+
+	return fmt.Errorf("%w:%s", ErrLeak, b.String())
+}
@@ -0,0 +1,106 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"bytes"
+	"testing"
+	"unsafe"
+
+	"github.com/TimeWtr/TurboAlloc/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func leakyAlloc(t *testing.T, m *Manager, size int) unsafe.Pointer {
+	ptr, err := m.Alloc(size)
+	assert.NoError(t, err)
+	return ptr
+}
+
+func TestManager_LiveAllocations(t *testing.T) {
+	m, _ := newTestScavengeManager(t, WithLeakTracking(true))
+	var ptrs []unsafe.Pointer
+	for range 3 {
+		ptrs = append(ptrs, leakyAlloc(t, m, common.KB*16))
+	}
+	batch := make([]unsafe.Pointer, 4)
+	assert.NoError(t, m.AllocBatch(common.B64, batch))
+
+	live := m.LiveAllocations()
+	assert.Len(t, live, 2)
+	assert.Contains(t, live[0].Site, "core.leakyAlloc")
+	assert.Equal(t, 3, live[0].Count)
+	assert.Equal(t, int64(common.KB*48), live[0].Bytes)
+	assert.Contains(t, live[1].Site, "core.TestManager_LiveAllocations")
+	assert.Contains(t, live[1].Site, "leak_test.go")
+	assert.Equal(t, 4, live[1].Count)
+	assert.NotEmpty(t, live[1].Stack)
+
+	err := m.CheckLeaks()
+	assert.ErrorIs(t, err, ErrLeak)
+	assert.Contains(t, err.Error(), "49152 bytes in 3 allocations from")
+
+	for _, ptr := range ptrs {
+		assert.NoError(t, m.Free(ptr, common.KB*16))
+	}
+	_, err = m.FreeBatch(common.B64, batch)
+	assert.NoError(t, err)
+	assert.Empty(t, m.LiveAllocations())
+	assert.NoError(t, m.CheckLeaks())
+}
+
+func TestManager_LiveAllocationsRejectedFree(t *testing.T) {
+	m, _ := newTestScavengeManager(t, WithLeakTracking(true), WithTracing(16))
+	large := leakyAlloc(t, m, common.KB*200)
+	small := leakyAlloc(t, m, common.B64)
+	assert.NoError(t, m.Free(small, common.B64))
+	small = leakyAlloc(t, m, common.B32)
+
+	// A free rejected by the owning manager leaves the block recorded.
+	assert.ErrorIs(t, m.Free(large, common.KB*180), ErrInvalidPointer)
+	live := m.LiveAllocations()
+	assert.Len(t, live, 1)
+	assert.Equal(t, 2, live[0].Count)
+	assert.ErrorIs(t, m.CheckLeaks(), ErrLeak)
+
+	var buf bytes.Buffer
+	assert.NoError(t, m.WriteTrace(&buf))
+	trace, err := ReadTrace(&buf)
+	assert.NoError(t, err)
+	assert.Len(t, trace.Events, 4)
+
+	assert.NoError(t, m.Free(large, common.KB*200))
+	assert.NoError(t, m.Free(small, common.B32))
+	assert.ErrorIs(t, m.Free(small, common.B32), ErrDoubleFree)
+	assert.NoError(t, m.CheckLeaks())
+
+	buf.Reset()
+	assert.NoError(t, m.WriteTrace(&buf))
+	trace, err = ReadTrace(&buf)
+	assert.NoError(t, err)
+	assert.Len(t, trace.Events, 6)
+}
+
+func TestManager_LiveAllocationsDebug(t *testing.T) {
+	m, _ := newTestScavengeManager(t, WithLeakTracking(true), WithDebug(true, common.MB, nil))
+	ptr := leakyAlloc(t, m, 100)
+	live := m.LiveAllocations()
+	assert.Len(t, live, 1)
+	assert.Equal(t, int64(100), live[0].Bytes)
+
+	// The block sits in quarantine but is no longer live.
+	assert.NoError(t, m.Free(ptr, 100))
+	assert.NoError(t, m.CheckLeaks())
+}
@@ -17,8 +17,13 @@ package core
 import (
 	"errors"
 	"runtime"
+	"sync"
+	"time"
+	"unsafe"
 
 	"github.com/TimeWtr/TurboAlloc/common"
+	"github.com/TimeWtr/TurboAlloc/numa"
+	"github.com/TimeWtr/TurboAlloc/syscall"
 	"github.com/TimeWtr/TurboAlloc/utils"
 )
 
@@ -28,10 +33,80 @@ type Manager struct {
 	lm              *LargeManager
 	globalConfig    common.GlobalConfig
 	sizeClassConfig common.SizeClassConfig
+	selector        ShardSelector
+	largeRetained   int64
+	sys             syscall.Syscall
+	hugePage        bool
+	zeroOnFree      bool
+	pageMap         *pageMap
+	debug           *debugAllocator
+	exact           *exactTracker
+	leaks           *leakTracker
+	profiler        *heapProfiler
+	tracer          *tracer
+	onFreeError     func(error)
+	topology        *numa.Topology
+	numaPolicy      NUMAPolicy
+	router          *numaRouter
+	scavenger       scavenger
+	emitter         statsEmitter
+	// stop is closed by Close to end the background goroutines tracked by background.
+	stop       chan struct{}
+	background sync.WaitGroup
+	closeOnce  sync.Once
 }
 
-func NewManager(smWeight, mmWeight, _ float64) (*Manager, error) {
-	m := &Manager{}
+// Option configures optional behaviour of a Manager.
+type Option func(*Manager)
+
+// WithShardSelector sets the strategy used by the small and medium managers to pick a
+// shard for each allocation. The default is ProcPinSelector.
+func WithShardSelector(selector ShardSelector) Option {
+	return func(m *Manager) {
+		if selector != nil {
+			m.selector = selector
+		}
+	}
+}
+
+// WithLargeRetainedBytes caps the number of free large-region bytes kept mapped for
+// reuse, the default is DefaultLargeRetainedBytes.
+func WithLargeRetainedBytes(n int64) Option {
+	return func(m *Manager) {
+		if n > 0 {
+			m.largeRetained = n
+		}
+	}
+}
+
+// WithSyscall sets the OS memory primitives used to map pages, the default is a
+// syscall.LinuxSyscall using the OS page size.
+func WithSyscall(sys syscall.Syscall) Option {
+	return func(m *Manager) {
+		if sys != nil {
+			m.sys = sys
+		}
+	}
+}
+
+func NewManager(smWeight, mmWeight, _ float64, opts ...Option) (*Manager, error) {
+	m := &Manager{
+		selector:      NewProcPinSelector(),
+		largeRetained: DefaultLargeRetainedBytes,
+		stop:          make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	if m.sys == nil {
+		sys, err := syscall.NewLinuxSyscall(0)
+		if err != nil {
+			return nil, err
+		}
+		m.sys = sys
+	}
+	m.enableNUMA()
 
 	// Normalization of the percentage of small and medium target managers
 	cpuCores := runtime.GOMAXPROCS(0)
@@ -40,11 +115,292 @@ func NewManager(smWeight, mmWeight, _ float64) (*Manager, error) {
 	}
 
 	smCores, mmCores := utils.CalculateCores(cpuCores, smWeight, mmWeight)
-	m.sm = newSmallManager(m.calculateShards(cpuCores, smCores))
-	m.mm = newMediumManager(m.calculateShards(cpuCores, mmCores))
+	m.sm = newSmallManager(m.calculateShards(cpuCores, smCores), m.selector, m.sys)
+	m.mm = newMediumManager(m.calculateShards(cpuCores, mmCores), m.selector, m.sys)
+	m.lm = newLargeManager(m.sys, m.largeRetained)
+	m.trackPages()
+	m.splitMediumHeaps()
+	m.enableHugePages()
+	m.enableZeroOnFree()
+	m.startScavenger()
+	m.startStatsEmitter()
 	return m, nil
 }
 
+// every runs fn every interval on a background goroutine until Close is called.
+func (m *Manager) every(interval time.Duration, fn func()) {
+	m.background.Add(1)
+	go func() {
+		defer m.background.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				fn()
+			case <-m.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the background scavenger and stats emitter and closes the stats
+// subscriptions. Memory handed out stays valid.
+func (m *Manager) Close() error {
+	m.closeOnce.Do(func() {
+		close(m.stop)
+		m.background.Wait()
+		m.emitter.closeSubscribers()
+		if m.debug != nil {
+			m.debug.flush()
+		}
+	})
+
+	return nil
+}
+
+// Alloc returns a block of at least size bytes. The request is rounded up to the
+// smallest fitting size class and routed to the manager owning that class category.
+func (m *Manager) Alloc(size int) (unsafe.Pointer, error) {
+	if m.debug != nil {
+		return m.debug.alloc(size)
+	}
+
+	return m.alloc(size)
+}
+
+// alloc is Alloc bypassing the debug mode.
+func (m *Manager) alloc(size int) (unsafe.Pointer, error) {
+	sc, err := m.sizeClassOf(size)
+	if err != nil {
+		return nil, err
+	}
+
+	var ptr unsafe.Pointer
+	switch sc.Category() {
+	case common.SmallSizeCategory:
+		ptr, err = m.sm.alloc(sc)
+	case common.MediumSizeCategory:
+		ptr, err = m.mm.alloc(sc)
+	default:
+		ptr, err = m.lm.alloc(size)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	m.trackAlloc(ptr, size)
+	return ptr, nil
+}
+
+// Free returns a block obtained from Alloc. size must be the same value that was
+// passed to Alloc so that the block is routed back to the owning size class.
+func (m *Manager) Free(ptr unsafe.Pointer, size int) error {
+	if ptr == nil {
+		return ErrInvalidPointer
+	}
+
+	if m.debug != nil {
+		return m.report(m.debug.free(ptr, size))
+	}
+
+	return m.free(ptr, size)
+}
+
+// free is Free bypassing the debug mode. The block is checked by checkFree and by the
+// state bits of its category, failures go through the error handler.
+func (m *Manager) free(ptr unsafe.Pointer, size int) error {
+	sc, err := m.sizeClassOf(size)
+	if err != nil {
+		return err
+	}
+
+	o, err := m.checkFree(ptr, size, sc)
+	if err != nil {
+		return m.report(err)
+	}
+
+	switch sc.Category() {
+	case common.SmallSizeCategory:
+		err = m.sm.free(ptr, sc)
+	case common.MediumSizeCategory:
+		err = m.mm.free(ptr, sc)
+	default:
+		err = m.lm.free(ptr, size)
+	}
+	if err != nil {
+		return m.report(err)
+	}
+
+	m.untrackFree(ptr, size, o)
+	return nil
+}
+
+// AllocAligned returns a block of at least size bytes aligned to align, which must be
+// a power of two. Blocks of a size class are aligned to the smaller of the class size
+// and the page size, requests needing more are served by the large manager. The block
+// must be returned with FreeAligned.
+func (m *Manager) AllocAligned(size, align int) (unsafe.Pointer, error) {
+	sc, err := m.alignedClassOf(size, align)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.classAligned(sc, align) {
+		return m.Alloc(size)
+	}
+
+	ptr, err := m.lm.allocAligned(size, align)
+	if err != nil {
+		return nil, err
+	}
+
+	m.trackAlloc(ptr, size)
+	return ptr, nil
+}
+
+// FreeAligned returns a block obtained from AllocAligned, size and align must be the
+// values passed to AllocAligned.
+func (m *Manager) FreeAligned(ptr unsafe.Pointer, size, align int) error {
+	if ptr == nil {
+		return ErrInvalidPointer
+	}
+
+	sc, err := m.alignedClassOf(size, align)
+	if err != nil {
+		return err
+	}
+
+	if m.classAligned(sc, align) {
+		return m.Free(ptr, size)
+	}
+
+	if err = m.trackFree(ptr, size); err != nil {
+		return m.report(err)
+	}
+
+	o, _ := m.pageMap.lookup(uintptr(ptr))
+	if err = m.lm.free(ptr, size); err != nil {
+		return m.report(err)
+	}
+
+	m.untrackFree(ptr, size, o)
+	return nil
+}
+
+func (m *Manager) alignedClassOf(size, align int) (common.SizeClass, error) {
+	if align <= 0 || align&(align-1) != 0 {
+		return 0, ErrInvalidAlignment
+	}
+
+	return m.sizeClassOf(size)
+}
+
+// classAligned reports whether the blocks of class sc satisfy align. In debug mode they
+// are only aligned to the size of their canary, stronger alignments bypass the debug mode.
+func (m *Manager) classAligned(sc common.SizeClass, align int) bool {
+	if m.debug != nil {
+		return align <= debugCanarySize
+	}
+
+	return align <= m.naturalAlign(sc)
+}
+
+// naturalAlign returns the alignment every block of the class is guaranteed to have.
+// Small chunks, medium spans and large regions start on a page boundary and are split
+// into blocks of the power of two class size.
+func (m *Manager) naturalAlign(sc common.SizeClass) int {
+	return min(sc.Size(), m.sys.PageSize())
+}
+
+// Realloc resizes the block at ptr from oldSize to newSize bytes and returns its new
+// address. A block whose size class still fits newSize is returned unchanged, a large
+// region grows into its free neighbour or is remapped, and any other block is moved to
+// a new block of newSize bytes. A nil ptr allocates a new block.
+func (m *Manager) Realloc(ptr unsafe.Pointer, oldSize, newSize int) (unsafe.Pointer, error) {
+	if ptr == nil {
+		return m.Alloc(newSize)
+	}
+
+	from, err := m.sizeClassOf(oldSize)
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := m.sizeClassOf(newSize)
+	if err != nil {
+		return nil, err
+	}
+
+	// Debug blocks always move, so that stale pointers hit the quarantine.
+	switch {
+	case m.debug != nil:
+	case from.Category() == common.LargeSizeCategory && to.Category() == common.LargeSizeCategory:
+		if err = m.trackFree(ptr, oldSize); err != nil {
+			return nil, m.report(err)
+		}
+		o, _ := m.pageMap.lookup(uintptr(ptr))
+		moved, err := m.lm.resize(ptr, oldSize, newSize)
+		if moved != nil {
+			m.untrackFree(ptr, oldSize, o)
+			m.trackAlloc(moved, newSize)
+			return moved, nil
+		}
+		// The region is moved below and freed again, it is still in use.
+		if m.exact != nil {
+			m.exact.alloc(ptr, oldSize)
+		}
+		if err != nil {
+			return nil, err
+		}
+	case from == to:
+		if err = m.trackFree(ptr, oldSize); err != nil {
+			return nil, m.report(err)
+		}
+		o, _ := m.pageMap.lookup(uintptr(ptr))
+		m.untrackFree(ptr, oldSize, o)
+		m.trackAlloc(ptr, newSize)
+		return ptr, nil
+	}
+
+	moved, err := m.Alloc(newSize)
+	if err != nil {
+		return nil, err
+	}
+
+	copy(unsafe.Slice((*byte)(moved), min(oldSize, newSize)), unsafe.Slice((*byte)(ptr), oldSize))
+	if err = m.Free(ptr, oldSize); err != nil {
+		_ = m.Free(moved, newSize)
+		return nil, err
+	}
+
+	return moved, nil
+}
+
+// SmallShardStats returns the hit and steal counters of every small shard, keyed by size class.
+func (m *Manager) SmallShardStats() map[common.SizeClass][]ShardStats {
+	return m.sm.shardStats()
+}
+
+// MediumShardStats returns the hit and steal counters of every medium shard.
+func (m *Manager) MediumShardStats() []ShardStats {
+	return m.mm.shardStats()
+}
+
+func (m *Manager) sizeClassOf(size int) (common.SizeClass, error) {
+	if size <= 0 {
+		return 0, ErrInvalidSize
+	}
+
+	sc, ok := common.SizeClassOf(size)
+	if !ok {
+		return 0, ErrSizeTooLarge
+	}
+
+	return sc, nil
+}
+
 func (m *Manager) calculateShards(cpuCores, smCores int) int {
 	const (
 		twice           = 2
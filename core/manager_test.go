@@ -0,0 +1,190 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"testing"
+	"unsafe"
+
+	"github.com/TimeWtr/TurboAlloc/common"
+	"github.com/TimeWtr/TurboAlloc/syscall"
+	"github.com/stretchr/testify/assert"
+)
+
+// testCapacity is the size of the region reserved by the fake syscall of a test.
+const testCapacity = 64 * common.MB
+
+func newTestSyscall(t *testing.T) *syscall.FakeSyscall {
+	t.Helper()
+	sys, err := syscall.NewFakeSyscall(common.KB*4, testCapacity)
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, sys.Close())
+	})
+	return sys
+}
+
+func TestManager_AllocFreeWithFakeSyscall(t *testing.T) {
+	sys := newTestSyscall(t)
+	m, err := NewManager(0.5, 0.5, 0, WithSyscall(sys), WithShardSelector(&fixedSelector{}))
+	assert.NoError(t, err)
+
+	small, err := m.Alloc(common.B64)
+	assert.NoError(t, err)
+	medium, err := m.Alloc(common.KB * 10)
+	assert.NoError(t, err)
+	large, err := m.Alloc(common.MB)
+	assert.NoError(t, err)
+
+	// One small chunk, one medium heap arena and one large region.
+	allocs, _ := sys.Calls()
+	assert.Equal(t, 3, allocs)
+	assert.Equal(t, common.KB*4+heapArenaSize+common.MB, sys.LiveBytes())
+
+	assert.NoError(t, m.Free(small, common.B64))
+	assert.NoError(t, m.Free(medium, common.KB*10))
+	assert.NoError(t, m.Free(large, common.MB))
+}
+
+func TestManager_AllocFailure(t *testing.T) {
+	sys := newTestSyscall(t)
+	m, err := NewManager(0.5, 0.5, 0, WithSyscall(sys))
+	assert.NoError(t, err)
+
+	sys.FailAfter(0)
+	for _, size := range []int{common.B8, common.KB * 8, common.KB * 128} {
+		_, err = m.Alloc(size)
+		assert.ErrorIs(t, err, syscall.ErrInjectedFailure)
+	}
+}
+
+func TestManager_Realloc(t *testing.T) {
+	m, sys := newTestScavengeManager(t)
+
+	// A size that still fits the class keeps the block.
+	ptr, err := m.Alloc(common.B64 - 8)
+	assert.NoError(t, err)
+	same, err := m.Realloc(ptr, common.B64-8, common.B64)
+	assert.NoError(t, err)
+	assert.Equal(t, ptr, same)
+
+	// Crossing classes and categories copies the data.
+	data := make([]byte, common.B64)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	copy(unsafe.Slice((*byte)(same), common.B64), data)
+	medium, err := m.Realloc(same, common.B64, common.KB*10)
+	assert.NoError(t, err)
+	assert.Equal(t, data, unsafe.Slice((*byte)(medium), common.B64))
+	large, err := m.Realloc(medium, common.KB*10, common.MB)
+	assert.NoError(t, err)
+	assert.Equal(t, data, unsafe.Slice((*byte)(large), common.B64))
+
+	// Large regions are remapped rather than copied.
+	remapped, err := m.Realloc(large, common.MB, common.MB*3)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sys.Remaps())
+	assert.Equal(t, data, unsafe.Slice((*byte)(remapped), common.B64))
+
+	small, err := m.Realloc(remapped, common.MB*3, common.B64)
+	assert.NoError(t, err)
+	assert.Equal(t, data, unsafe.Slice((*byte)(small), common.B64))
+	assert.NoError(t, m.Free(small, common.B64))
+	assert.Zero(t, m.Stats().Categories[common.AllSizeCategory].InUseObjects)
+
+	fresh, err := m.Realloc(nil, 0, common.KB)
+	assert.NoError(t, err)
+	_, err = m.Realloc(fresh, common.KB, 0)
+	assert.ErrorIs(t, err, ErrInvalidSize)
+	assert.NoError(t, m.Free(fresh, common.KB))
+}
+
+func TestManager_AllocAligned(t *testing.T) {
+	m, _ := newTestScavengeManager(t)
+
+	// The natural alignment of the class suffices, so the block comes from the class.
+	ptr, err := m.AllocAligned(common.B512, common.B512)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), m.Stats().Categories[common.SmallSizeCategory].InUseObjects)
+	assert.NoError(t, m.FreeAligned(ptr, common.B512, common.B512))
+
+	// Stronger alignments are served by the large manager.
+	ptr, err = m.AllocAligned(common.B64, common.KB*4)
+	assert.NoError(t, err)
+	assert.Zero(t, uintptr(ptr)%(common.KB*4))
+	assert.Equal(t, int64(1), m.Stats().Categories[common.LargeSizeCategory].InUseObjects)
+	assert.NoError(t, m.FreeAligned(ptr, common.B64, common.KB*4))
+	assert.ErrorIs(t, m.FreeAligned(nil, common.B64, common.KB*4), ErrInvalidPointer)
+}
+
+func TestManager_AllocAlignedDebug(t *testing.T) {
+	m, _, violations := newTestDebugManager(t, 0)
+	tests := []struct{ size, align int }{
+		{common.B64, common.B8},
+		{common.B64, debugCanarySize},
+		{common.B64, common.B64},
+		{100, common.B64},
+		{4000, common.KB * 4},
+		{common.KB * 200, common.KB * 64},
+	}
+	for _, tt := range tests {
+		ptr, err := m.AllocAligned(tt.size, tt.align)
+		assert.NoError(t, err)
+		assert.Zero(t, uintptr(ptr)%uintptr(tt.align), "size %d align %d", tt.size, tt.align)
+		assert.NoError(t, m.FreeAligned(ptr, tt.size, tt.align))
+	}
+	assert.Empty(t, *violations)
+}
+
+func TestManager_AllocFreeBatchMedium(t *testing.T) {
+	m, _ := newTestScavengeManager(t)
+	out := make([]unsafe.Pointer, 4)
+	assert.NoError(t, m.AllocBatch(common.KB*10, out))
+	for _, ptr := range out {
+		assert.NotNil(t, ptr)
+	}
+
+	freed, err := m.FreeBatch(common.KB*10, append(out, unsafe.Add(out[0], 8)))
+	assert.ErrorIs(t, err, ErrInvalidPointer)
+	assert.Equal(t, len(out), freed)
+}
+
+func TestManager_LinuxLargePageSize(t *testing.T) {
+	sys, err := syscall.NewLinuxSyscall(common.KB * 64)
+	assert.NoError(t, err)
+	m, err := NewManager(0.5, 0.5, 0, WithSyscall(sys))
+	assert.NoError(t, err)
+	defer func() {
+		assert.NoError(t, m.Close())
+	}()
+
+	for range 20 {
+		ptr, err := m.AllocAligned(common.KB*200, common.KB*64)
+		assert.NoError(t, err)
+		assert.Zero(t, uintptr(ptr)%(common.KB*64))
+		assert.NoError(t, m.FreeAligned(ptr, common.KB*200, common.KB*64))
+	}
+
+	// Debug mode protects the guard page behind a large block.
+	dm, err := NewManager(0.5, 0.5, 0, WithSyscall(sys), WithDebug(true, 0, nil))
+	assert.NoError(t, err)
+	defer func() {
+		assert.NoError(t, dm.Close())
+	}()
+	ptr, err := dm.Alloc(common.KB * 200)
+	assert.NoError(t, err)
+	assert.NoError(t, dm.Free(ptr, common.KB*200))
+}
@@ -15,25 +15,368 @@
 package core
 
 import (
+	"fmt"
+	"sync"
 	"sync/atomic"
 	"unsafe"
+
+	"github.com/TimeWtr/TurboAlloc/common"
+	"github.com/TimeWtr/TurboAlloc/syscall"
 )
 
+// minSpanObjects is the minimum number of objects carved out of one medium span.
+const minSpanObjects = 8
+
 type MediumManager struct {
-	shards  []*MediumSizeShard
-	counter atomic.Int64
+	shards   []*MediumSizeShard
+	counter  atomic.Int64
+	selector ShardSelector
+	// heaps provide the page runs backing the spans of every shard, one heap per NUMA
+	// node keyed by node ID. Without NUMA awareness there is a single heap for node 0.
+	heaps map[int]*pageHeap
+	// spans maps every page of every heap to its span.
+	spans *spanMap
+	// localNode returns the NUMA node of the calling CPU.
+	localNode func() int
+	// zeroOnFree clears objects when they are returned.
+	zeroOnFree bool
+	// pageMap records the owner of every page of the spans handed to the shards.
+	pageMap *pageMap
+}
+
+func newMediumManager(shardCount int, selector ShardSelector, sys syscall.Syscall) *MediumManager {
+	mm := &MediumManager{
+		shards:    make([]*MediumSizeShard, max(shardCount, 1)),
+		selector:  selector,
+		spans:     newSpanMap(sys.PageSize()),
+		localNode: func() int { return 0 },
+	}
+	mm.heaps = map[int]*pageHeap{0: newPageHeap(sys, mm.spans)}
+	for i := range mm.shards {
+		mm.shards[i] = &MediumSizeShard{manager: mm, index: i}
+	}
+
+	return mm
+}
+
+// localHeap returns the page heap of the calling CPU's NUMA node.
+func (m *MediumManager) localHeap() *pageHeap {
+	if h, ok := m.heaps[m.localNode()]; ok {
+		return h
+	}
+
+	for _, h := range m.heaps {
+		return h
+	}
+
+	return nil
+}
+
+// alloc serves the allocation from a partial span of the caller's shard. When the shard
+// has no partial span of the class it steals an object from a neighbour shard, and only
+// then takes a new span from the page heap.
+func (m *MediumManager) alloc(sc common.SizeClass) (unsafe.Pointer, error) {
+	ptr, _, err := m.allocFresh(sc)
+	return ptr, err
+}
+
+// allocFresh is alloc also reporting whether the object is known to be zero.
+func (m *MediumManager) allocFresh(sc common.SizeClass) (unsafe.Pointer, bool, error) {
+	m.counter.Add(1)
+	idx := m.selector.Select(len(m.shards))
+	local := m.shards[idx]
+	if ptr, fresh := local.allocPartial(sc); ptr != nil {
+		local.hits.Add(1)
+		return ptr, fresh, nil
+	}
+
+	for i := 1; i < len(m.shards); i++ {
+		if ptr, fresh := m.shards[(idx+i)%len(m.shards)].allocPartial(sc); ptr != nil {
+			local.steals.Add(1)
+			return ptr, fresh, nil
+		}
+	}
+
+	ptr, fresh, err := local.allocSpan(sc)
+	if err != nil {
+		return nil, false, err
+	}
+
+	local.hits.Add(1)
+	return ptr, fresh, nil
+}
+
+// free returns an object to its owning span, found through the page heap's span map.
+func (m *MediumManager) free(ptr unsafe.Pointer, sc common.SizeClass) error {
+	s := m.spans.get(uintptr(ptr))
+	if s == nil || s.loadState() != spanInUse {
+		return fmt.Errorf("%w: %p was not allocated by the medium manager", ErrInvalidPointer, ptr)
+	}
+
+	return s.owner.free(s, ptr, sc)
 }
 
-func newMediumManager(shards int) *MediumManager {
-	return &MediumManager{
-		shards: make([]*MediumSizeShard, shards),
+// fragmentation returns the free and used bytes of every medium size class.
+func (m *MediumManager) fragmentation() map[common.SizeClass]Fragmentation {
+	frag := make(map[common.SizeClass]Fragmentation, common.MediumSizeClassNums)
+	for i := 0; i < common.MediumSizeClassNums; i++ {
+		sc := common.SizeClass(common.SizeClass8KB.Int() + i)
+		var f Fragmentation
+		for _, shard := range m.shards {
+			f = f.add(shard.fragmentation(sc))
+		}
+		frag[sc] = f
 	}
+
+	return frag
+}
+
+// classStats aggregates the statistics of the class over every shard.
+func (m *MediumManager) classStats(sc common.SizeClass) ClassStats {
+	st := ClassStats{Class: sc}
+	for _, shard := range m.shards {
+		st.AllocStats = st.AllocStats.add(shard.classStats(sc))
+	}
+
+	return st
+}
+
+// releaseEmpty returns the empty spans of the class held by every shard to the page heaps.
+func (m *MediumManager) releaseEmpty(sc common.SizeClass) {
+	for _, shard := range m.shards {
+		shard.releaseEmpty(sc)
+	}
+}
+
+// scavenge releases the free pages of every page heap whose free bytes exceed ratio
+// times the bytes in use, or of every heap when force is set.
+func (m *MediumManager) scavenge(ratio float64, force, lazy bool) int64 {
+	var released int64
+	for _, h := range m.heaps {
+		released += h.scavenge(ratio, force, lazy)
+	}
+
+	return released
+}
+
+func (m *MediumManager) shardStats() []ShardStats {
+	stats := make([]ShardStats, len(m.shards))
+	for i, shard := range m.shards {
+		stats[i] = ShardStats{Hits: shard.hits.Load(), Steals: shard.steals.Load()}
+	}
+
+	return stats
+}
+
+// mediumClassCounters counts the activity of one medium size class in a shard, they
+// are protected by the shard's mutex.
+type mediumClassCounters struct {
+	allocs  uint64
+	frees   uint64
+	refills uint64
+	// objects is the number of objects handed out.
+	objects int64
+	// spanBytes is the size of the spans of the class owned by the shard.
+	spanBytes int64
 }
 
 type MediumSizeShard struct {
-	freeList  atomic.Pointer[block]
-	freeCount atomic.Uint32
+	// mu protects the partial lists and every span owned by the shard.
+	mu sync.Mutex
+	// partial holds, per medium size class, the spans owned by the shard that still have
+	// free objects.
+	partial [common.MediumSizeClassNums]*span
+	// manager is the medium manager owning the shard.
+	manager *MediumManager
+	// index is the position of the shard in the manager.
+	index int
+	// spanCount is the number of spans currently owned by the shard.
+	spanCount atomic.Int64
+	// classes holds the counters of every medium size class.
+	classes [common.MediumSizeClassNums]mediumClassCounters
+
+	hits   atomic.Uint64
+	steals atomic.Uint64
+}
+
+func mediumIndex(sc common.SizeClass) int {
+	return sc.Int() - common.SizeClass8KB.Int()
+}
+
+// allocPartial allocates an object from a partial span of the class, it returns nil
+// when the shard has none.
+func (m *MediumSizeShard) allocPartial(sc common.SizeClass) (unsafe.Pointer, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	pages      []unsafe.Pointer
-	pagesCount atomic.Uint32
+	s := m.partial[mediumIndex(sc)]
+	if s == nil {
+		return nil, false
+	}
+
+	return m.allocFrom(s)
+}
+
+// allocSpan takes a new span for the class from the page heap and allocates from it.
+func (m *MediumSizeShard) allocSpan(sc common.SizeClass) (unsafe.Pointer, bool, error) {
+	objSize := sc.Size()
+	heap := m.manager.localHeap()
+	npages := max(objSize*minSpanObjects/heap.pageSize, 1)
+	s, err := heap.allocSpan(npages)
+	if err != nil {
+		return nil, false, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s.sizeClass = sc
+	s.objSize = uintptr(objSize)
+	s.nelems = npages * heap.pageSize / objSize
+	s.allocBits = make([]uint64, (s.nelems+63)/64)
+	s.owner = m
+	s.state.Store(uint32(spanInUse))
+	m.manager.pageMap.set(s.base, int(s.size()), Owner{
+		Class:    sc,
+		Category: common.MediumSizeCategory,
+		Shard:    m.index,
+	})
+	m.spanCount.Add(1)
+	c := &m.classes[mediumIndex(sc)]
+	c.refills++
+	c.spanBytes += int64(s.size())
+	m.pushPartial(s)
+	ptr, fresh := m.allocFrom(s)
+	return ptr, fresh, nil
+}
+
+func (m *MediumSizeShard) allocFrom(s *span) (unsafe.Pointer, bool) {
+	ptr, fresh := s.allocObject()
+	c := &m.classes[mediumIndex(s.sizeClass)]
+	c.allocs++
+	c.objects++
+	if s.full() {
+		m.removePartial(s)
+	}
+
+	return ptr, fresh
+}
+
+// free returns an object to span s. A span that becomes empty goes back to the page
+// heap, unless it is the only partial span of its class, which is kept to avoid
+// bouncing a span between the shard and the heap on alternating alloc/free.
+func (m *MediumSizeShard) free(s *span, ptr unsafe.Pointer, sc common.SizeClass) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s.loadState() != spanInUse || s.sizeClass != sc || (uintptr(ptr)-s.base)%s.objSize != 0 {
+		return fmt.Errorf("%w: %p is not a %s object", ErrInvalidPointer, ptr, sc)
+	}
+
+	if !s.allocated(uintptr(ptr)) {
+		return fmt.Errorf("%w: %p", ErrDoubleFree, ptr)
+	}
+
+	if m.manager.zeroOnFree {
+		clear(unsafe.Slice((*byte)(ptr), s.objSize))
+	}
+
+	wasFull := s.full()
+	s.freeObject(ptr)
+	c := &m.classes[mediumIndex(sc)]
+	c.frees++
+	c.objects--
+	if wasFull {
+		m.pushPartial(s)
+	}
+
+	if s.allocCount == 0 && (s.prev != nil || s.next != nil) {
+		m.releaseSpan(s)
+	}
+
+	return nil
+}
+
+// fragmentation returns the free bytes left in the partial spans of the class and the
+// bytes handed out.
+func (m *MediumSizeShard) fragmentation(sc common.SizeClass) Fragmentation {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f := Fragmentation{UsedBytes: m.classes[mediumIndex(sc)].objects * int64(sc.Size())}
+	for s := m.partial[mediumIndex(sc)]; s != nil; s = s.next {
+		f.FreeBytes += int64(s.nelems-s.allocCount) * int64(s.objSize)
+	}
+
+	return f
+}
+
+// releaseEmpty returns the empty partial spans of the class to their page heap,
+// including the one free kept back to avoid bouncing.
+func (m *MediumSizeShard) releaseEmpty(sc common.SizeClass) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for s := m.partial[mediumIndex(sc)]; s != nil; {
+		next := s.next
+		if s.allocCount == 0 {
+			m.releaseSpan(s)
+		}
+		s = next
+	}
+}
+
+// releaseSpan removes an empty span from the partial list and returns it to its heap.
+func (m *MediumSizeShard) releaseSpan(s *span) {
+	m.removePartial(s)
+	m.spanCount.Add(-1)
+	m.classes[mediumIndex(s.sizeClass)].spanBytes -= int64(s.size())
+	m.manager.pageMap.clear(s.base, int(s.size()))
+	s.heap.freeSpan(s)
+}
+
+// classStats returns the shard's share of the class statistics.
+func (m *MediumSizeShard) classStats(sc common.SizeClass) AllocStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c := m.classes[mediumIndex(sc)]
+	st := AllocStats{
+		InUseObjects: c.objects,
+		InUseBytes:   c.objects * int64(sc.Size()),
+		Allocs:       c.allocs,
+		Frees:        c.frees,
+		Refills:      c.refills,
+		MappedBytes:  c.spanBytes,
+	}
+	for s := m.partial[mediumIndex(sc)]; s != nil; s = s.next {
+		st.CachedObjects += int64(s.nelems - s.allocCount)
+	}
+	st.CachedBytes = st.CachedObjects * int64(sc.Size())
+
+	return st
+}
+
+func (m *MediumSizeShard) pushPartial(s *span) {
+	head := &m.partial[mediumIndex(s.sizeClass)]
+	s.prev = nil
+	s.next = *head
+	if *head != nil {
+		(*head).prev = s
+	}
+	*head = s
+}
+
+func (m *MediumSizeShard) removePartial(s *span) {
+	head := &m.partial[mediumIndex(s.sizeClass)]
+	if s.prev != nil {
+		s.prev.next = s.next
+	} else {
+		*head = s.next
+	}
+
+	if s.next != nil {
+		s.next.prev = s.prev
+	}
+	s.prev, s.next = nil, nil
 }
@@ -0,0 +1,184 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"sync"
+	"testing"
+	"unsafe"
+
+	"github.com/TimeWtr/TurboAlloc/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestPageHeap(t *testing.T) *pageHeap {
+	t.Helper()
+	sys := newTestSyscall(t)
+	return newPageHeap(sys, newSpanMap(sys.PageSize()))
+}
+
+func TestPageHeap_SplitAndCoalesce(t *testing.T) {
+	h := newTestPageHeap(t)
+	a, err := h.allocSpan(4)
+	assert.NoError(t, err)
+	b, err := h.allocSpan(8)
+	assert.NoError(t, err)
+	assert.Equal(t, a.end(), b.base)
+	assert.Equal(t, int64(heapArenaSize), h.mapped)
+	assert.Len(t, h.free, 1)
+
+	h.freeSpan(a)
+	assert.Len(t, h.free, 2)
+
+	// Freeing b merges it with a on the left and the arena remainder on the right.
+	h.freeSpan(b)
+	assert.Len(t, h.free, 1)
+	assert.Equal(t, heapArenaSize/h.pageSize, h.free[0].npages)
+	assert.Equal(t, a.base, h.free[0].base)
+}
+
+func TestPageHeap_BestFit(t *testing.T) {
+	h := newTestPageHeap(t)
+	spans := make([]*span, 0, 5)
+	for _, n := range []int{2, 1, 6, 1, 3} {
+		s, err := h.allocSpan(n)
+		assert.NoError(t, err)
+		spans = append(spans, s)
+	}
+	base2, base6 := spans[0].base, spans[2].base
+	h.freeSpan(spans[0])
+	h.freeSpan(spans[2])
+
+	s, err := h.allocSpan(2)
+	assert.NoError(t, err)
+	assert.Equal(t, base2, s.base)
+
+	s, err = h.allocSpan(5)
+	assert.NoError(t, err)
+	assert.Equal(t, base6, s.base)
+}
+
+func TestMediumManager_AllocFreeAllClasses(t *testing.T) {
+	mm := newMediumManager(1, &fixedSelector{}, newTestSyscall(t))
+	for sc := common.SizeClass8KB; sc <= common.SizeClass64KB; sc++ {
+		spans := mm.shards[0].spanCount.Load()
+		ptrs := make([]unsafe.Pointer, 0, minSpanObjects*2)
+		for i := 0; i < minSpanObjects*2; i++ {
+			ptr, err := mm.alloc(sc)
+			assert.NoError(t, err)
+			data := unsafe.Slice((*byte)(ptr), sc.Size())
+			data[0], data[len(data)-1] = byte(i), byte(i)
+			ptrs = append(ptrs, ptr)
+		}
+		assert.Equal(t, spans+2, mm.shards[0].spanCount.Load())
+
+		for i, ptr := range ptrs {
+			data := unsafe.Slice((*byte)(ptr), sc.Size())
+			assert.Equal(t, byte(i), data[0])
+			assert.Equal(t, byte(i), data[len(data)-1])
+			assert.NoError(t, mm.free(ptr, sc))
+		}
+		// One empty span is retained as the partial span of the class.
+		assert.Equal(t, spans+1, mm.shards[0].spanCount.Load())
+	}
+}
+
+func TestMediumManager_FreeForeignPointer(t *testing.T) {
+	mm := newMediumManager(1, &fixedSelector{}, newTestSyscall(t))
+	var v [common.KB * 8]byte
+	assert.ErrorIs(t, mm.free(unsafe.Pointer(&v), common.SizeClass8KB), ErrInvalidPointer)
+
+	ptr, err := mm.alloc(common.SizeClass8KB)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, mm.free(ptr, common.SizeClass16KB), ErrInvalidPointer)
+	assert.NoError(t, mm.free(ptr, common.SizeClass8KB))
+}
+
+func TestMediumManager_StealsFromNeighbour(t *testing.T) {
+	sel := &fixedSelector{}
+	mm := newMediumManager(2, sel, newTestSyscall(t))
+	ptr, err := mm.alloc(common.SizeClass16KB)
+	assert.NoError(t, err)
+
+	sel.idx = 1
+	stolen, err := mm.alloc(common.SizeClass16KB)
+	assert.NoError(t, err)
+	assert.NotEqual(t, ptr, stolen)
+	assert.Equal(t, []ShardStats{{Hits: 1}, {Steals: 1}}, mm.shardStats())
+	assert.Equal(t, int64(0), mm.shards[1].spanCount.Load())
+
+	// The stolen object belongs to shard 0's span and is returned there.
+	assert.NoError(t, mm.free(stolen, common.SizeClass16KB))
+	assert.NoError(t, mm.free(ptr, common.SizeClass16KB))
+}
+
+func TestMediumManager_Concurrent(t *testing.T) {
+	mm := newMediumManager(4, NewRoundRobinSelector(), newTestSyscall(t))
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(id byte) {
+			defer wg.Done()
+			sc := common.SizeClass8KB + common.SizeClass(id%4)
+			for i := 0; i < 200; i++ {
+				ptr, err := mm.alloc(sc)
+				if !assert.NoError(t, err) {
+					return
+				}
+				data := unsafe.Slice((*byte)(ptr), sc.Size())
+				data[0], data[len(data)-1] = id, id
+				assert.Equal(t, id, data[0])
+				assert.Equal(t, id, data[len(data)-1])
+				assert.NoError(t, mm.free(ptr, sc))
+			}
+		}(byte(g))
+	}
+	wg.Wait()
+}
+
+func TestMediumManager_LookupsRaceSpanRelease(t *testing.T) {
+	m, _ := newTestScavengeManager(t)
+	n := minSpanObjects * 3
+	ptrs := make([]unsafe.Pointer, n)
+	stale := make(chan unsafe.Pointer, n)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for p := range stale {
+			// Spans found through stale pointers may be freed or reused concurrently.
+			_, _ = m.SizeOf(p)
+			assert.Error(t, m.mm.free(p, common.SizeClass32KB))
+		}
+	}()
+
+	for range 20 {
+		for i := range ptrs {
+			ptr, err := m.Alloc(common.KB * 8)
+			assert.NoError(t, err)
+			ptrs[i] = ptr
+		}
+		for _, ptr := range ptrs {
+			assert.NoError(t, m.Free(ptr, common.KB*8))
+			select {
+			case stale <- ptr:
+			default:
+			}
+		}
+	}
+	close(stale)
+	wg.Wait()
+}
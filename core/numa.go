@@ -0,0 +1,363 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/TimeWtr/TurboAlloc/numa"
+	"github.com/TimeWtr/TurboAlloc/syscall"
+)
+
+// ErrNodeExhausted is returned when no NUMA node allowed by the policy can take an allocation.
+var ErrNodeExhausted = errors.New("numa node exhausted")
+
+// NUMAPolicy decides what happens when the node of the calling CPU can not take an
+// allocation, either because its capacity is used up or because binding fails.
+type NUMAPolicy int
+
+const (
+	// NUMAFallbackNearest retries on the other nodes, nearest first.
+	NUMAFallbackNearest NUMAPolicy = iota
+	// NUMAStrict fails the allocation with ErrNodeExhausted.
+	NUMAStrict
+)
+
+// WithNUMA makes the managers place memory on the NUMA node of the calling CPU.
+// Every node gets its own medium page heap, small refills and large regions are bound
+// to the node of the CPU mapping them. It has no effect when the configured Syscall
+// does not implement syscall.NUMASyscall.
+func WithNUMA(topo *numa.Topology, policy NUMAPolicy) Option {
+	return func(m *Manager) {
+		m.topology = topo
+		m.numaPolicy = policy
+	}
+}
+
+// nodeArena accounts the bytes mapped on one NUMA node.
+type nodeArena struct {
+	id int
+	// capacity is the memory of the node, zero means unlimited.
+	capacity int64
+	mapped   atomic.Int64
+}
+
+// reserve adds size bytes to the mapped bytes unless that exceeds the capacity.
+func (a *nodeArena) reserve(size int64) bool {
+	for {
+		mapped := a.mapped.Load()
+		if a.capacity > 0 && mapped+size > a.capacity {
+			return false
+		}
+		if a.mapped.CompareAndSwap(mapped, mapped+size) {
+			return true
+		}
+	}
+}
+
+// nodeRange is a mapped address range and the node mapOn bound it to.
+type nodeRange struct {
+	start, end uintptr
+	node       int
+}
+
+// numaRouter is a Syscall that binds every mapping to the NUMA node of the calling
+// CPU, applying the fallback policy when that node is exhausted.
+type numaRouter struct {
+	sys    syscall.NUMASyscall
+	topo   *numa.Topology
+	policy NUMAPolicy
+	arenas map[int]*nodeArena
+	// cpu returns the CPU of the calling thread.
+	cpu func() (int, error)
+	mu  sync.Mutex
+	// ranges holds the mapped ranges sorted by address. Unmapped bytes are charged to
+	// the node recorded here, the kernel may have placed the pages elsewhere, and a
+	// free may span ranges of several nodes once large regions coalesce.
+	ranges []nodeRange
+}
+
+func newNUMARouter(sys syscall.NUMASyscall, topo *numa.Topology, policy NUMAPolicy) *numaRouter {
+	r := &numaRouter{
+		sys:    sys,
+		topo:   topo,
+		policy: policy,
+		arenas: make(map[int]*nodeArena, len(topo.Nodes)),
+		cpu:    numa.CurrentCPU,
+	}
+	for _, n := range topo.Nodes {
+		r.arenas[n.ID] = &nodeArena{id: n.ID, capacity: n.Capacity}
+	}
+
+	return r
+}
+
+// localNode returns the node of the calling CPU.
+func (r *numaRouter) localNode() int {
+	cpu, err := r.cpu()
+	if err != nil {
+		return r.topo.Nodes[0].ID
+	}
+
+	return r.topo.NodeOfCPU(cpu)
+}
+
+// candidates returns the nodes an allocation preferring node may be placed on.
+func (r *numaRouter) candidates(node int) []int {
+	if r.policy == NUMAStrict {
+		return []int{node}
+	}
+
+	return append([]int{node}, r.topo.FallbackOrder(node)...)
+}
+
+// mapOn maps size bytes with mapFn on node or, depending on the policy, on a fallback
+// node. The bytes are reserved on a node before mapping, so that concurrent mappings
+// can not exceed its capacity.
+func (r *numaRouter) mapOn(node, size int, mapFn func() (unsafe.Pointer, error)) (unsafe.Pointer, error) {
+	var err error
+	for _, id := range r.candidates(node) {
+		a := r.arenas[id]
+		if !a.reserve(int64(size)) {
+			continue
+		}
+
+		var ptr unsafe.Pointer
+		if ptr, err = mapFn(); err == nil {
+			if err = r.sys.BindNode(ptr, size, id); err != nil {
+				_ = r.sys.FreePages(ptr, size)
+			}
+		}
+		if err != nil {
+			a.mapped.Add(-int64(size))
+			continue
+		}
+
+		r.mu.Lock()
+		r.trackLocked(uintptr(ptr), size, id)
+		r.mu.Unlock()
+		return ptr, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: node %d, %d bytes: %w", ErrNodeExhausted, node, size, err)
+	}
+
+	return nil, fmt.Errorf("%w: node %d, %d bytes", ErrNodeExhausted, node, size)
+}
+
+func (r *numaRouter) allocOn(node, size int) (unsafe.Pointer, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid alloc size: %d", size)
+	}
+
+	size = syscall.AlignUp(size, r.sys.PageSize())
+	return r.mapOn(node, size, func() (unsafe.Pointer, error) {
+		return r.sys.AllocPages(size)
+	})
+}
+
+func (r *numaRouter) allocHugeOn(node, size int, hugeTLB bool) (unsafe.Pointer, syscall.HugePageKind, error) {
+	huge, ok := r.sys.(syscall.HugePageSyscall)
+	if !ok {
+		return nil, syscall.HugePageNone, errors.New("huge pages are not supported")
+	}
+
+	var kind syscall.HugePageKind
+	size = syscall.AlignUp(size, syscall.HugePageSize)
+	ptr, err := r.mapOn(node, size, func() (unsafe.Pointer, error) {
+		ptr, k, err := huge.AllocHugePages(size, hugeTLB)
+		kind = k
+		return ptr, err
+	})
+
+	return ptr, kind, err
+}
+
+func (r *numaRouter) AllocPages(size int) (unsafe.Pointer, error) {
+	return r.allocOn(r.localNode(), size)
+}
+
+func (r *numaRouter) FreePages(ptr unsafe.Pointer, size int) error {
+	size = syscall.AlignUp(size, r.sys.PageSize())
+	if err := r.sys.FreePages(ptr, size); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.untrackLocked(uintptr(ptr), size)
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *numaRouter) SetProtection(ptr unsafe.Pointer, prot int) error {
+	return r.sys.SetProtection(ptr, prot)
+}
+
+// RemapPages resizes a mapping when the wrapped Syscall supports it, the pages keep the
+// memory policy of their node.
+func (r *numaRouter) RemapPages(ptr unsafe.Pointer, oldSize, newSize int) (unsafe.Pointer, error) {
+	remap, ok := r.sys.(syscall.RemapSyscall)
+	if !ok {
+		return nil, errors.New("remapping is not supported")
+	}
+
+	moved, err := remap.RemapPages(ptr, oldSize, newSize)
+	if err != nil {
+		return nil, err
+	}
+
+	pageSize := r.sys.PageSize()
+	r.mu.Lock()
+	if node, ok := r.untrackLocked(uintptr(ptr), syscall.AlignUp(oldSize, pageSize)); ok {
+		r.trackLocked(uintptr(moved), syscall.AlignUp(newSize, pageSize), node)
+		r.arenas[node].mapped.Add(int64(syscall.AlignUp(newSize, pageSize)))
+	}
+	r.mu.Unlock()
+	return moved, nil
+}
+
+// trackLocked records size bytes at start as bound to node, the bytes are added to the
+// node's mapped bytes by the caller.
+func (r *numaRouter) trackLocked(start uintptr, size, node int) {
+	i := sort.Search(len(r.ranges), func(i int) bool {
+		return r.ranges[i].start > start
+	})
+	r.ranges = slices.Insert(r.ranges, i, nodeRange{start: start, end: start + uintptr(size), node: node})
+}
+
+// untrackLocked removes size bytes at start from the ranges, charging every overlapped
+// range to its node, and returns the node of the first one.
+func (r *numaRouter) untrackLocked(start uintptr, size int) (node int, ok bool) {
+	end := start + uintptr(size)
+	i := sort.Search(len(r.ranges), func(i int) bool {
+		return r.ranges[i].end > start
+	})
+
+	var kept []nodeRange
+	j := i
+	for ; j < len(r.ranges) && r.ranges[j].start < end; j++ {
+		rg := r.ranges[j]
+		if !ok {
+			node, ok = rg.node, true
+		}
+		r.arenas[rg.node].mapped.Add(-int64(min(rg.end, end) - max(rg.start, start)))
+		if rg.start < start {
+			kept = append(kept, nodeRange{start: rg.start, end: start, node: rg.node})
+		}
+		if rg.end > end {
+			kept = append(kept, nodeRange{start: end, end: rg.end, node: rg.node})
+		}
+	}
+
+	r.ranges = slices.Replace(r.ranges, i, j, kept...)
+	return node, ok
+}
+
+func (r *numaRouter) ReleasePages(ptr unsafe.Pointer, size int, lazy bool) error {
+	return r.sys.ReleasePages(ptr, size, lazy)
+}
+
+func (r *numaRouter) PageSize() int {
+	return r.sys.PageSize()
+}
+
+func (r *numaRouter) AllocHugePages(size int, hugeTLB bool) (unsafe.Pointer, syscall.HugePageKind, error) {
+	return r.allocHugeOn(r.localNode(), size, hugeTLB)
+}
+
+func (r *numaRouter) HugePageBytes(regions []syscall.Region) (int, error) {
+	huge, ok := r.sys.(syscall.HugePageSyscall)
+	if !ok {
+		return 0, nil
+	}
+
+	return huge.HugePageBytes(regions)
+}
+
+// node returns a Syscall mapping on a fixed node, used by the per-node page heaps.
+func (r *numaRouter) node(id int) *nodeSyscall {
+	return &nodeSyscall{numaRouter: r, id: id}
+}
+
+// nodeSyscall is a view of numaRouter that prefers a fixed node instead of the node of
+// the calling CPU.
+type nodeSyscall struct {
+	*numaRouter
+	id int
+}
+
+func (n *nodeSyscall) AllocPages(size int) (unsafe.Pointer, error) {
+	return n.allocOn(n.id, size)
+}
+
+func (n *nodeSyscall) AllocHugePages(size int, hugeTLB bool) (unsafe.Pointer, syscall.HugePageKind, error) {
+	return n.allocHugeOn(n.id, size, hugeTLB)
+}
+
+// NodeStats reports the memory mapped on a NUMA node.
+type NodeStats struct {
+	ID       int
+	Mapped   int64
+	Capacity int64
+}
+
+// enableNUMA routes the managers' mappings through a numaRouter and gives every node its
+// own medium page heap.
+func (m *Manager) enableNUMA() {
+	sys, ok := m.sys.(syscall.NUMASyscall)
+	if m.topology == nil || !ok {
+		return
+	}
+
+	m.router = newNUMARouter(sys, m.topology, m.numaPolicy)
+	m.sys = m.router
+}
+
+// splitMediumHeaps replaces the single medium page heap with one heap per node.
+func (m *Manager) splitMediumHeaps() {
+	if m.router == nil {
+		return
+	}
+
+	heaps := make(map[int]*pageHeap, len(m.topology.Nodes))
+	for _, n := range m.topology.Nodes {
+		heaps[n.ID] = newPageHeap(m.router.node(n.ID), m.mm.spans)
+	}
+	m.mm.heaps = heaps
+	m.mm.localNode = m.router.localNode
+}
+
+// NodeStats returns the bytes mapped on every NUMA node, it is empty unless NUMA
+// awareness is enabled.
+func (m *Manager) NodeStats() []NodeStats {
+	if m.router == nil {
+		return nil
+	}
+
+	stats := make([]NodeStats, 0, len(m.topology.Nodes))
+	for _, n := range m.topology.Nodes {
+		a := m.router.arenas[n.ID]
+		stats = append(stats, NodeStats{ID: n.ID, Mapped: a.mapped.Load(), Capacity: a.capacity})
+	}
+
+	return stats
+}
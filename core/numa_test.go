@@ -0,0 +1,246 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"unsafe"
+
+	"github.com/TimeWtr/TurboAlloc/common"
+	"github.com/TimeWtr/TurboAlloc/numa"
+	"github.com/TimeWtr/TurboAlloc/syscall"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestTopology(t *testing.T, capacity int64) *numa.Topology {
+	t.Helper()
+	topo, err := numa.NewTopology([]numa.Node{
+		{ID: 0, CPUs: []int{0, 1}, Distances: []int{10, 21}, Capacity: capacity},
+		{ID: 1, CPUs: []int{2, 3}, Distances: []int{21, 10}},
+	})
+	assert.NoError(t, err)
+	return topo
+}
+
+func newTestNUMAManager(t *testing.T, capacity int64, policy NUMAPolicy) (*Manager, *int) {
+	t.Helper()
+	m, err := NewManager(0.5, 0.5, 0,
+		WithSyscall(newTestSyscall(t)),
+		WithShardSelector(&fixedSelector{}),
+		WithNUMA(newTestTopology(t, capacity), policy))
+	assert.NoError(t, err)
+
+	cpu := new(int)
+	m.router.cpu = func() (int, error) {
+		return *cpu, nil
+	}
+	return m, cpu
+}
+
+func TestManager_NUMARoutesToLocalNode(t *testing.T) {
+	m, cpu := newTestNUMAManager(t, 0, NUMAFallbackNearest)
+	assert.Len(t, m.mm.heaps, 2)
+
+	for _, tc := range []struct {
+		cpu   int
+		node  int
+		sizes []int
+	}{
+		{cpu: 0, node: 0, sizes: []int{common.KB * 16, common.MB}},
+		// Partial spans are cached per shard, a fresh size class makes the medium
+		// manager carve a new span from the local heap.
+		{cpu: 3, node: 1, sizes: []int{common.KB * 32, common.MB}},
+	} {
+		*cpu = tc.cpu
+		for _, size := range tc.sizes {
+			ptr, err := m.Alloc(size)
+			assert.NoError(t, err)
+			node, err := m.router.sys.NodeOf(ptr)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.node, node, "cpu %d size %d", tc.cpu, size)
+		}
+	}
+
+	stats := m.NodeStats()
+	assert.Len(t, stats, 2)
+	for _, s := range stats {
+		assert.Positive(t, s.Mapped)
+	}
+}
+
+func TestManager_NUMAFallback(t *testing.T) {
+	m, _ := newTestNUMAManager(t, common.MB, NUMAFallbackNearest)
+
+	first, err := m.Alloc(common.MB)
+	assert.NoError(t, err)
+	second, err := m.Alloc(common.MB)
+	assert.NoError(t, err)
+
+	node, err := m.router.sys.NodeOf(first)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, node)
+	node, err = m.router.sys.NodeOf(second)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, node)
+
+	m.lm.maxRetained = 0
+	assert.NoError(t, m.Free(first, common.MB))
+	assert.Equal(t, int64(0), m.NodeStats()[0].Mapped)
+}
+
+// preferredSyscall places every page on node 0 whatever node it is bound to, like
+// MPOL_PREFERRED falling back when the preferred node is full.
+type preferredSyscall struct {
+	*syscall.FakeSyscall
+}
+
+func (p *preferredSyscall) BindNode(ptr unsafe.Pointer, size, _ int) error {
+	return p.FakeSyscall.BindNode(ptr, size, 0)
+}
+
+func TestManager_NUMAAccountsBoundNode(t *testing.T) {
+	m, err := NewManager(0.5, 0.5, 0,
+		WithSyscall(&preferredSyscall{newTestSyscall(t)}),
+		WithShardSelector(&fixedSelector{}),
+		WithNUMA(newTestTopology(t, 0), NUMAFallbackNearest))
+	assert.NoError(t, err)
+	cpu := 2
+	m.router.cpu = func() (int, error) {
+		return cpu, nil
+	}
+
+	// The regions are charged to the node they were bound to, even though the pages
+	// were placed on node 0, and coalesce into one free region spanning both nodes.
+	m.lm.maxRetained = common.MB * 8
+	first, err := m.Alloc(common.MB)
+	assert.NoError(t, err)
+	cpu = 0
+	second, err := m.Alloc(common.MB)
+	assert.NoError(t, err)
+	assert.Equal(t, unsafe.Add(first, common.MB), second)
+	before := m.NodeStats()
+	assert.Equal(t, int64(common.MB), before[0].Mapped)
+	assert.Equal(t, int64(common.MB), before[1].Mapped)
+
+	assert.NoError(t, m.Free(first, common.MB))
+	assert.NoError(t, m.Free(second, common.MB))
+	m.lm.maxRetained = 0
+	third, err := m.Alloc(common.MB * 4)
+	assert.NoError(t, err)
+	assert.NoError(t, m.Free(third, common.MB*4))
+
+	for _, s := range m.NodeStats() {
+		assert.Zero(t, s.Mapped, "node %d", s.ID)
+	}
+}
+
+func TestManager_NUMAHugePageArenas(t *testing.T) {
+	m, err := NewManager(0.5, 0.5, 0,
+		WithSyscall(newTestSyscall(t)),
+		WithShardSelector(&fixedSelector{}),
+		WithHugePage(true),
+		WithNUMA(newTestTopology(t, 0), NUMAFallbackNearest))
+	assert.NoError(t, err)
+	m.router.cpu = func() (int, error) {
+		return 0, nil
+	}
+
+	// The arena of node 1 is mapped on node 1 whatever CPU grows the heap.
+	assert.NoError(t, m.mm.heaps[1].grow(1))
+	stats := m.NodeStats()
+	assert.Zero(t, stats[0].Mapped)
+	assert.Equal(t, int64(heapArenaSize), stats[1].Mapped)
+	assert.Len(t, m.mm.heaps[1].transparent, 1)
+}
+
+// failOnceSyscall fails the first AllocPages call.
+type failOnceSyscall struct {
+	*syscall.FakeSyscall
+	failed bool
+}
+
+func (f *failOnceSyscall) AllocPages(size int) (unsafe.Pointer, error) {
+	if !f.failed {
+		f.failed = true
+		return nil, syscall.ErrInjectedFailure
+	}
+	return f.FakeSyscall.AllocPages(size)
+}
+
+func TestNUMARouter_MapFailureFallsBack(t *testing.T) {
+	r := newNUMARouter(&failOnceSyscall{FakeSyscall: newTestSyscall(t)}, newTestTopology(t, 0), NUMAFallbackNearest)
+	r.cpu = func() (int, error) {
+		return 0, nil
+	}
+
+	ptr, err := r.AllocPages(common.MB)
+	assert.NoError(t, err)
+	assert.Zero(t, r.arenas[0].mapped.Load())
+	assert.Equal(t, int64(common.MB), r.arenas[1].mapped.Load())
+	assert.NoError(t, r.FreePages(ptr, common.MB))
+
+	r = newNUMARouter(&failOnceSyscall{FakeSyscall: newTestSyscall(t)}, newTestTopology(t, 0), NUMAStrict)
+	r.cpu = func() (int, error) {
+		return 0, nil
+	}
+	_, err = r.AllocPages(common.MB)
+	assert.ErrorIs(t, err, ErrNodeExhausted)
+	assert.ErrorIs(t, err, syscall.ErrInjectedFailure)
+	assert.Zero(t, r.arenas[0].mapped.Load())
+}
+
+func TestNUMARouter_ConcurrentCapacity(t *testing.T) {
+	const n = 4
+	r := newNUMARouter(newTestSyscall(t), newTestTopology(t, common.MB*n), NUMAStrict)
+	r.cpu = func() (int, error) {
+		return 0, nil
+	}
+
+	var (
+		wg     sync.WaitGroup
+		mapped atomic.Int64
+	)
+	for range n * 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := r.AllocPages(common.MB); err == nil {
+				mapped.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int64(n), mapped.Load())
+	assert.Equal(t, int64(common.MB*n), r.arenas[0].mapped.Load())
+}
+
+func TestManager_NUMAStrict(t *testing.T) {
+	m, _ := newTestNUMAManager(t, common.MB, NUMAStrict)
+
+	_, err := m.Alloc(common.MB)
+	assert.NoError(t, err)
+	_, err = m.Alloc(common.MB)
+	assert.ErrorIs(t, err, ErrNodeExhausted)
+}
+
+func TestManager_NUMAWithoutTopology(t *testing.T) {
+	m, err := NewManager(0.5, 0.5, 0, WithSyscall(newTestSyscall(t)))
+	assert.NoError(t, err)
+	assert.Nil(t, m.NodeStats())
+	assert.Len(t, m.mm.heaps, 1)
+}
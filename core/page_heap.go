@@ -0,0 +1,355 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/TimeWtr/TurboAlloc/common"
+	"github.com/TimeWtr/TurboAlloc/syscall"
+)
+
+// heapArenaSize is the minimum number of bytes the page heap maps when it runs out of
+// free pages.
+const heapArenaSize = 4 * common.MB
+
+type spanState uint8
+
+const (
+	spanFree spanState = iota
+	// spanClaimed is a span taken from the heap whose objects are being set up.
+	spanClaimed
+	spanInUse
+)
+
+// span is a run of contiguous pages. A span in use is split into objects of one size
+// class, a free span is owned by the page heap and waits to be reused or coalesced.
+// Lookups through the span map may race with the owner freeing the span, so state is
+// atomic and the class fields are only written before the span is marked in use. A
+// freed span is replaced by a new free span rather than rewritten.
+type span struct {
+	base     uintptr
+	npages   int
+	pageSize int
+	state    atomic.Uint32
+	// released is set on free spans whose pages are not backed by physical memory,
+	// either because they were never touched or because the scavenger released them.
+	released bool
+	// zeroed is set on spans whose pages read as zero, it is kept while the span is in
+	// use so that objects never handed out are known to be zero.
+	zeroed bool
+
+	sizeClass common.SizeClass
+	objSize   uintptr
+	nelems    int
+	// allocCount is the number of objects currently handed out.
+	allocCount int
+	// freeIndex is the index of the first object that has never been handed out, objects
+	// below it are either in use or on freeList.
+	freeIndex int
+	// freeList links the objects that were returned to the span.
+	freeList uintptr
+	// allocBits has one bit per object, set while the object is handed out.
+	allocBits []uint64
+	// owner is the shard whose partial list holds the span.
+	owner *MediumSizeShard
+	// heap is the page heap the span's pages belong to.
+	heap *pageHeap
+	// prev and next link the span in its owner's partial list.
+	prev, next *span
+}
+
+func (s *span) size() uintptr {
+	return uintptr(s.npages * s.pageSize)
+}
+
+func (s *span) end() uintptr {
+	return s.base + s.size()
+}
+
+func (s *span) full() bool {
+	return s.allocCount == s.nelems
+}
+
+// allocObject hands out an object, preferring recycled ones, and reports whether the
+// object is known to be zero. It must only be called on spans that are not full.
+func (s *span) allocObject() (unsafe.Pointer, bool) {
+	s.allocCount++
+	if s.freeList != 0 {
+		addr := s.freeList
+		s.freeList = blockAt(addr).next
+		s.setAllocated(addr, true)
+		return addrToPtr(addr), false
+	}
+
+	addr := s.base + uintptr(s.freeIndex)*s.objSize
+	s.freeIndex++
+	s.setAllocated(addr, true)
+	return addrToPtr(addr), s.zeroed
+}
+
+// allocated reports whether the object at addr is handed out.
+func (s *span) allocated(addr uintptr) bool {
+	i := (addr - s.base) / s.objSize
+	return s.allocBits[i/64]&(1<<(i%64)) != 0
+}
+
+func (s *span) setAllocated(addr uintptr, allocated bool) {
+	i := (addr - s.base) / s.objSize
+	if allocated {
+		s.allocBits[i/64] |= 1 << (i % 64)
+	} else {
+		s.allocBits[i/64] &^= 1 << (i % 64)
+	}
+}
+
+func (s *span) freeObject(ptr unsafe.Pointer) {
+	s.setAllocated(uintptr(ptr), false)
+	s.allocCount--
+	blockAt(uintptr(ptr)).next = s.freeList
+	s.freeList = uintptr(ptr)
+}
+
+// spanMap maps the page number of every page handed out by the page heap to its span.
+type spanMap struct {
+	mu       sync.RWMutex
+	spans    map[uintptr]*span
+	pageSize uintptr
+}
+
+func newSpanMap(pageSize int) *spanMap {
+	return &spanMap{
+		spans:    make(map[uintptr]*span),
+		pageSize: uintptr(pageSize),
+	}
+}
+
+func (m *spanMap) set(s *span) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for addr := s.base; addr < s.end(); addr += m.pageSize {
+		m.spans[addr/m.pageSize] = s
+	}
+}
+
+// get returns the span containing addr, or nil if addr was not handed out by the heap.
+func (m *spanMap) get(addr uintptr) *span {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.spans[addr/m.pageSize]
+}
+
+// pageHeap hands out runs of contiguous pages to the medium manager. It grows by mapping
+// arenas of at least heapArenaSize bytes, splits free runs on allocation, and merges a
+// returned span with its free neighbours so large runs become available again.
+type pageHeap struct {
+	sys      syscall.Syscall
+	pageSize int
+	mu       sync.Mutex
+	// free holds the free spans, allocation picks the smallest one that fits.
+	free  []*span
+	spans *spanMap
+	// mapped is the total number of bytes mapped from the OS.
+	mapped int64
+	// huge is set when arenas are reserved as huge page regions.
+	huge syscall.HugePageSyscall
+	// hugeTLBBytes is the number of arena bytes mapped from hugetlbfs.
+	hugeTLBBytes int64
+	// transparent holds the arenas advised to use transparent huge pages.
+	transparent []syscall.Region
+}
+
+// newPageHeap creates a page heap mapping arenas with sys. Heaps serving different
+// NUMA nodes share spans, so a span can be found from any address it covers.
+func newPageHeap(sys syscall.Syscall, spans *spanMap) *pageHeap {
+	return &pageHeap{
+		sys:      sys,
+		pageSize: sys.PageSize(),
+		spans:    spans,
+	}
+}
+
+// allocSpan returns an in-use span of npages pages.
+func (h *pageHeap) allocSpan(npages int) (*span, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	idx := h.bestFit(npages)
+	if idx < 0 {
+		if err := h.grow(npages); err != nil {
+			return nil, err
+		}
+		idx = h.bestFit(npages)
+	}
+
+	s := h.free[idx]
+	h.free = append(h.free[:idx], h.free[idx+1:]...)
+	if s.npages > npages {
+		rest := &span{
+			base:     s.base + uintptr(npages*h.pageSize),
+			npages:   s.npages - npages,
+			pageSize: h.pageSize,
+			heap:     h,
+			released: s.released,
+			zeroed:   s.zeroed,
+		}
+		s.npages = npages
+		h.free = append(h.free, rest)
+		h.spans.set(rest)
+	}
+
+	s.state.Store(uint32(spanClaimed))
+	h.spans.set(s)
+	return s, nil
+}
+
+// freeSpan returns a span to the heap and coalesces it with adjacent free spans. The
+// merged span is treated as backed by memory even when a neighbour was released, the
+// scavenger then advises those pages again, which is cheap for unbacked pages.
+func (h *pageHeap) freeSpan(s *span) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s.state.Store(uint32(spanFree))
+	s = &span{base: s.base, npages: s.npages, pageSize: h.pageSize, heap: h}
+	if prev := h.spans.get(s.base - 1); h.mergeable(prev) && prev.end() == s.base {
+		h.remove(prev)
+		s.base = prev.base
+		s.npages += prev.npages
+	}
+
+	if next := h.spans.get(s.end()); h.mergeable(next) && next.base == s.end() {
+		h.remove(next)
+		s.npages += next.npages
+	}
+
+	h.free = append(h.free, s)
+	h.spans.set(s)
+}
+
+// mergeable reports whether s is a free span of this heap.
+func (h *pageHeap) mergeable(s *span) bool {
+	return s != nil && s.loadState() == spanFree && s.heap == h
+}
+
+func (s *span) loadState() spanState {
+	return spanState(s.state.Load())
+}
+
+func (h *pageHeap) bestFit(npages int) int {
+	best := -1
+	for i, s := range h.free {
+		if s.npages >= npages && (best < 0 || s.npages < h.free[best].npages) {
+			best = i
+		}
+	}
+
+	return best
+}
+
+func (h *pageHeap) remove(s *span) {
+	for i, f := range h.free {
+		if f == s {
+			h.free = append(h.free[:i], h.free[i+1:]...)
+			return
+		}
+	}
+}
+
+// grow maps a new arena large enough for npages pages.
+func (h *pageHeap) grow(npages int) error {
+	ptr, size, err := h.mapArena(max(npages*h.pageSize, heapArenaSize))
+	if err != nil {
+		return err
+	}
+
+	s := &span{base: uintptr(ptr), npages: size / h.pageSize, pageSize: h.pageSize, heap: h, released: true, zeroed: true}
+	h.mapped += int64(size)
+	h.free = append(h.free, s)
+	h.spans.set(s)
+	return nil
+}
+
+// mapArena maps an arena of size bytes. With huge pages enabled the arena is rounded up
+// to whole huge pages and reserved from hugetlbfs when possible, falling back to
+// transparent huge pages and finally to regular pages.
+func (h *pageHeap) mapArena(size int) (unsafe.Pointer, int, error) {
+	if h.huge == nil {
+		ptr, err := h.sys.AllocPages(size)
+		return ptr, size, err
+	}
+
+	size = syscall.AlignUp(size, syscall.HugePageSize)
+	ptr, kind, err := h.huge.AllocHugePages(size, true)
+	if err != nil {
+		ptr, err = h.sys.AllocPages(size)
+		return ptr, size, err
+	}
+
+	switch kind {
+	case syscall.HugePageHugeTLB:
+		h.hugeTLBBytes += int64(size)
+	case syscall.HugePageTransparent:
+		h.transparent = append(h.transparent, syscall.Region{Ptr: ptr, Size: size})
+	default:
+	}
+
+	return ptr, size, nil
+}
+
+// fragmentation returns the bytes of the heap's free spans and the bytes handed out
+// as spans.
+func (h *pageHeap) fragmentation() Fragmentation {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.fragmentationLocked()
+}
+
+func (h *pageHeap) fragmentationLocked() Fragmentation {
+	var free int64
+	for _, s := range h.free {
+		free += int64(s.size())
+	}
+
+	return Fragmentation{FreeBytes: free, UsedBytes: h.mapped - free}
+}
+
+// scavenge returns the pages of the free spans to the OS when the free bytes exceed
+// ratio times the used bytes, or unconditionally when force is set. The spans stay in
+// the heap and are handed out again without remapping. It returns the number of bytes
+// released.
+func (h *pageHeap) scavenge(ratio float64, force, lazy bool) int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !force && !h.fragmentationLocked().Exceeds(ratio) {
+		return 0
+	}
+
+	var released int64
+	for _, s := range h.free {
+		if s.released || h.sys.ReleasePages(addrToPtr(s.base), int(s.size()), lazy) != nil {
+			continue
+		}
+
+		s.released = true
+		s.zeroed = !lazy
+		released += int64(s.size())
+	}
+
+	return released
+}
@@ -0,0 +1,435 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"math/bits"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/TimeWtr/TurboAlloc/common"
+	"github.com/TimeWtr/TurboAlloc/syscall"
+)
+
+const (
+	// pageMapNodeBits is the number of page number bits resolved by the leaf and middle
+	// levels of the page map, the root resolves the remaining bits.
+	pageMapNodeBits = 12
+	pageMapNodeSize = 1 << pageMapNodeBits
+	pageMapNodeMask = pageMapNodeSize - 1
+	// pageStateGranule is the number of bytes covered by each state bit of a page, the
+	// size of the smallest class.
+	pageStateGranule = common.B8
+)
+
+// Owner describes which part of the manager owns a page.
+type Owner struct {
+	Class    common.SizeClass
+	Category common.SizeCategory
+	// Shard is the index of the small or medium shard owning the page, it is zero for
+	// large regions.
+	Shard int
+}
+
+// pageEntry packs an Owner into a page map slot. The low byte holds the size class,
+// the next two bits the category and the following 16 bits the shard, the top bit
+// marks the slot as used.
+type pageEntry uint64
+
+const (
+	pageEntryValid         = 1 << 63
+	pageEntryCategoryShift = 8
+	pageEntryShardShift    = 10
+)
+
+func newPageEntry(o Owner) pageEntry {
+	return pageEntryValid |
+		pageEntry(o.Class) |
+		pageEntry(o.Category)<<pageEntryCategoryShift |
+		pageEntry(uint16(o.Shard))<<pageEntryShardShift
+}
+
+func (e pageEntry) owner() Owner {
+	return Owner{
+		Class:    common.SizeClass(uint8(e)),
+		Category: common.SizeCategory(e >> pageEntryCategoryShift & 0x3),
+		Shard:    int(uint16(e >> pageEntryShardShift)),
+	}
+}
+
+type (
+	pageMapLeaf struct {
+		entries [pageMapNodeSize]atomic.Uint64
+		states  [pageMapNodeSize]atomic.Pointer[pageStates]
+	}
+	pageMapMid [pageMapNodeSize]atomic.Pointer[pageMapLeaf]
+	// pageStates holds one bit per pageStateGranule bytes of a small page, set while the
+	// block starting there is handed out.
+	pageStates []atomic.Uint64
+)
+
+// pageMap is a three level radix tree keyed by page number that records the owner of
+// every page handed out by the managers, along with the state bits of small blocks.
+// Lookups are lock-free, nodes are installed with a CAS the first time a page below
+// them is set and are never freed. A nil pageMap records nothing, which keeps managers
+// built on their own in tests simple.
+type pageMap struct {
+	shift uint
+	root  []atomic.Pointer[pageMapMid]
+}
+
+// newPageMap creates a page map for pages of pageSize bytes, which must be a power of two.
+func newPageMap(pageSize int) *pageMap {
+	shift := uint(bits.TrailingZeros(uint(pageSize)))
+	rootBits := max(addrBits-int(shift)-2*pageMapNodeBits, 0)
+	return &pageMap{
+		shift: shift,
+		root:  make([]atomic.Pointer[pageMapMid], 1<<rootBits),
+	}
+}
+
+// set records o as the owner of every page of the size bytes starting at addr.
+func (m *pageMap) set(addr uintptr, size int, o Owner) {
+	if m != nil {
+		m.store(addr, size, uint64(newPageEntry(o)))
+	}
+}
+
+// clear forgets the owner of every page of the size bytes starting at addr.
+func (m *pageMap) clear(addr uintptr, size int) {
+	if m != nil {
+		m.store(addr, size, 0)
+	}
+}
+
+func (m *pageMap) store(addr uintptr, size int, v uint64) {
+	first, last := addr>>m.shift, (addr+uintptr(size)-1)>>m.shift
+	for pn := first; pn <= last; pn++ {
+		if leaf := m.leaf(pn, v != 0); leaf != nil {
+			leaf.entries[pn&pageMapNodeMask].Store(v)
+		}
+	}
+}
+
+// lookup returns the owner of the page containing addr.
+func (m *pageMap) lookup(addr uintptr) (Owner, bool) {
+	if m == nil || addr >= maxBlockAddr {
+		return Owner{}, false
+	}
+
+	pn := addr >> m.shift
+	leaf := m.leaf(pn, false)
+	if leaf == nil {
+		return Owner{}, false
+	}
+
+	e := pageEntry(leaf.entries[pn&pageMapNodeMask].Load())
+	if e&pageEntryValid == 0 {
+		return Owner{}, false
+	}
+
+	return e.owner(), true
+}
+
+// markAllocated sets the state bit of the small block at addr.
+func (m *pageMap) markAllocated(addr uintptr) {
+	if m != nil {
+		word, bit := m.stateBit(addr)
+		word.Or(bit)
+	}
+}
+
+// markFree clears the state bit of the small block at addr. It reports false when the
+// bit was already clear, that is when the block is not handed out.
+func (m *pageMap) markFree(addr uintptr) bool {
+	if m == nil {
+		return true
+	}
+
+	word, bit := m.stateBit(addr)
+	return word.And(^bit)&bit != 0
+}
+
+// stateBit returns the word and the bit tracking the block at addr.
+func (m *pageMap) stateBit(addr uintptr) (*atomic.Uint64, uint64) {
+	c := stateCursor{m: m}
+	return c.bit(addr)
+}
+
+// markAllocatedRun is markAllocated for a run of blocks, with one atomic operation per
+// state word.
+func (m *pageMap) markAllocatedRun(ptrs []unsafe.Pointer) {
+	if m == nil {
+		return
+	}
+
+	c := stateCursor{m: m}
+	var word *atomic.Uint64
+	var mask uint64
+	for _, ptr := range ptrs {
+		w, bit := c.bit(uintptr(ptr))
+		if w != word {
+			if word != nil {
+				word.Or(mask)
+			}
+			word, mask = w, 0
+		}
+		mask |= bit
+	}
+
+	if word != nil {
+		word.Or(mask)
+	}
+}
+
+// markFreeRun is markFree for a run of blocks, with one atomic operation per state
+// word. It stops at the first block that is not handed out or that appears twice, and
+// returns the number of blocks preceding it, whose bits are cleared.
+func (m *pageMap) markFreeRun(ptrs []unsafe.Pointer) int {
+	if m == nil {
+		return len(ptrs)
+	}
+
+	c := stateCursor{m: m}
+	start := 0
+	var word *atomic.Uint64
+	var mask uint64
+	for i, ptr := range ptrs {
+		w, bit := c.bit(uintptr(ptr))
+		if w == word && mask&bit == 0 {
+			mask |= bit
+			continue
+		}
+
+		if word != nil {
+			if n := c.clear(word, mask, ptrs[start:i]); n < i-start {
+				return start + n
+			}
+		}
+		if w == word {
+			return i
+		}
+		start, word, mask = i, w, bit
+	}
+
+	if word != nil {
+		return start + c.clear(word, mask, ptrs[start:])
+	}
+
+	return len(ptrs)
+}
+
+// stateCursor resolves the state bits of a run of blocks, it only walks the page map
+// when the run crosses into another page.
+type stateCursor struct {
+	m      *pageMap
+	pn     uintptr
+	states *pageStates
+}
+
+// bit returns the word and the bit tracking the block at addr, the state bits of a page
+// are created the first time one of its blocks is used.
+func (c *stateCursor) bit(addr uintptr) (*atomic.Uint64, uint64) {
+	if pn := addr >> c.m.shift; c.states == nil || pn != c.pn {
+		c.seek(pn)
+	}
+
+	i := addr & (1<<c.m.shift - 1) / pageStateGranule
+	return &(*c.states)[i/64], 1 << (i % 64)
+}
+
+func (c *stateCursor) seek(pn uintptr) {
+	states := &c.m.leaf(pn, true).states[pn&pageMapNodeMask]
+	if states.Load() == nil {
+		words := make(pageStates, (1<<c.m.shift/pageStateGranule+63)/64)
+		states.CompareAndSwap(nil, &words)
+	}
+	c.pn, c.states = pn, states.Load()
+}
+
+// clear clears the mask bits of the blocks of word. When one of them was not set, the
+// bits of the blocks following it are set back and its index is returned, otherwise
+// the number of blocks.
+func (c *stateCursor) clear(word *atomic.Uint64, mask uint64, ptrs []unsafe.Pointer) int {
+	old := word.And(^mask)
+	if old&mask == mask {
+		return len(ptrs)
+	}
+
+	for i, ptr := range ptrs {
+		if _, bit := c.bit(uintptr(ptr)); old&bit == 0 {
+			var restore uint64
+			for _, rest := range ptrs[i+1:] {
+				_, bit = c.bit(uintptr(rest))
+				restore |= bit
+			}
+			word.Or(restore & old)
+			return i
+		}
+	}
+
+	return len(ptrs)
+}
+
+// leaf returns the leaf holding page pn, creating the missing nodes when create is set.
+// Without create it returns nil when no page below the leaf was ever set.
+func (m *pageMap) leaf(pn uintptr, create bool) *pageMapLeaf {
+	mids := &m.root[pn>>(2*pageMapNodeBits)]
+	mid := mids.Load()
+	if mid == nil {
+		if !create {
+			return nil
+		}
+		mids.CompareAndSwap(nil, new(pageMapMid))
+		mid = mids.Load()
+	}
+
+	leaves := &mid[pn>>pageMapNodeBits&pageMapNodeMask]
+	leaf := leaves.Load()
+	if leaf == nil {
+		if !create {
+			return nil
+		}
+		leaves.CompareAndSwap(nil, new(pageMapLeaf))
+		leaf = leaves.Load()
+	}
+
+	return leaf
+}
+
+// trackPages shares the manager's page map with the size category managers.
+func (m *Manager) trackPages() {
+	m.pageMap = newPageMap(m.sys.PageSize())
+	for _, shards := range m.sm.shards {
+		for _, shard := range shards {
+			shard.pageMap = m.pageMap
+		}
+	}
+	m.sm.pageMap = m.pageMap
+	m.mm.pageMap = m.pageMap
+	m.lm.pageMap = m.pageMap
+}
+
+// Owner returns the owner of the page containing ptr, it fails with ErrInvalidPointer
+// when the page was not handed out by the manager.
+func (m *Manager) Owner(ptr unsafe.Pointer) (Owner, error) {
+	o, ok := m.pageMap.lookup(uintptr(ptr))
+	if !ok {
+		return Owner{}, fmt.Errorf("%w: %p", ErrForeignPointer, ptr)
+	}
+
+	return o, nil
+}
+
+// SizeOf returns the usable size of the block starting at ptr, which is the size of its
+// class or, for large regions, the page aligned region size. It fails with
+// ErrInvalidPointer when ptr is not the start of a block handed out by the manager.
+func (m *Manager) SizeOf(ptr unsafe.Pointer) (int, error) {
+	if m.debug != nil {
+		if size, ok := m.debug.sizeOf(ptr); ok {
+			return size, nil
+		}
+	}
+
+	size, _, err := m.blockOf(ptr)
+	return size, err
+}
+
+// UsableSize returns the usable size of a block allocated with size bytes, which is the
+// size SizeOf reports for it and FreeUnsized returns: the class size, the page aligned
+// size for large regions, or size itself for debug blocks.
+func (m *Manager) UsableSize(size int) int {
+	sc, err := m.sizeClassOf(size)
+	if err != nil || m.debug != nil {
+		return size
+	}
+
+	if sc.Category() == common.LargeSizeCategory {
+		return syscall.AlignUp(size, m.sys.PageSize())
+	}
+
+	return sc.Size()
+}
+
+// UsableSizeAligned is UsableSize for a block allocated with AllocAligned.
+func (m *Manager) UsableSizeAligned(size, align int) int {
+	sc, err := m.alignedClassOf(size, align)
+	if err != nil || m.classAligned(sc, align) {
+		return m.UsableSize(size)
+	}
+
+	return syscall.AlignUp(size, m.sys.PageSize())
+}
+
+// FreeUnsized returns a block obtained from any allocation method without its size,
+// which is looked up in the page map. It returns the usable size of the block.
+func (m *Manager) FreeUnsized(ptr unsafe.Pointer) (int, error) {
+	if m.debug != nil {
+		if size, ok := m.debug.sizeOf(ptr); ok {
+			return size, m.debug.free(ptr, size)
+		}
+	}
+
+	size, o, err := m.blockOf(ptr)
+	if err == nil {
+		err = m.trackFree(ptr, 0)
+	}
+	if err != nil {
+		return 0, m.report(err)
+	}
+
+	switch o.Category {
+	case common.SmallSizeCategory:
+		err = m.sm.free(ptr, o.Class)
+	case common.MediumSizeCategory:
+		err = m.mm.free(ptr, o.Class)
+	default:
+		err = m.lm.free(ptr, size)
+	}
+	if err != nil {
+		return 0, m.report(err)
+	}
+
+	m.untrackFree(ptr, 0, o)
+	return size, nil
+}
+
+// blockOf returns the usable size and the owner of the block starting at ptr.
+func (m *Manager) blockOf(ptr unsafe.Pointer) (int, Owner, error) {
+	o, err := m.Owner(ptr)
+	if err != nil {
+		return 0, o, err
+	}
+
+	addr := uintptr(ptr)
+	switch o.Category {
+	case common.SmallSizeCategory:
+		// Chunks are page aligned and small classes never exceed a page.
+		if size := o.Class.Size(); addr%uintptr(size) == 0 {
+			return size, o, nil
+		}
+	case common.MediumSizeCategory:
+		if s := m.mm.spans.get(addr); s != nil && s.loadState() == spanInUse && (addr-s.base)%s.objSize == 0 {
+			return int(s.objSize), o, nil
+		}
+	default:
+		if size, ok := m.lm.sizeOf(ptr); ok {
+			return size, o, nil
+		}
+	}
+
+	return 0, o, fmt.Errorf("%w: %p is not the start of a %s block", ErrInvalidPointer, ptr, o.Class)
+}
@@ -0,0 +1,152 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"testing"
+	"unsafe"
+
+	"github.com/TimeWtr/TurboAlloc/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPageMap_SetLookupClear(t *testing.T) {
+	m := newPageMap(common.KB * 4)
+	owner := Owner{Class: common.SizeClass16KB, Category: common.MediumSizeCategory, Shard: 513}
+	// The range crosses a leaf boundary.
+	base := uintptr(pageMapNodeSize-1) * common.KB * 4
+	m.set(base, common.KB*8, owner)
+
+	for _, addr := range []uintptr{base, base + common.KB*4 + 100} {
+		got, ok := m.lookup(addr)
+		assert.True(t, ok)
+		assert.Equal(t, owner, got)
+	}
+	_, ok := m.lookup(base + common.KB*8)
+	assert.False(t, ok)
+	_, ok = m.lookup(maxBlockAddr)
+	assert.False(t, ok)
+
+	m.clear(base, common.KB*8)
+	_, ok = m.lookup(base)
+	assert.False(t, ok)
+	// Clearing pages that were never set does not allocate nodes.
+	m.clear(1<<40, common.KB*4)
+	assert.Nil(t, m.leaf(1<<40>>m.shift, false))
+
+	var none *pageMap
+	none.set(base, common.KB*4, owner)
+	_, ok = none.lookup(base)
+	assert.False(t, ok)
+}
+
+func TestPageMap_StateBits(t *testing.T) {
+	m := newPageMap(common.KB * 4)
+	base := uintptr(common.KB * 4 * 100)
+	// The run spans two pages.
+	ptrs := make([]unsafe.Pointer, 6)
+	for i := range ptrs {
+		ptrs[i] = addrToPtr(base + common.KB*4 - 3*common.B64 + uintptr(i)*common.B64)
+	}
+	m.markAllocatedRun(ptrs)
+
+	// The unallocated block stops the run, the ones after it stay allocated.
+	unallocated := unsafe.Add(ptrs[1], common.B8)
+	run := []unsafe.Pointer{ptrs[0], ptrs[1], unallocated, ptrs[2], ptrs[3]}
+	assert.Equal(t, 2, m.markFreeRun(run))
+	assert.False(t, m.markFree(uintptr(ptrs[0])))
+	assert.True(t, m.markFree(uintptr(ptrs[2])))
+
+	// A block appearing twice stops the run at its second occurrence.
+	assert.Equal(t, 2, m.markFreeRun([]unsafe.Pointer{ptrs[3], ptrs[4], ptrs[3], ptrs[5]}))
+	assert.True(t, m.markFree(uintptr(ptrs[5])))
+	assert.Equal(t, 0, m.markFreeRun(ptrs[5:]))
+}
+
+func TestManager_OwnerAndSizeOf(t *testing.T) {
+	m, _ := newTestScavengeManager(t)
+	cases := []struct {
+		size   int
+		owner  Owner
+		usable int
+	}{
+		{common.B64 - 8, Owner{Class: common.SizeClass64B, Category: common.SmallSizeCategory}, common.B64},
+		{common.KB * 10, Owner{Class: common.SizeClass16KB, Category: common.MediumSizeCategory}, common.KB * 16},
+		{common.MB + 1, Owner{Class: common.SizeClass2MB, Category: common.LargeSizeCategory}, common.MB + common.KB*4},
+	}
+	for _, c := range cases {
+		ptr, err := m.Alloc(c.size)
+		assert.NoError(t, err)
+		owner, err := m.Owner(ptr)
+		assert.NoError(t, err)
+		assert.Equal(t, c.owner, owner)
+		size, err := m.SizeOf(ptr)
+		assert.NoError(t, err)
+		assert.Equal(t, c.usable, size)
+
+		_, err = m.SizeOf(unsafe.Add(ptr, 8))
+		assert.ErrorIs(t, err, ErrInvalidPointer)
+
+		freed, err := m.FreeUnsized(ptr)
+		assert.NoError(t, err)
+		assert.Equal(t, c.usable, freed)
+	}
+	assert.Zero(t, m.Stats().Categories[common.AllSizeCategory].InUseObjects)
+
+	// Freed large regions and memory the manager never handed out are rejected.
+	large, err := m.Alloc(common.MB)
+	assert.NoError(t, err)
+	assert.NoError(t, m.Free(large, common.MB))
+	_, err = m.SizeOf(large)
+	assert.ErrorIs(t, err, ErrInvalidPointer)
+	var local uint64
+	_, err = m.Owner(unsafe.Pointer(&local))
+	assert.ErrorIs(t, err, ErrInvalidPointer)
+	_, err = m.FreeUnsized(unsafe.Pointer(&local))
+	assert.ErrorIs(t, err, ErrInvalidPointer)
+}
+
+func TestManager_FreeUnsizedAligned(t *testing.T) {
+	m, _ := newTestScavengeManager(t)
+	ptr, err := m.AllocAligned(common.B64, common.KB*64)
+	assert.NoError(t, err)
+	owner, err := m.Owner(ptr)
+	assert.NoError(t, err)
+	assert.Equal(t, common.LargeSizeCategory, owner.Category)
+
+	size, err := m.FreeUnsized(ptr)
+	assert.NoError(t, err)
+	assert.Equal(t, common.KB*4, size)
+	assert.Zero(t, m.Stats().Categories[common.LargeSizeCategory].InUseObjects)
+}
+
+func TestManager_OwnerAfterRealloc(t *testing.T) {
+	m, _ := newTestScavengeManager(t)
+	ptr, err := m.Alloc(common.MB)
+	assert.NoError(t, err)
+	moved, err := m.Realloc(ptr, common.MB, common.MB*3)
+	assert.NoError(t, err)
+
+	size, err := m.SizeOf(moved)
+	assert.NoError(t, err)
+	assert.Equal(t, common.MB*3, size)
+	owner, err := m.Owner(moved)
+	assert.NoError(t, err)
+	assert.Equal(t, common.SizeClass4MB, owner.Class)
+	// The fake syscall always moves remapped regions.
+	assert.NotEqual(t, ptr, moved)
+	_, err = m.Owner(ptr)
+	assert.ErrorIs(t, err, ErrInvalidPointer)
+}
@@ -0,0 +1,181 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"math"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// DefaultProfileRate is a sampling rate for WithHeapProfile matching the default of
+// runtime.MemProfileRate.
+const DefaultProfileRate = 512 * 1024
+
+// ErrProfilingDisabled is returned by WriteHeapProfile when profiling is not enabled.
+var ErrProfilingDisabled = errors.New("heap profiling is disabled")
+
+// WithHeapProfile samples allocations for WriteHeapProfile, on average one every rate
+// bytes allocated like runtime.MemProfileRate. A rate of 1 records every allocation and
+// zero disables profiling.
+func WithHeapProfile(rate int) Option {
+	return func(m *Manager) {
+		if rate <= 0 {
+			return
+		}
+
+		m.profiler = &heapProfiler{rate: rate, allocs: make(map[profileStack]*profileCounts)}
+		m.profiler.until.Store(m.profiler.nextSample())
+	}
+}
+
+type (
+	profileStack  [leakStackDepth]uintptr
+	profileCounts struct {
+		objects, bytes int64
+	}
+)
+
+// heapProfiler samples allocations the way the runtime samples the Go heap. The sampled
+// blocks that are live are kept in a leak tracker, cumulative counts per stack in allocs.
+type heapProfiler struct {
+	rate int
+	// until is the number of bytes left to allocate before the next sample.
+	until  atomic.Int64
+	live   leakTracker
+	mu     sync.Mutex
+	allocs map[profileStack]*profileCounts
+}
+
+// nextSample draws the distance to the next sample from an exponential distribution of
+// mean rate, so that every byte allocated has the same chance of being sampled.
+func (p *heapProfiler) nextSample() int64 {
+	if p.rate == 1 {
+		return 0
+	}
+
+	return int64(rand.ExpFloat64() * float64(p.rate))
+}
+
+func (p *heapProfiler) alloc(ptr unsafe.Pointer, size int) {
+	if p.until.Add(-int64(size)) >= 0 {
+		return
+	}
+	p.until.Store(p.nextSample())
+
+	r := p.live.alloc(ptr, size)
+	p.mu.Lock()
+	c, ok := p.allocs[r.stack]
+	if !ok {
+		c = new(profileCounts)
+		p.allocs[r.stack] = c
+	}
+	c.objects++
+	c.bytes += int64(size)
+	p.mu.Unlock()
+}
+
+func (p *heapProfiler) free(ptr unsafe.Pointer) {
+	p.live.free(ptr)
+}
+
+// scale converts the counts of sampled allocations of a stack into estimates of all
+// allocations, following runtime/pprof: a block of size bytes is sampled with
+// probability 1-exp(-size/rate).
+func (p *heapProfiler) scale(c profileCounts) profileCounts {
+	if c.objects == 0 || p.rate <= 1 {
+		return c
+	}
+
+	avg := float64(c.bytes) / float64(c.objects)
+	s := 1 / (1 - math.Exp(-avg/float64(p.rate)))
+	return profileCounts{objects: int64(float64(c.objects) * s), bytes: int64(float64(c.bytes) * s)}
+}
+
+// samples returns the alloc and inuse counts of every stack, with the frames of the
+// allocator trimmed.
+func (p *heapProfiler) samples() map[profileStack]*[2]profileCounts {
+	samples := make(map[profileStack]*[2]profileCounts)
+	add := func(stack profileStack, i int, c profileCounts) {
+		var key profileStack
+		_, trimmed := callSite(stack[:stackDepth(stack)])
+		copy(key[:], trimmed)
+		s, ok := samples[key]
+		if !ok {
+			s = new([2]profileCounts)
+			samples[key] = s
+		}
+		s[i].objects += c.objects
+		s[i].bytes += c.bytes
+	}
+
+	p.mu.Lock()
+	for stack, c := range p.allocs {
+		add(stack, 0, *c)
+	}
+	p.mu.Unlock()
+	p.live.each(func(r *leakRecord) {
+		add(r.stack, 1, profileCounts{objects: 1, bytes: int64(r.size)})
+	})
+
+	for _, s := range samples {
+		s[0], s[1] = p.scale(s[0]), p.scale(s[1])
+	}
+	return samples
+}
+
+func stackDepth(stack profileStack) int {
+	n := 0
+	for n < len(stack) && stack[n] != 0 {
+		n++
+	}
+
+	return n
+}
+
+// WriteHeapProfile writes a gzip compressed protocol buffer profile of the sampled
+// allocations in the format read by go tool pprof. The sample types are alloc_objects,
+// alloc_space, inuse_objects and inuse_space, as in the Go heap profile.
+func (m *Manager) WriteHeapProfile(w io.Writer) error {
+	if m.profiler == nil {
+		return ErrProfilingDisabled
+	}
+
+	b := newProfileBuilder()
+	for _, t := range []string{"alloc_objects", "alloc_space", "inuse_objects", "inuse_space"} {
+		unit := "count"
+		if t == "alloc_space" || t == "inuse_space" {
+			unit = "bytes"
+		}
+		b.sampleType(t, unit)
+	}
+
+	for stack, s := range m.profiler.samples() {
+		b.sample(stack[:stackDepth(stack)], s[0].objects, s[0].bytes, s[1].objects, s[1].bytes)
+	}
+
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(b.build(time.Now(), int64(m.profiler.rate), "inuse_space")); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
@@ -0,0 +1,207 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"encoding/binary"
+	"runtime"
+	"time"
+)
+
+// Field numbers of the messages of profile.proto, the format of pprof profiles.
+const (
+	profileSampleType        = 1
+	profileSample            = 2
+	profileLocation          = 4
+	profileFunction          = 5
+	profileStringTable       = 6
+	profileTimeNanos         = 9
+	profilePeriodType        = 11
+	profilePeriod            = 12
+	profileDefaultSampleType = 14
+
+	valueTypeType = 1
+	valueTypeUnit = 2
+
+	sampleLocationID = 1
+	sampleValue      = 2
+
+	locationID      = 1
+	locationAddress = 3
+	locationLine    = 4
+
+	lineFunctionID = 1
+	lineLine       = 2
+
+	functionID         = 1
+	functionName       = 2
+	functionSystemName = 3
+	functionFilename   = 4
+)
+
+// protoBuffer encodes protocol buffer fields, nested messages are encoded into their own
+// buffer and appended as bytes.
+type protoBuffer struct {
+	data []byte
+}
+
+func (b *protoBuffer) key(field, wireType int) {
+	b.data = binary.AppendUvarint(b.data, uint64(field<<3|wireType))
+}
+
+func (b *protoBuffer) uint64(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+
+	b.key(field, 0)
+	b.data = binary.AppendUvarint(b.data, v)
+}
+
+func (b *protoBuffer) int64(field int, v int64) {
+	b.uint64(field, uint64(v))
+}
+
+func (b *protoBuffer) bytes(field int, v []byte) {
+	b.key(field, 2)
+	b.data = binary.AppendUvarint(b.data, uint64(len(v)))
+	b.data = append(b.data, v...)
+}
+
+func (b *protoBuffer) packed(field int, vs []uint64) {
+	var p protoBuffer
+	for _, v := range vs {
+		p.data = binary.AppendUvarint(p.data, v)
+	}
+	b.bytes(field, p.data)
+}
+
+// profileBuilder assembles a profile, interning strings, functions and locations.
+type profileBuilder struct {
+	profile   protoBuffer
+	strings   map[string]int64
+	functions map[runtime.Frame]uint64
+	locations map[uintptr]uint64
+	table     []string
+}
+
+func newProfileBuilder() *profileBuilder {
+	b := &profileBuilder{
+		strings:   make(map[string]int64),
+		functions: make(map[runtime.Frame]uint64),
+		locations: make(map[uintptr]uint64),
+	}
+	// The first entry of the string table must be the empty string.
+	b.str("")
+	return b
+}
+
+func (b *profileBuilder) str(s string) int64 {
+	if id, ok := b.strings[s]; ok {
+		return id
+	}
+
+	id := int64(len(b.table))
+	b.strings[s] = id
+	b.table = append(b.table, s)
+	return id
+}
+
+func (b *profileBuilder) valueType(field int, typ, unit string) {
+	var v protoBuffer
+	v.int64(valueTypeType, b.str(typ))
+	v.int64(valueTypeUnit, b.str(unit))
+	b.profile.bytes(field, v.data)
+}
+
+func (b *profileBuilder) sampleType(typ, unit string) {
+	b.valueType(profileSampleType, typ, unit)
+}
+
+func (b *profileBuilder) sample(stack []uintptr, values ...int64) {
+	ids := make([]uint64, len(stack))
+	for i, pc := range stack {
+		ids[i] = b.location(pc)
+	}
+
+	vals := make([]uint64, len(values))
+	for i, v := range values {
+		vals[i] = uint64(v)
+	}
+
+	var s protoBuffer
+	s.packed(sampleLocationID, ids)
+	s.packed(sampleValue, vals)
+	b.profile.bytes(profileSample, s.data)
+}
+
+// location returns the id of the location of pc, inlined calls become extra lines of
+// the location, innermost first.
+func (b *profileBuilder) location(pc uintptr) uint64 {
+	if id, ok := b.locations[pc]; ok {
+		return id
+	}
+
+	id := uint64(len(b.locations) + 1)
+	b.locations[pc] = id
+	var l protoBuffer
+	l.uint64(locationID, id)
+	l.uint64(locationAddress, uint64(pc))
+	frames := runtime.CallersFrames([]uintptr{pc})
+	for {
+		f, more := frames.Next()
+		var line protoBuffer
+		line.uint64(lineFunctionID, b.function(f))
+		line.int64(lineLine, int64(f.Line))
+		l.bytes(locationLine, line.data)
+		if !more {
+			break
+		}
+	}
+
+	b.profile.bytes(profileLocation, l.data)
+	return id
+}
+
+func (b *profileBuilder) function(f runtime.Frame) uint64 {
+	key := runtime.Frame{Function: f.Function, File: f.File}
+	if id, ok := b.functions[key]; ok {
+		return id
+	}
+
+	id := uint64(len(b.functions) + 1)
+	b.functions[key] = id
+	var fn protoBuffer
+	fn.uint64(functionID, id)
+	fn.int64(functionName, b.str(f.Function))
+	fn.int64(functionSystemName, b.str(f.Function))
+	fn.int64(functionFilename, b.str(f.File))
+	b.profile.bytes(profileFunction, fn.data)
+	return id
+}
+
+// build returns the encoded profile, the string table is written last since every other
+// message adds to it.
+func (b *profileBuilder) build(now time.Time, period int64, defaultType string) []byte {
+	b.profile.int64(profileTimeNanos, now.UnixNano())
+	b.valueType(profilePeriodType, "space", "bytes")
+	b.profile.int64(profilePeriod, period)
+	b.profile.int64(profileDefaultSampleType, b.str(defaultType))
+	for _, s := range b.table {
+		b.profile.bytes(profileStringTable, []byte(s))
+	}
+
+	return b.profile.data
+}
@@ -0,0 +1,121 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/TimeWtr/TurboAlloc/common"
+	"github.com/stretchr/testify/assert"
+)
+
+// protoFields decodes the length delimited and varint fields of a protocol buffer message.
+func protoFields(t *testing.T, data []byte) (map[int][][]byte, map[int][]uint64) {
+	t.Helper()
+	messages, varints := make(map[int][][]byte), make(map[int][]uint64)
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		data = data[n:]
+		v, n := binary.Uvarint(data)
+		data = data[n:]
+		switch key & 7 {
+		case 0:
+			varints[int(key>>3)] = append(varints[int(key>>3)], v)
+		case 2:
+			messages[int(key>>3)] = append(messages[int(key>>3)], data[:v])
+			data = data[v:]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+	}
+
+	return messages, varints
+}
+
+func packedValues(data []byte) []int64 {
+	var vs []int64
+	for len(data) > 0 {
+		v, n := binary.Uvarint(data)
+		vs = append(vs, int64(v))
+		data = data[n:]
+	}
+
+	return vs
+}
+
+func TestManager_WriteHeapProfile(t *testing.T) {
+	m, _ := newTestScavengeManager(t)
+	assert.ErrorIs(t, m.WriteHeapProfile(io.Discard), ErrProfilingDisabled)
+
+	m, _ = newTestScavengeManager(t, WithHeapProfile(1))
+	for range 3 {
+		leakyAlloc(t, m, common.B64)
+	}
+	ptr, err := m.Alloc(common.KB * 16)
+	assert.NoError(t, err)
+	assert.NoError(t, m.Free(ptr, common.KB*16))
+
+	var buf bytes.Buffer
+	assert.NoError(t, m.WriteHeapProfile(&buf))
+	zr, err := gzip.NewReader(&buf)
+	assert.NoError(t, err)
+	data, err := io.ReadAll(zr)
+	assert.NoError(t, err)
+
+	messages, varints := protoFields(t, data)
+	table := messages[profileStringTable]
+	assert.Empty(t, table[0])
+	var types []string
+	for _, st := range messages[profileSampleType] {
+		_, v := protoFields(t, st)
+		types = append(types, string(table[v[valueTypeType][0]]))
+	}
+	assert.Equal(t, []string{"alloc_objects", "alloc_space", "inuse_objects", "inuse_space"}, types)
+	assert.Equal(t, []uint64{1}, varints[profilePeriod])
+	assert.Equal(t, "inuse_space", string(table[varints[profileDefaultSampleType][0]]))
+
+	var total [4]int64
+	for _, s := range messages[profileSample] {
+		fields, _ := protoFields(t, s)
+		assert.NotEmpty(t, packedValues(fields[sampleLocationID][0]))
+		for i, v := range packedValues(fields[sampleValue][0]) {
+			total[i] += v
+		}
+	}
+	assert.Equal(t, [4]int64{4, 3*common.B64 + common.KB*16, 3, 3 * common.B64}, total)
+	assert.Contains(t, string(bytes.Join(table, nil)), "core.leakyAlloc")
+}
+
+func TestHeapProfiler_Sampling(t *testing.T) {
+	p := &heapProfiler{rate: common.KB * 64, allocs: make(map[profileStack]*profileCounts)}
+	p.until.Store(p.nextSample())
+	const n = 4096
+	for i := range n {
+		p.alloc(addrToPtr(uintptr(i+1)*common.KB), common.KB)
+	}
+
+	// About one in 64 allocations is sampled and scaled back to the total.
+	var sampled profileCounts
+	for _, s := range p.samples() {
+		sampled.objects += s[0].objects
+		sampled.bytes += s[0].bytes
+	}
+	assert.InDelta(t, n, sampled.objects, n/2)
+	assert.InDelta(t, n*common.KB, sampled.bytes, n*common.KB/2)
+}
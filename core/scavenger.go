@@ -0,0 +1,150 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/TimeWtr/TurboAlloc/common"
+)
+
+// DefaultScavengeInterval is the default period of the background scavenger.
+const DefaultScavengeInterval = 10 * time.Second
+
+// Fragmentation compares the bytes sitting free in the allocator with the bytes handed
+// out to callers.
+type Fragmentation struct {
+	FreeBytes int64
+	UsedBytes int64
+}
+
+// Ratio returns the free-to-used ratio, it is +Inf when free memory is not backing any
+// allocation.
+func (f Fragmentation) Ratio() float64 {
+	if f.UsedBytes <= 0 {
+		if f.FreeBytes > 0 {
+			return math.Inf(1)
+		}
+		return 0
+	}
+
+	return float64(f.FreeBytes) / float64(f.UsedBytes)
+}
+
+// Exceeds reports whether there is free memory and the free-to-used ratio is above ratio.
+func (f Fragmentation) Exceeds(ratio float64) bool {
+	return f.FreeBytes > 0 && f.Ratio() > ratio
+}
+
+func (f Fragmentation) add(o Fragmentation) Fragmentation {
+	return Fragmentation{FreeBytes: f.FreeBytes + o.FreeBytes, UsedBytes: f.UsedBytes + o.UsedBytes}
+}
+
+// ScavengeStats reports the work done by the scavenger since the manager was created.
+type ScavengeStats struct {
+	// Cycles is the number of scavenge passes.
+	Cycles uint64
+	// ReleasedBytes is the number of bytes returned to the OS.
+	ReleasedBytes uint64
+}
+
+// WithScavenger starts a background scavenger running every interval. A pass measures
+// the fragmentation of every size class and, when the free-to-used ratio of a class
+// exceeds ratio, returns its fully free pages to the OS. lazy selects MADV_FREE instead
+// of MADV_DONTNEED. A non-positive ratio or interval leaves the scavenger off, passes
+// can still be run with Manager.Scavenge.
+func WithScavenger(ratio float64, interval time.Duration, lazy bool) Option {
+	return func(m *Manager) {
+		m.scavenger.ratio = ratio
+		m.scavenger.interval = interval
+		m.scavenger.lazy = lazy
+	}
+}
+
+type scavenger struct {
+	ratio    float64
+	interval time.Duration
+	lazy     bool
+
+	// mu serializes passes.
+	mu       sync.Mutex
+	cycles   atomic.Uint64
+	released atomic.Uint64
+}
+
+// startScavenger runs the background scavenger when it is configured.
+func (m *Manager) startScavenger() {
+	sc := &m.scavenger
+	if sc.ratio <= 0 || sc.interval <= 0 {
+		return
+	}
+
+	m.every(sc.interval, func() {
+		m.Scavenge()
+	})
+}
+
+// Scavenge runs a single scavenge pass and returns the number of bytes released. Small
+// classes over the ratio release their fully free chunks, medium classes over the ratio
+// give their empty spans back to the page heap, which then releases its free pages, and
+// the large manager releases its retained regions when they exceed the ratio. With the
+// default ratio of zero every fully free page is released.
+func (m *Manager) Scavenge() uint64 {
+	sc := &m.scavenger
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	var released int64
+	for class, f := range m.sm.fragmentation() {
+		if f.Exceeds(sc.ratio) {
+			released += m.sm.scavenge(class, sc.lazy)
+		}
+	}
+
+	force := false
+	for class, f := range m.mm.fragmentation() {
+		if f.Exceeds(sc.ratio) {
+			m.mm.releaseEmpty(class)
+			force = true
+		}
+	}
+	released += m.mm.scavenge(sc.ratio, force, sc.lazy)
+	released += m.lm.scavenge(sc.ratio, sc.lazy)
+
+	sc.cycles.Add(1)
+	sc.released.Add(uint64(released))
+	return uint64(released)
+}
+
+// Fragmentation returns the free and used bytes of every small and medium size class.
+func (m *Manager) Fragmentation() map[common.SizeClass]Fragmentation {
+	frag := m.sm.fragmentation()
+	for class, f := range m.mm.fragmentation() {
+		frag[class] = f
+	}
+
+	return frag
+}
+
+// ScavengeStats returns the cumulative scavenger counters.
+func (m *Manager) ScavengeStats() ScavengeStats {
+	return ScavengeStats{
+		Cycles:        m.scavenger.cycles.Load(),
+		ReleasedBytes: m.scavenger.released.Load(),
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"math"
+	"runtime"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/TimeWtr/TurboAlloc/common"
+	"github.com/TimeWtr/TurboAlloc/syscall"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestScavengeManager(t *testing.T, opts ...Option) (*Manager, *syscall.FakeSyscall) {
+	t.Helper()
+	sys := newTestSyscall(t)
+	opts = append([]Option{WithSyscall(sys), WithShardSelector(&fixedSelector{})}, opts...)
+	m, err := NewManager(0.5, 0.5, 0, opts...)
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, m.Close())
+	})
+	return m, sys
+}
+
+func allocN(t *testing.T, m *Manager, size, n int) []unsafe.Pointer {
+	t.Helper()
+	ptrs := make([]unsafe.Pointer, n)
+	for i := range ptrs {
+		ptr, err := m.Alloc(size)
+		assert.NoError(t, err)
+		ptrs[i] = ptr
+	}
+	return ptrs
+}
+
+func TestFragmentation_Ratio(t *testing.T) {
+	assert.Equal(t, 0.0, Fragmentation{}.Ratio())
+	assert.True(t, math.IsInf(Fragmentation{FreeBytes: 1}.Ratio(), 1))
+	assert.Equal(t, 0.5, Fragmentation{FreeBytes: 1, UsedBytes: 2}.Ratio())
+	assert.True(t, Fragmentation{FreeBytes: 1, UsedBytes: 2}.Exceeds(0.25))
+	assert.False(t, Fragmentation{FreeBytes: 1, UsedBytes: 2}.Exceeds(0.5))
+	assert.False(t, Fragmentation{UsedBytes: 2}.Exceeds(0))
+}
+
+func TestManager_ScavengeSmall(t *testing.T) {
+	m, sys := newTestScavengeManager(t)
+	shard := m.sm.shards[common.SizeClass64B.Int()][0]
+	perChunk := shard.blocksPerChunk()
+
+	// Fill three chunks and keep one block of the middle chunk alive.
+	ptrs := allocN(t, m, common.B64, perChunk*3)
+	assert.Equal(t, int64(3), shard.pagesCount.Load())
+	live := ptrs[perChunk]
+	*(*uint64)(live) = 42
+	for _, ptr := range ptrs {
+		if ptr != live {
+			assert.NoError(t, m.Free(ptr, common.B64))
+		}
+	}
+
+	released := m.Scavenge()
+	assert.Equal(t, uint64(shard.chunkSize*2), released)
+	assert.Equal(t, shard.chunkSize*2, sys.ReleasedBytes())
+	assert.Equal(t, int64(1), shard.pagesCount.Load())
+	assert.Len(t, shard.released, 2)
+	assert.Equal(t, uint64(42), *(*uint64)(live))
+	assert.Equal(t, Fragmentation{
+		FreeBytes: int64((perChunk - 1) * common.B64),
+		UsedBytes: common.B64,
+	}, m.Fragmentation()[common.SizeClass64B])
+
+	// Released chunks are reused before new ones are mapped.
+	allocs, _ := sys.Calls()
+	allocN(t, m, common.B64, perChunk*3-1)
+	after, _ := sys.Calls()
+	assert.Equal(t, allocs, after)
+	assert.Empty(t, shard.released)
+
+	assert.Equal(t, ScavengeStats{Cycles: 1, ReleasedBytes: released}, m.ScavengeStats())
+}
+
+func TestManager_ScavengeForeignBlocks(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(16))
+	sel := &fixedSelector{}
+	m, _ := newTestScavengeManager(t, WithShardSelector(sel))
+	shards := m.sm.shards[common.SizeClass64B.Int()]
+	assert.GreaterOrEqual(t, len(shards), 2)
+	perChunk := shards[0].blocksPerChunk()
+
+	// Shard 1 maps chunks below and above the chunk of shard 0.
+	sel.idx = 1
+	below := allocN(t, m, common.B64, 1)[0]
+	sel.idx = 0
+	ptrs := allocN(t, m, common.B64, perChunk)
+	sel.idx = 1
+	above := allocN(t, m, common.B64, perChunk)[perChunk-1]
+	assert.Less(t, uintptr(below), uintptr(ptrs[0]))
+	assert.Greater(t, uintptr(above), uintptr(ptrs[perChunk-1]))
+
+	// Blocks are freed to the shard of the caller, the blocks of shard 1 must neither
+	// be looked up in nor counted against the chunk of shard 0.
+	sel.idx = 0
+	live := ptrs[0]
+	*(*uint64)(live) = 42
+	for _, ptr := range append(ptrs[1:], below, above) {
+		assert.NoError(t, m.Free(ptr, common.B64))
+	}
+	assert.Zero(t, m.Scavenge())
+	assert.Equal(t, uint64(42), *(*uint64)(live))
+	assert.Equal(t, int64(1), shards[0].pagesCount.Load())
+}
+
+func TestManager_ScavengeRatio(t *testing.T) {
+	m, sys := newTestScavengeManager(t, WithScavenger(4, 0, false))
+	shard := m.sm.shards[common.SizeClass64B.Int()][0]
+	perChunk := shard.blocksPerChunk()
+
+	// Two free chunks against one used chunk stays below the ratio.
+	ptrs := allocN(t, m, common.B64, perChunk*3)
+	for _, ptr := range ptrs[perChunk:] {
+		assert.NoError(t, m.Free(ptr, common.B64))
+	}
+	assert.Zero(t, m.Scavenge())
+	assert.Zero(t, sys.ReleasedBytes())
+
+	for _, ptr := range ptrs[:perChunk] {
+		assert.NoError(t, m.Free(ptr, common.B64))
+	}
+	assert.Equal(t, uint64(shard.chunkSize*3), m.Scavenge())
+}
+
+func TestManager_ScavengeMediumAndLarge(t *testing.T) {
+	m, sys := newTestScavengeManager(t)
+
+	medium := allocN(t, m, common.KB*16, minSpanObjects*2)
+	large, err := m.Alloc(common.MB)
+	assert.NoError(t, err)
+	for _, ptr := range medium {
+		assert.NoError(t, m.Free(ptr, common.KB*16))
+	}
+	assert.NoError(t, m.Free(large, common.MB))
+
+	// The freed spans coalesce with the rest of the arena, so the whole arena is
+	// released along with the large region, and a second pass has nothing left to do.
+	assert.Equal(t, uint64(heapArenaSize+common.MB), m.Scavenge())
+	assert.Equal(t, heapArenaSize+common.MB, sys.ReleasedBytes())
+	assert.Zero(t, m.Scavenge())
+
+	// Released memory is handed out again without remapping.
+	allocs, _ := sys.Calls()
+	ptr, err := m.Alloc(common.MB)
+	assert.NoError(t, err)
+	assert.Equal(t, large, ptr)
+	allocN(t, m, common.KB*16, minSpanObjects)
+	after, _ := sys.Calls()
+	assert.Equal(t, allocs, after)
+}
+
+func TestManager_BackgroundScavenger(t *testing.T) {
+	m, sys := newTestScavengeManager(t, WithScavenger(0.5, time.Millisecond, true))
+	ptrs := allocN(t, m, common.B64, 64)
+	for _, ptr := range ptrs {
+		assert.NoError(t, m.Free(ptr, common.B64))
+	}
+
+	assert.Eventually(t, func() bool {
+		return sys.ReleasedBytes() > 0
+	}, time.Second, time.Millisecond)
+	assert.NoError(t, m.Close())
+	assert.NoError(t, m.Close())
+	assert.Positive(t, m.ScavengeStats().Cycles)
+}
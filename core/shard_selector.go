@@ -0,0 +1,105 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	_ "unsafe" // required by go:linkname
+)
+
+// ShardSelector chooses the shard that serves an allocation of the calling goroutine.
+// Implementations must be safe for concurrent use.
+type ShardSelector interface {
+	// Select returns a shard index in [0, n), n is always positive.
+	Select(n int) int
+}
+
+//go:linkname procPin runtime.procPin
+func procPin() int
+
+//go:linkname procUnpin runtime.procUnpin
+func procUnpin()
+
+// ProcPinSelector maps the calling goroutine to the shard of the P (logical processor)
+// it is running on, in the same way sync.Pool picks its per-P local pool. Goroutines
+// running on the same P share a shard, so the free list heads stay in that core's cache.
+type ProcPinSelector struct{}
+
+func NewProcPinSelector() *ProcPinSelector {
+	return &ProcPinSelector{}
+}
+
+func (p *ProcPinSelector) Select(n int) int {
+	pid := procPin()
+	procUnpin()
+	return pid % n
+}
+
+// GoroutineHashSelector hashes the id of the calling goroutine, so a goroutine keeps
+// hitting the same shard for its whole lifetime regardless of the P it runs on. Reading
+// the goroutine id requires formatting the stack header, so it is noticeably slower than
+// ProcPinSelector and is mainly useful for long-lived worker goroutines.
+type GoroutineHashSelector struct{}
+
+func NewGoroutineHashSelector() *GoroutineHashSelector {
+	return &GoroutineHashSelector{}
+}
+
+func (g *GoroutineHashSelector) Select(n int) int {
+	// Fibonacci hashing spreads consecutive goroutine ids over the shards.
+	const golden = 0x9E3779B97F4A7C15
+	return int((goroutineID() * golden >> 32) % uint64(n))
+}
+
+// goroutineID parses the id of the calling goroutine from the "goroutine N [" stack header.
+func goroutineID() uint64 {
+	const headerSize = 64
+	var buf [headerSize]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	b = bytes.TrimPrefix(b, []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i > 0 {
+		b = b[:i]
+	}
+
+	id, _ := strconv.ParseUint(string(b), 10, 64)
+	return id
+}
+
+// RoundRobinSelector spreads consecutive calls evenly over the shards without any
+// affinity. It is the cheapest selector and is a good fit when allocations are made
+// by short-lived goroutines.
+type RoundRobinSelector struct {
+	counter atomic.Uint64
+}
+
+func NewRoundRobinSelector() *RoundRobinSelector {
+	return &RoundRobinSelector{}
+}
+
+func (r *RoundRobinSelector) Select(n int) int {
+	return int(r.counter.Add(1) % uint64(n))
+}
+
+// ShardStats reports how the allocations of a shard were served.
+type ShardStats struct {
+	// Hits is the number of allocations served from the shard's own free lists.
+	Hits uint64
+	// Steals is the number of allocations the shard served by taking a block from a
+	// neighbour shard because its own free lists were empty.
+	Steals uint64
+}
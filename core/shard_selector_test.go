@@ -0,0 +1,99 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/TimeWtr/TurboAlloc/common"
+	"github.com/stretchr/testify/assert"
+)
+
+// fixedSelector always selects the same shard, letting tests drive a specific shard.
+type fixedSelector struct {
+	idx int
+}
+
+func (f *fixedSelector) Select(n int) int {
+	return f.idx % n
+}
+
+func TestShardSelectors_InRange(t *testing.T) {
+	selectors := map[string]ShardSelector{
+		"procPin":       NewProcPinSelector(),
+		"goroutineHash": NewGoroutineHashSelector(),
+		"roundRobin":    NewRoundRobinSelector(),
+	}
+
+	for name, sel := range selectors {
+		t.Run(name, func(t *testing.T) {
+			var wg sync.WaitGroup
+			for g := 0; g < 8; g++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for _, n := range []int{1, 3, 16} {
+						idx := sel.Select(n)
+						assert.GreaterOrEqual(t, idx, 0)
+						assert.Less(t, idx, n)
+					}
+				}()
+			}
+			wg.Wait()
+		})
+	}
+}
+
+func TestRoundRobinSelector_Spreads(t *testing.T) {
+	sel := NewRoundRobinSelector()
+	counts := make([]int, 4)
+	for i := 0; i < 400; i++ {
+		counts[sel.Select(len(counts))]++
+	}
+	assert.Equal(t, []int{100, 100, 100, 100}, counts)
+}
+
+func TestGoroutineHashSelector_StableWithinGoroutine(t *testing.T) {
+	sel := NewGoroutineHashSelector()
+	assert.NotZero(t, goroutineID())
+	first := sel.Select(64)
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, first, sel.Select(64))
+	}
+}
+
+func TestSmallManager_StealsFromNeighbour(t *testing.T) {
+	sel := &fixedSelector{}
+	sm := newSmallManager(common.SmallSizeClassNums*2, sel, newTestSyscall(t))
+	sc := common.SizeClass64B
+	assert.Len(t, sm.shards[sc.Int()], 2)
+
+	// Shard 0 maps a chunk and frees a block onto its own hot list.
+	ptr, err := sm.alloc(sc)
+	assert.NoError(t, err)
+	assert.NoError(t, sm.free(ptr, sc))
+
+	// Shard 1 is empty and must steal from shard 0 instead of mapping its own chunk.
+	sel.idx = 1
+	stolen, err := sm.alloc(sc)
+	assert.NoError(t, err)
+	assert.Equal(t, ptr, stolen)
+
+	stats := sm.shardStats()[sc]
+	assert.Equal(t, ShardStats{Hits: 1}, stats[0])
+	assert.Equal(t, ShardStats{Steals: 1}, stats[1])
+	assert.Equal(t, int64(0), sm.shards[sc.Int()][1].pagesCount.Load())
+}
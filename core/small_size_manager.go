@@ -15,14 +15,21 @@
 package core
 
 import (
+	"fmt"
+	"sort"
+	"sync"
 	"sync/atomic"
 	"unsafe"
 
 	"github.com/TimeWtr/TurboAlloc/common"
+	"github.com/TimeWtr/TurboAlloc/syscall"
 )
 
 const SmallShardNums = 16
 
+// cacheLineSize is the assumed size of a CPU cache line, used to pad per-shard counters.
+const cacheLineSize = 64
+
 type SmallManager struct {
 	// shards is a map of pointers to Shard, representing the individual memory shards managed
 	// within the SizeClassUint structure. Each shard contains separate hot and cold paths for
@@ -34,21 +41,29 @@ type SmallManager struct {
 	// counter is an atomic integer that tracks the total number of operations or events processed
 	// by the SmallManager.
 	counter atomic.Int64
+	// selector picks the shard serving the calling goroutine.
+	selector ShardSelector
+	// zeroOnFree clears blocks when they are returned.
+	zeroOnFree bool
+	// pageMap holds the state bits flagging the blocks handed out.
+	pageMap *pageMap
 }
 
 func (s *SmallManager) OnSizeClassChange(_ common.SizeCategory, _, _ common.SizeClassDetail) {
 }
 
-func newSmallManager(shardCount int) *SmallManager {
-	sm := &SmallManager{}
+func newSmallManager(shardCount int, selector ShardSelector, sys syscall.Syscall) *SmallManager {
+	sm := &SmallManager{selector: selector}
 
-	singleSizeShardCount := shardCount / common.SmallSizeClassNums
+	singleSizeShardCount := max(shardCount/common.SmallSizeClassNums, 1)
 	smallClasses := common.SizeClassSizes[common.SmallSizeCategory]
 	sm.shards = make(map[int][]*SmallSizeShard, common.SmallSizeClassNums)
 	for sizeClass, size := range smallClasses {
 		shards := make([]*SmallSizeShard, 0, singleSizeShardCount)
 		for i := 0; i < singleSizeShardCount; i++ {
-			shards = append(shards, newSmallSizeShard(uint64(size)))
+			shard := newSmallSizeShard(uint64(size), sys)
+			shard.class, shard.index = sizeClass, i
+			shards = append(shards, shard)
 		}
 		sm.shards[sizeClass.Int()] = shards
 	}
@@ -56,33 +71,586 @@ func newSmallManager(shardCount int) *SmallManager {
 	return sm
 }
 
+// alloc serves the allocation from the shard chosen by the selector. When the local shard
+// has no free block it steals one from the neighbour shards before mapping a new chunk,
+// so a burst on one core does not map memory while other shards sit on free blocks.
+func (s *SmallManager) alloc(sc common.SizeClass) (unsafe.Pointer, error) {
+	ptr, _, err := s.allocFresh(sc)
+	return ptr, err
+}
+
+// allocFresh is alloc also reporting whether the block comes from the cold list, in
+// which case only its free list link was written since its chunk was mapped.
+func (s *SmallManager) allocFresh(sc common.SizeClass) (unsafe.Pointer, bool, error) {
+	s.counter.Add(1)
+	shards := s.shards[sc.Int()]
+	idx := s.selector.Select(len(shards))
+	local := shards[idx]
+	if b, fresh := local.popLocal(); b != nil {
+		local.hits.Add(1)
+		return s.account(unsafe.Pointer(b), sc), fresh, nil
+	}
+
+	for i := 1; i < len(shards); i++ {
+		if b, fresh := shards[(idx+i)%len(shards)].popLocal(); b != nil {
+			local.steals.Add(1)
+			return s.account(unsafe.Pointer(b), sc), fresh, nil
+		}
+	}
+
+	ptr, err := local.refill()
+	if err != nil {
+		return nil, false, err
+	}
+
+	local.hits.Add(1)
+	return s.account(ptr, sc), true, nil
+}
+
+func (s *SmallManager) account(ptr unsafe.Pointer, sc common.SizeClass) unsafe.Pointer {
+	s.size.Add(uint64(sc.Size()))
+	s.pageMap.markAllocated(uintptr(ptr))
+	return ptr
+}
+
+// allocBatch fills out with blocks of the class. Whole chains are taken from the free
+// lists of the caller's shard and then of its neighbours, and the remainder is carved
+// from new chunks. It returns the number of blocks written to out, which is only short
+// of len(out) when mapping a chunk failed.
+func (s *SmallManager) allocBatch(sc common.SizeClass, out []unsafe.Pointer) (int, error) {
+	s.counter.Add(1)
+	shards := s.shards[sc.Int()]
+	idx := s.selector.Select(len(shards))
+	local := shards[idx]
+	n := local.takeLocal(out)
+	local.hits.Add(uint64(n))
+	for i := 1; i < len(shards) && n < len(out); i++ {
+		stolen := shards[(idx+i)%len(shards)].takeLocal(out[n:])
+		local.steals.Add(uint64(stolen))
+		n += stolen
+	}
+
+	var err error
+	for n < len(out) && err == nil {
+		var carved int
+		carved, err = local.refillBatch(out[n:])
+		local.hits.Add(uint64(carved))
+		n += carved
+	}
+
+	s.pageMap.markAllocatedRun(out[:n])
+	s.size.Add(uint64(n * sc.Size()))
+	return n, err
+}
+
+// freeBatch returns the blocks to the hot list of the caller's shard with a single CAS.
+// When a block is rejected the ones preceding it are still freed, it returns their
+// number along with the error.
+func (s *SmallManager) freeBatch(sc common.SizeClass, ptrs []unsafe.Pointer) (int, error) {
+	var err error
+	n := len(ptrs)
+	for i, ptr := range ptrs {
+		if err = checkStart(ptr, sc); err != nil {
+			n = i
+			break
+		}
+	}
+
+	if freed := s.pageMap.markFreeRun(ptrs[:n]); freed < n {
+		n, err = freed, fmt.Errorf("%w: %p", ErrDoubleFree, ptrs[freed])
+	}
+
+	s.pushBatch(sc, ptrs[:n])
+	return n, err
+}
+
+// pushBatch links the blocks into a chain and pushes it on the hot list of the caller's shard.
+func (s *SmallManager) pushBatch(sc common.SizeClass, ptrs []unsafe.Pointer) {
+	if len(ptrs) == 0 {
+		return
+	}
+
+	for i, ptr := range ptrs {
+		if s.zeroOnFree {
+			clear(unsafe.Slice((*byte)(ptr), sc.Size()))
+		}
+		if i > 0 {
+			(*block)(ptrs[i-1]).next = uintptr(ptr)
+		}
+	}
+
+	shards := s.shards[sc.Int()]
+	shard := shards[s.selector.Select(len(shards))]
+	shard.hotTop.pushChain((*block)(ptrs[0]), (*block)(ptrs[len(ptrs)-1]))
+	shard.hotCount.Add(int64(len(ptrs)))
+	shard.frees.Add(uint64(len(ptrs)))
+	s.size.Add(^uint64(len(ptrs)*sc.Size() - 1))
+}
+
+// free returns a block to the hot list of the caller's shard.
+func (s *SmallManager) free(ptr unsafe.Pointer, sc common.SizeClass) error {
+	if err := s.release(ptr, sc); err != nil {
+		return err
+	}
+
+	shards := s.shards[sc.Int()]
+	if s.zeroOnFree {
+		clear(unsafe.Slice((*byte)(ptr), sc.Size()))
+	}
+	if err := shards[s.selector.Select(len(shards))].free(ptr); err != nil {
+		return err
+	}
+
+	s.size.Add(^uint64(sc.Size() - 1))
+	return nil
+}
+
+// release checks that ptr is the start of a block of the class that is handed out and
+// clears its state bit.
+func (s *SmallManager) release(ptr unsafe.Pointer, sc common.SizeClass) error {
+	if err := checkStart(ptr, sc); err != nil {
+		return err
+	}
+
+	if !s.pageMap.markFree(uintptr(ptr)) {
+		return fmt.Errorf("%w: %p", ErrDoubleFree, ptr)
+	}
+
+	return nil
+}
+
+// checkStart checks that ptr may be the start of a block of the class, chunks are page
+// aligned and small classes are powers of two that never exceed a page.
+func checkStart(ptr unsafe.Pointer, sc common.SizeClass) error {
+	if uintptr(ptr)&uintptr(sc.Size()-1) != 0 {
+		return fmt.Errorf("%w: %p is not the start of a %s block", ErrInvalidPointer, ptr, sc)
+	}
+
+	return nil
+}
+
+// fragmentation returns the free and used bytes of every small size class.
+func (s *SmallManager) fragmentation() map[common.SizeClass]Fragmentation {
+	frag := make(map[common.SizeClass]Fragmentation, len(s.shards))
+	for sc, shards := range s.shards {
+		var f Fragmentation
+		for _, shard := range shards {
+			f = f.add(shard.fragmentation())
+		}
+		frag[common.SizeClass(sc)] = f
+	}
+
+	return frag
+}
+
+// classStats aggregates the counters of every shard of the class.
+func (s *SmallManager) classStats(sc common.SizeClass) ClassStats {
+	var allocs, frees, refills uint64
+	var cached, mapped int64
+	for _, shard := range s.shards[sc.Int()] {
+		allocs += shard.hits.Load() + shard.steals.Load()
+		frees += shard.frees.Load()
+		refills += shard.refills.Load()
+		cached += shard.hotCount.Load() + shard.coldCount.Load()
+		mapped += shard.mappedBytes()
+	}
+
+	objects := int64(allocs - frees)
+	return ClassStats{Class: sc, AllocStats: AllocStats{
+		InUseObjects:  objects,
+		InUseBytes:    objects * int64(sc.Size()),
+		CachedObjects: cached,
+		CachedBytes:   cached * int64(sc.Size()),
+		Allocs:        allocs,
+		Frees:         frees,
+		Refills:       refills,
+		MappedBytes:   mapped,
+	}}
+}
+
+// scavenge releases the fully free chunks of every shard of the class.
+func (s *SmallManager) scavenge(sc common.SizeClass, lazy bool) int64 {
+	var released int64
+	for _, shard := range s.shards[sc.Int()] {
+		released += shard.scavenge(lazy)
+	}
+
+	return released
+}
+
+func (s *SmallManager) shardStats() map[common.SizeClass][]ShardStats {
+	stats := make(map[common.SizeClass][]ShardStats, len(s.shards))
+	for sc, shards := range s.shards {
+		classStats := make([]ShardStats, len(shards))
+		for i, shard := range shards {
+			classStats[i] = ShardStats{Hits: shard.hits.Load(), Steals: shard.steals.Load()}
+		}
+		stats[common.SizeClass(sc)] = classStats
+	}
+
+	return stats
+}
+
 type SmallSizeShard struct {
-	// hotTop is an atomic pointer to a block, representing the top of a hot
-	// path in memory management operations.
-	hotTop atomic.Pointer[block]
+	// hotTop is a lock-free stack of blocks returned by Free. They were touched recently
+	// and are likely still in the CPU cache, so they are handed out first.
+	hotTop taggedStack
 	// hotCount is an atomic counter that tracks the number of active or "hot"
 	// memory blocks in a shard's hot path.
 	hotCount atomic.Int64
-	// coldTop is an atomic pointer to a block, representing the top of a cold
-	// path in memory management operations.
-	coldTop atomic.Pointer[block]
+	// coldTop is a lock-free stack of blocks carved from freshly mapped pages that have
+	// never been handed out.
+	coldTop taggedStack
 	// coldCount is an atomic counter that tracks the number of inactive or "cold"
 	// memory blocks in a shard's cold path.
 	coldCount atomic.Int64
 
-	pages      []*unsafe.Pointer
+	// mu serializes refills so that concurrent misses map a single chunk, and protects pages.
+	mu sync.Mutex
+	// pages holds the start address of every chunk carved by this shard.
+	pages      []unsafe.Pointer
 	pagesCount atomic.Int64
+	// released holds chunks whose memory was returned to the OS by the scavenger. They
+	// stay mapped and are reused by refill before mapping new chunks.
+	released []releasedChunk
 	// blockSize indicates the size of a specific block in a shard, in bytes, such
 	// as 8Bytes, 16Bytes
 	blockSize uint64
+	// chunkSize is the number of bytes mapped by a single refill.
+	chunkSize int
+	// sys maps the refill chunks.
+	sys syscall.Syscall
+	// class and index identify the shard in pageMap, which records the owner of every
+	// chunk carved by the shard.
+	class   common.SizeClass
+	index   int
+	pageMap *pageMap
+
+	// hits counts allocations served from this shard's own lists or refills.
+	hits atomic.Uint64
+	// steals counts allocations of this shard's callers served by a neighbour shard.
+	steals atomic.Uint64
+	// frees counts blocks returned to this shard.
+	frees atomic.Uint64
+	// refills counts the chunks carved by this shard.
+	refills atomic.Uint64
+	// _ keeps the counters of adjacent shards off a shared cache line.
+	_ [cacheLineSize]byte
 }
 
-func newSmallSizeShard(blockSize uint64) *SmallSizeShard {
+// releasedChunk is a chunk returned to the OS by the scavenger.
+type releasedChunk struct {
+	ptr unsafe.Pointer
+	// lazy is set when the chunk was released with MADV_FREE, its pages keep their
+	// contents until the kernel reclaims them.
+	lazy bool
+}
+
+// minRefillBlocks is the minimum number of blocks carved out of one refill chunk, so that
+// the larger small classes do not pay a mmap per handful of allocations.
+const minRefillBlocks = 16
+
+func newSmallSizeShard(blockSize uint64, sys syscall.Syscall) *SmallSizeShard {
 	return &SmallSizeShard{
+		sys:       sys,
 		blockSize: blockSize,
+		chunkSize: syscall.AlignUp(int(blockSize)*minRefillBlocks, sys.PageSize()),
 	}
 }
 
-type block struct {
-	next *block
+// alloc pops a block from the hot list, then from the cold list, and refills the shard
+// from a freshly mapped chunk when both are empty.
+func (s *SmallSizeShard) alloc() (unsafe.Pointer, error) {
+	if b, _ := s.popLocal(); b != nil {
+		return unsafe.Pointer(b), nil
+	}
+
+	return s.refill()
+}
+
+// popLocal pops a block from the hot list, falling back to the cold list, and reports
+// whether the block came from the cold list. It returns nil when both lists are empty.
+func (s *SmallSizeShard) popLocal() (*block, bool) {
+	if b := s.popHot(); b != nil {
+		return b, false
+	}
+
+	b := s.popCold()
+	return b, b != nil
+}
+
+// free pushes a block onto the hot list.
+func (s *SmallSizeShard) free(ptr unsafe.Pointer) error {
+	s.hotTop.push((*block)(ptr))
+	s.hotCount.Add(1)
+	s.frees.Add(1)
+	return nil
+}
+
+func (s *SmallSizeShard) popHot() *block {
+	b := s.hotTop.pop()
+	if b != nil {
+		s.hotCount.Add(-1)
+	}
+
+	return b
+}
+
+func (s *SmallSizeShard) popCold() *block {
+	b := s.coldTop.pop()
+	if b != nil {
+		s.coldCount.Add(-1)
+	}
+
+	return b
+}
+
+// takeLocal fills out from the hot list and then from the cold list, taking each list's
+// blocks as a chain, and returns the number of blocks written.
+func (s *SmallSizeShard) takeLocal(out []unsafe.Pointer) int {
+	n := takeChain(&s.hotTop, &s.hotCount, out)
+	return n + takeChain(&s.coldTop, &s.coldCount, out[n:])
+}
+
+// takeChain fills out with blocks of stack. The stack is detached with one CAS, the
+// blocks out can not hold are pushed back as a chain.
+func takeChain(stack *taggedStack, count *atomic.Int64, out []unsafe.Pointer) int {
+	if len(out) == 0 {
+		return 0
+	}
+
+	n := 0
+	b := stack.popAll()
+	for b != nil && n < len(out) {
+		out[n] = unsafe.Pointer(b)
+		n++
+		if b.next == 0 {
+			b = nil
+		} else {
+			b = blockAt(b.next)
+		}
+	}
+
+	if b != nil {
+		stack.pushList(b)
+	}
+	count.Add(-int64(n))
+	return n
+}
+
+// refill maps a new chunk, carves it into blockSize blocks, returns the first block to
+// the caller and publishes the rest on the cold list with a single CAS.
+func (s *SmallSizeShard) refill() (unsafe.Pointer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Another goroutine may have refilled the shard while we were waiting for the lock.
+	if b := s.popCold(); b != nil {
+		return unsafe.Pointer(b), nil
+	}
+
+	var out [1]unsafe.Pointer
+	if _, err := s.carve(out[:]); err != nil {
+		return nil, err
+	}
+
+	return out[0], nil
+}
+
+// refillBatch is refill handing out up to len(out) blocks, it returns the number of
+// blocks written to out.
+func (s *SmallSizeShard) refillBatch(out []unsafe.Pointer) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if n := takeChain(&s.coldTop, &s.coldCount, out); n > 0 {
+		return n, nil
+	}
+
+	return s.carve(out)
+}
+
+// carve maps a new chunk and splits it into blocks, the first ones fill out and the
+// rest are published on the cold list with a single CAS. It must be called with mu held.
+func (s *SmallSizeShard) carve(out []unsafe.Pointer) (int, error) {
+	chunk, err := s.mapChunk()
+	if err != nil {
+		return 0, err
+	}
+
+	s.pages = append(s.pages, chunk)
+	s.pagesCount.Add(1)
+	s.refills.Add(1)
+	s.pageMap.set(uintptr(chunk), s.chunkSize, Owner{
+		Class:    s.class,
+		Category: common.SmallSizeCategory,
+		Shard:    s.index,
+	})
+
+	base, size := uintptr(chunk), uintptr(s.blockSize)
+	total := uintptr(s.chunkSize) / size
+	n := min(total, uintptr(len(out)))
+	for i := uintptr(0); i < n; i++ {
+		out[i] = addrToPtr(base + i*size)
+	}
+
+	if n < total {
+		first := base + n*size
+		last := base + (total-1)*size
+		for addr := first; addr < last; addr += size {
+			blockAt(addr).next = addr + size
+		}
+		s.coldTop.pushChain(blockAt(first), blockAt(last))
+		s.coldCount.Add(int64(total - n))
+	}
+
+	return int(n), nil
+}
+
+// mapChunk returns a chunk released by the scavenger, or maps a new one. Lazily released
+// chunks are cleared so that the blocks of the cold list are always zero.
+func (s *SmallSizeShard) mapChunk() (unsafe.Pointer, error) {
+	if n := len(s.released); n > 0 {
+		chunk := s.released[n-1]
+		s.released = s.released[:n-1]
+		if chunk.lazy {
+			clear(unsafe.Slice((*byte)(chunk.ptr), s.chunkSize))
+		}
+		return chunk.ptr, nil
+	}
+
+	chunk, err := s.sys.AllocPages(s.chunkSize)
+	if err != nil {
+		return nil, err
+	}
+
+	if base := uintptr(chunk); base+uintptr(s.chunkSize) > maxBlockAddr {
+		_ = s.sys.FreePages(chunk, s.chunkSize)
+		return nil, fmt.Errorf("chunk address %#x exceeds %d bits", base, addrBits)
+	}
+
+	return chunk, nil
+}
+
+// mappedBytes returns the bytes of the chunks mapped by the shard, including the ones
+// released by the scavenger.
+func (s *SmallSizeShard) mappedBytes() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return int64(len(s.pages)+len(s.released)) * int64(s.chunkSize)
+}
+
+// blocksPerChunk returns the number of blocks carved out of one chunk.
+func (s *SmallSizeShard) blocksPerChunk() int {
+	return s.chunkSize / int(s.blockSize)
+}
+
+// fragmentation returns the bytes of the shard's chunks sitting on the free lists and
+// the bytes handed out.
+func (s *SmallSizeShard) fragmentation() Fragmentation {
+	capacity := s.pagesCount.Load() * int64(s.blocksPerChunk()) * int64(s.blockSize)
+	free := (s.hotCount.Load() + s.coldCount.Load()) * int64(s.blockSize)
+	return Fragmentation{FreeBytes: free, UsedBytes: max(capacity-free, 0)}
+}
+
+// scavenge returns the chunks whose blocks are all on the free lists to the OS and
+// drops them from pages, it returns the number of bytes released. Both lists are
+// drained while the scan runs, concurrent allocations meanwhile steal from neighbour
+// shards or wait for the refill lock.
+func (s *SmallSizeShard) scavenge(lazy bool) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.pages) == 0 {
+		return 0
+	}
+
+	hot := drainStack(s.popHot)
+	cold := drainStack(s.popCold)
+	sort.Slice(s.pages, func(i, j int) bool {
+		return uintptr(s.pages[i]) < uintptr(s.pages[j])
+	})
+
+	freeBlocks := make([]int, len(s.pages))
+	for _, list := range [][]uintptr{hot, cold} {
+		for _, addr := range list {
+			if i := s.chunkOf(addr); i >= 0 {
+				freeBlocks[i]++
+			}
+		}
+	}
+
+	var released int64
+	dropped := make([]bool, len(s.pages))
+	for i, chunk := range s.pages {
+		if freeBlocks[i] == s.blocksPerChunk() && s.sys.ReleasePages(chunk, s.chunkSize, lazy) == nil {
+			dropped[i] = true
+			released += int64(s.chunkSize)
+		}
+	}
+
+	keep := func(addr uintptr) bool {
+		i := s.chunkOf(addr)
+		return i < 0 || !dropped[i]
+	}
+	pushStack(&s.hotTop, &s.hotCount, filterBlocks(hot, keep))
+	pushStack(&s.coldTop, &s.coldCount, filterBlocks(cold, keep))
+
+	kept := s.pages[:0]
+	for i, chunk := range s.pages {
+		if dropped[i] {
+			s.released = append(s.released, releasedChunk{ptr: chunk, lazy: lazy})
+			continue
+		}
+		kept = append(kept, chunk)
+	}
+	s.pages = kept
+	s.pagesCount.Store(int64(len(kept)))
+	return released
+}
+
+// chunkOf returns the index in the address-sorted pages of the chunk containing addr,
+// or -1 when addr belongs to a chunk of another shard. Blocks are freed to the shard
+// of the caller, so the free lists also hold blocks of other shards' chunks.
+func (s *SmallSizeShard) chunkOf(addr uintptr) int {
+	i := sort.Search(len(s.pages), func(i int) bool { return uintptr(s.pages[i]) > addr }) - 1
+	if i < 0 || addr >= uintptr(s.pages[i])+uintptr(s.chunkSize) {
+		return -1
+	}
+
+	return i
+}
+
+// drainStack pops every block with pop and returns their addresses.
+func drainStack(pop func() *block) []uintptr {
+	var addrs []uintptr
+	for b := pop(); b != nil; b = pop() {
+		addrs = append(addrs, uintptr(unsafe.Pointer(b)))
+	}
+
+	return addrs
+}
+
+func filterBlocks(addrs []uintptr, keep func(uintptr) bool) []uintptr {
+	kept := addrs[:0]
+	for _, addr := range addrs {
+		if keep(addr) {
+			kept = append(kept, addr)
+		}
+	}
+
+	return kept
+}
+
+// pushStack links addrs into a chain and publishes it on stack with a single CAS.
+func pushStack(stack *taggedStack, count *atomic.Int64, addrs []uintptr) {
+	if len(addrs) == 0 {
+		return
+	}
+
+	for i := 0; i < len(addrs)-1; i++ {
+		blockAt(addrs[i]).next = addrs[i+1]
+	}
+	stack.pushChain(blockAt(addrs[0]), blockAt(addrs[len(addrs)-1]))
+	count.Add(int64(len(addrs)))
 }
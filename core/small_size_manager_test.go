@@ -0,0 +1,260 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"sync"
+	"testing"
+	"unsafe"
+
+	"github.com/TimeWtr/TurboAlloc/common"
+	"github.com/TimeWtr/TurboAlloc/syscall"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSmallSizeShard_RefillCarvesChunk(t *testing.T) {
+	s := newSmallSizeShard(common.B64, newTestSyscall(t))
+	ptr, err := s.alloc()
+	assert.NoError(t, err)
+	assert.NotNil(t, ptr)
+	assert.Equal(t, int64(1), s.pagesCount.Load())
+	assert.Equal(t, int64(s.chunkSize/common.B64-1), s.coldCount.Load())
+	assert.Equal(t, int64(0), s.hotCount.Load())
+}
+
+func TestSmallSizeShard_FreeIsReusedFromHotList(t *testing.T) {
+	s := newSmallSizeShard(common.B32, newTestSyscall(t))
+	ptr, err := s.alloc()
+	assert.NoError(t, err)
+	assert.NoError(t, s.free(ptr))
+	assert.Equal(t, int64(1), s.hotCount.Load())
+
+	again, err := s.alloc()
+	assert.NoError(t, err)
+	assert.Equal(t, ptr, again)
+	assert.Equal(t, int64(0), s.hotCount.Load())
+}
+
+func TestSmallSizeShard_BlocksAreDistinct(t *testing.T) {
+	s := newSmallSizeShard(common.B128, newTestSyscall(t))
+	total := s.chunkSize / common.B128 * 3
+	seen := make(map[uintptr]struct{}, total)
+	for i := 0; i < total; i++ {
+		ptr, err := s.alloc()
+		assert.NoError(t, err)
+		addr := uintptr(ptr)
+		_, dup := seen[addr]
+		assert.False(t, dup, "block %#x handed out twice", addr)
+		assert.Equal(t, uintptr(0), addr%common.B128)
+		seen[addr] = struct{}{}
+	}
+	assert.Equal(t, int64(3), s.pagesCount.Load())
+}
+
+func TestSmallSizeShard_ConcurrentAllocFree(t *testing.T) {
+	const (
+		goroutines = 8
+		iterations = 2000
+		batch      = 16
+	)
+
+	s := newSmallSizeShard(common.B16, newTestSyscall(t))
+	var (
+		wg   sync.WaitGroup
+		live sync.Map
+	)
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(id byte) {
+			defer wg.Done()
+			ptrs := make([]unsafe.Pointer, 0, batch)
+			for i := 0; i < iterations; i++ {
+				ptr, err := s.alloc()
+				if !assert.NoError(t, err) {
+					return
+				}
+				if _, loaded := live.LoadOrStore(uintptr(ptr), struct{}{}); loaded {
+					t.Errorf("block %p handed out to two owners", ptr)
+					return
+				}
+				data := unsafe.Slice((*byte)(ptr), common.B16)
+				for j := range data {
+					data[j] = id
+				}
+				ptrs = append(ptrs, ptr)
+				if len(ptrs) < batch {
+					continue
+				}
+				for _, p := range ptrs {
+					for _, v := range unsafe.Slice((*byte)(p), common.B16) {
+						assert.Equal(t, id, v)
+					}
+					live.Delete(uintptr(p))
+					assert.NoError(t, s.free(p))
+				}
+				ptrs = ptrs[:0]
+			}
+		}(byte(g))
+	}
+	wg.Wait()
+}
+
+func TestTaggedStack_TagDefeatsABA(t *testing.T) {
+	s := newSmallSizeShard(common.B8, newTestSyscall(t))
+	a, err := s.alloc()
+	assert.NoError(t, err)
+	b, err := s.alloc()
+	assert.NoError(t, err)
+
+	var st taggedStack
+	st.push((*block)(b))
+	st.push((*block)(a))
+	stale := st.head.Load()
+
+	// A concurrent thread pops a and b, then pushes a back: the top address is the
+	// same as before but the head must differ so a stale CAS fails.
+	assert.Equal(t, a, unsafe.Pointer(st.pop()))
+	assert.Equal(t, b, unsafe.Pointer(st.pop()))
+	st.push((*block)(a))
+	assert.Equal(t, stale&addrMask, st.head.Load()&addrMask)
+	assert.NotEqual(t, stale, st.head.Load())
+	assert.False(t, st.head.CompareAndSwap(stale, packHead(uintptr(b), stale>>addrBits+1)))
+}
+
+func TestTaggedStack_PopAllPushList(t *testing.T) {
+	s := newSmallSizeShard(common.B8, newTestSyscall(t))
+	blocks := make([]unsafe.Pointer, 4)
+	for i := range blocks {
+		ptr, err := s.alloc()
+		assert.NoError(t, err)
+		blocks[i] = ptr
+	}
+
+	var st taggedStack
+	st.push((*block)(blocks[1]))
+	st.push((*block)(blocks[0]))
+	top := st.popAll()
+	assert.Equal(t, blocks[0], unsafe.Pointer(top))
+	assert.Nil(t, st.pop())
+
+	// A block pushed while the chain was detached ends up in front of it.
+	st.push((*block)(blocks[2]))
+	st.pushList(top)
+	for _, want := range []unsafe.Pointer{blocks[2], blocks[0], blocks[1]} {
+		assert.Equal(t, want, unsafe.Pointer(st.pop()))
+	}
+	assert.Nil(t, st.pop())
+	assert.Nil(t, st.popAll())
+}
+
+func TestSmallManager_AllocFreeBatch(t *testing.T) {
+	m, sys := newTestScavengeManager(t)
+	shard := m.sm.shards[common.SizeClass64B.Int()][0]
+	perChunk := shard.blocksPerChunk()
+
+	// A batch spanning several chunks carves them directly.
+	out := make([]unsafe.Pointer, perChunk*2+perChunk/2)
+	assert.NoError(t, m.AllocBatch(common.B64, out))
+	seen := make(map[unsafe.Pointer]bool, len(out))
+	for _, ptr := range out {
+		assert.False(t, seen[ptr])
+		seen[ptr] = true
+	}
+	assert.Equal(t, int64(3), shard.pagesCount.Load())
+	assert.Equal(t, int64(perChunk/2), shard.coldCount.Load())
+
+	freed, err := m.FreeBatch(common.B64, out)
+	assert.NoError(t, err)
+	assert.Equal(t, len(out), freed)
+	assert.Equal(t, int64(len(out)), shard.hotCount.Load())
+
+	// Recycled blocks are taken from the hot list first, the rest stays linked.
+	again := make([]unsafe.Pointer, perChunk)
+	assert.NoError(t, m.AllocBatch(common.B64, again))
+	for _, ptr := range again {
+		assert.True(t, seen[ptr])
+	}
+	assert.Equal(t, int64(len(out)-perChunk), shard.hotCount.Load())
+	assert.Equal(t, int64(perChunk), m.Stats().Classes[common.SizeClass64B].InUseObjects)
+
+	// A failed batch gives back what it took.
+	sys.FailAfter(0)
+	failed := make([]unsafe.Pointer, perChunk*4)
+	assert.ErrorIs(t, m.AllocBatch(common.B64, failed), syscall.ErrInjectedFailure)
+	assert.Equal(t, make([]unsafe.Pointer, len(failed)), failed)
+	assert.Equal(t, int64(perChunk), m.Stats().Classes[common.SizeClass64B].InUseObjects)
+
+	_, err = m.FreeBatch(common.B64, []unsafe.Pointer{nil})
+	assert.ErrorIs(t, err, ErrInvalidPointer)
+}
+
+func TestSmallManager_ConcurrentBatch(t *testing.T) {
+	const (
+		goroutines = 8
+		iterations = 200
+		batch      = 48
+	)
+
+	m, _ := newTestScavengeManager(t)
+	var (
+		wg   sync.WaitGroup
+		live sync.Map
+	)
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			ptrs := make([]unsafe.Pointer, batch)
+			for i := 0; i < iterations; i++ {
+				// Mix batches with single operations on the same lists.
+				if id%2 == 0 {
+					if !assert.NoError(t, m.AllocBatch(common.B32, ptrs)) {
+						return
+					}
+				} else {
+					for j := range ptrs {
+						ptr, err := m.Alloc(common.B32)
+						if !assert.NoError(t, err) {
+							return
+						}
+						ptrs[j] = ptr
+					}
+				}
+
+				for _, ptr := range ptrs {
+					if _, loaded := live.LoadOrStore(ptr, struct{}{}); loaded {
+						t.Errorf("block %p handed out to two owners", ptr)
+						return
+					}
+					*(*uint64)(ptr) = uint64(id)
+				}
+				for _, ptr := range ptrs {
+					assert.Equal(t, uint64(id), *(*uint64)(ptr))
+					live.Delete(ptr)
+				}
+
+				if id%4 < 2 {
+					_, err := m.FreeBatch(common.B32, ptrs)
+					assert.NoError(t, err)
+					continue
+				}
+				for _, ptr := range ptrs {
+					assert.NoError(t, m.Free(ptr, common.B32))
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,237 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"sync"
+	"time"
+
+	"github.com/TimeWtr/TurboAlloc/common"
+)
+
+// AllocStats holds the counters shared by size class and size category statistics.
+type AllocStats struct {
+	// InUseBytes and InUseObjects describe the memory handed out to callers. Large
+	// allocations count their page-rounded region size.
+	InUseBytes   int64
+	InUseObjects int64
+	// CachedBytes and CachedObjects describe the free objects kept by the allocator for
+	// reuse: the free lists of small shards and the free slots of medium partial spans.
+	CachedBytes   int64
+	CachedObjects int64
+	// Allocs and Frees count the successful Alloc and Free calls.
+	Allocs uint64
+	Frees  uint64
+	// Refills counts the trips to the backing memory: chunks carved by small shards,
+	// spans taken from the page heap by medium shards and regions mapped for large
+	// allocations.
+	Refills uint64
+	// MappedBytes is the memory mapped from the OS and held by the class or category.
+	MappedBytes int64
+}
+
+func (s AllocStats) add(o AllocStats) AllocStats {
+	return AllocStats{
+		InUseBytes:    s.InUseBytes + o.InUseBytes,
+		InUseObjects:  s.InUseObjects + o.InUseObjects,
+		CachedBytes:   s.CachedBytes + o.CachedBytes,
+		CachedObjects: s.CachedObjects + o.CachedObjects,
+		Allocs:        s.Allocs + o.Allocs,
+		Frees:         s.Frees + o.Frees,
+		Refills:       s.Refills + o.Refills,
+		MappedBytes:   s.MappedBytes + o.MappedBytes,
+	}
+}
+
+// ClassStats reports the statistics of a single size class.
+type ClassStats struct {
+	Class common.SizeClass
+	AllocStats
+}
+
+// CategoryStats reports the totals of a size category.
+type CategoryStats struct {
+	Category common.SizeCategory
+	AllocStats
+	// IdleBytes is the mapped memory not attributed to any class: free pages of the
+	// medium page heaps and retained large regions. It is included in MappedBytes.
+	IdleBytes int64
+}
+
+// Stats is a point-in-time snapshot of the allocator. Counters are read one by one
+// without stopping allocations, so a snapshot taken under load is not atomic.
+type Stats struct {
+	Time time.Time
+	// Classes holds the statistics of every size class, indexed by size class.
+	Classes []ClassStats
+	// Categories holds the totals of the small, medium and large categories, and of
+	// every category under common.AllSizeCategory.
+	Categories map[common.SizeCategory]CategoryStats
+	Scavenge   ScavengeStats
+}
+
+// Stats returns a snapshot of the allocator statistics.
+func (m *Manager) Stats() Stats {
+	st := Stats{
+		Time:       time.Now(),
+		Classes:    make([]ClassStats, 0, common.SizeClassMax+1),
+		Categories: make(map[common.SizeCategory]CategoryStats, 4),
+		Scavenge:   m.ScavengeStats(),
+	}
+
+	for sc := common.SizeClass8B; sc <= common.SizeClassMax; sc++ {
+		var cs ClassStats
+		switch sc.Category() {
+		case common.SmallSizeCategory:
+			cs = m.sm.classStats(sc)
+		case common.MediumSizeCategory:
+			cs = m.mm.classStats(sc)
+		default:
+			cs = m.lm.classStats(sc)
+		}
+		st.Classes = append(st.Classes, cs)
+
+		cat := st.Categories[sc.Category()]
+		cat.Category = sc.Category()
+		cat.AllocStats = cat.AllocStats.add(cs.AllocStats)
+		st.Categories[sc.Category()] = cat
+	}
+
+	// Medium and large categories also hold memory not owned by any class.
+	medium := st.Categories[common.MediumSizeCategory]
+	medium.MappedBytes, medium.IdleBytes = 0, 0
+	for _, h := range m.mm.heaps {
+		f := h.fragmentation()
+		medium.MappedBytes += f.FreeBytes + f.UsedBytes
+		medium.IdleBytes += f.FreeBytes
+	}
+	st.Categories[common.MediumSizeCategory] = medium
+
+	large := st.Categories[common.LargeSizeCategory]
+	f := m.lm.fragmentation()
+	large.MappedBytes, large.IdleBytes = f.FreeBytes+f.UsedBytes, f.FreeBytes
+	st.Categories[common.LargeSizeCategory] = large
+
+	all := CategoryStats{Category: common.AllSizeCategory}
+	for _, category := range []common.SizeCategory{
+		common.SmallSizeCategory, common.MediumSizeCategory, common.LargeSizeCategory,
+	} {
+		cat := st.Categories[category]
+		all.AllocStats = all.AllocStats.add(cat.AllocStats)
+		all.IdleBytes += cat.IdleBytes
+	}
+	st.Categories[common.AllSizeCategory] = all
+
+	return st
+}
+
+// WithStatsEmitter makes the manager take a snapshot every interval and pass it to
+// handler and to the channels returned by SubscribeStats. A non-positive interval
+// disables the emitter, handler may be nil.
+func WithStatsEmitter(interval time.Duration, handler func(Stats)) Option {
+	return func(m *Manager) {
+		m.emitter.interval = interval
+		m.emitter.handler = handler
+	}
+}
+
+type statsEmitter struct {
+	interval time.Duration
+	handler  func(Stats)
+
+	// mu protects subscribers.
+	mu          sync.Mutex
+	subscribers map[chan Stats]struct{}
+	closed      bool
+}
+
+// startStatsEmitter runs the periodic emitter when it is configured.
+func (m *Manager) startStatsEmitter() {
+	e := &m.emitter
+	if e.interval <= 0 {
+		return
+	}
+
+	m.every(e.interval, func() {
+		e.emit(m.Stats)
+	})
+}
+
+// emit takes a snapshot when anyone listens and delivers it. Subscribers that have not
+// drained the previous snapshots miss this one rather than blocking the emitter.
+func (e *statsEmitter) emit(snapshot func() Stats) {
+	e.mu.Lock()
+	listening := len(e.subscribers) > 0
+	e.mu.Unlock()
+	if e.handler == nil && !listening {
+		return
+	}
+
+	st := snapshot()
+	if e.handler != nil {
+		e.handler(st)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for ch := range e.subscribers {
+		select {
+		case ch <- st:
+		default:
+		}
+	}
+}
+
+// SubscribeStats returns a channel receiving the snapshots of the periodic emitter and a
+// function cancelling the subscription. The channel buffers buffer snapshots, further
+// snapshots are dropped until it is drained. It is closed by cancel or Close, and never
+// receives anything when the emitter is disabled.
+func (m *Manager) SubscribeStats(buffer int) (<-chan Stats, func()) {
+	e := &m.emitter
+	ch := make(chan Stats, max(buffer, 1))
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		close(ch)
+		return ch, func() {}
+	}
+
+	if e.subscribers == nil {
+		e.subscribers = make(map[chan Stats]struct{})
+	}
+	e.subscribers[ch] = struct{}{}
+
+	return ch, func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if _, ok := e.subscribers[ch]; ok {
+			delete(e.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// closeSubscribers closes every subscription, later subscriptions are closed at once.
+func (e *statsEmitter) closeSubscribers() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for ch := range e.subscribers {
+		close(ch)
+	}
+	e.subscribers = nil
+	e.closed = true
+}
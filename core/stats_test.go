@@ -0,0 +1,121 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/TimeWtr/TurboAlloc/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManager_Stats(t *testing.T) {
+	m, _ := newTestScavengeManager(t)
+
+	small := allocN(t, m, common.B64, 3)
+	assert.NoError(t, m.Free(small[0], common.B64))
+	allocN(t, m, common.KB*16, 2)
+	large, err := m.Alloc(common.MB)
+	assert.NoError(t, err)
+	assert.NoError(t, m.Free(large, common.MB))
+
+	st := m.Stats()
+	assert.Len(t, st.Classes, int(common.SizeClassMax)+1)
+	for i, cs := range st.Classes {
+		assert.Equal(t, common.SizeClass(i), cs.Class)
+	}
+
+	perChunk := int64(m.sm.shards[common.SizeClass64B.Int()][0].blocksPerChunk())
+	assert.Equal(t, AllocStats{
+		InUseBytes:    common.B64 * 2,
+		InUseObjects:  2,
+		CachedBytes:   common.B64 * (perChunk - 2),
+		CachedObjects: perChunk - 2,
+		Allocs:        3,
+		Frees:         1,
+		Refills:       1,
+		MappedBytes:   common.KB * 4,
+	}, st.Classes[common.SizeClass64B].AllocStats)
+
+	spanBytes := int64(common.KB * 16 * minSpanObjects)
+	assert.Equal(t, AllocStats{
+		InUseBytes:    common.KB * 32,
+		InUseObjects:  2,
+		CachedBytes:   common.KB * 16 * (minSpanObjects - 2),
+		CachedObjects: minSpanObjects - 2,
+		Allocs:        2,
+		Refills:       1,
+		MappedBytes:   spanBytes,
+	}, st.Classes[common.SizeClass16KB].AllocStats)
+
+	assert.Equal(t, AllocStats{Allocs: 1, Frees: 1, Refills: 1}, st.Classes[common.SizeClass1MB].AllocStats)
+
+	mediumCategory := st.Categories[common.MediumSizeCategory]
+	assert.Equal(t, int64(heapArenaSize), mediumCategory.MappedBytes)
+	assert.Equal(t, heapArenaSize-spanBytes, mediumCategory.IdleBytes)
+
+	largeCategory := st.Categories[common.LargeSizeCategory]
+	assert.Equal(t, int64(common.MB), largeCategory.MappedBytes)
+	assert.Equal(t, int64(common.MB), largeCategory.IdleBytes)
+
+	all := st.Categories[common.AllSizeCategory]
+	assert.Equal(t, uint64(6), all.Allocs)
+	assert.Equal(t, uint64(2), all.Frees)
+	assert.Equal(t, int64(common.B64*2+common.KB*32), all.InUseBytes)
+	assert.Equal(t, common.KB*4+heapArenaSize+common.MB, int(all.MappedBytes))
+}
+
+func TestManager_StatsEmitter(t *testing.T) {
+	handled := make(chan Stats, 1)
+	m, _ := newTestScavengeManager(t, WithStatsEmitter(time.Millisecond, func(st Stats) {
+		select {
+		case handled <- st:
+		default:
+		}
+	}))
+	ch, cancel := m.SubscribeStats(1)
+	other, _ := m.SubscribeStats(1)
+
+	_, err := m.Alloc(common.B64)
+	assert.NoError(t, err)
+
+	select {
+	case st := <-handled:
+		assert.False(t, st.Time.IsZero())
+	case <-time.After(time.Second):
+		t.Fatal("handler did not receive a snapshot")
+	}
+
+	select {
+	case st := <-ch:
+		assert.Equal(t, uint64(1), st.Classes[common.SizeClass64B].Allocs)
+	case <-time.After(time.Second):
+		t.Fatal("subscriber did not receive a snapshot")
+	}
+
+	cancel()
+	cancel()
+	for range ch {
+	}
+
+	// Close ends the remaining subscriptions.
+	assert.NoError(t, m.Close())
+	for range other {
+	}
+	late, _ := m.SubscribeStats(1)
+	_, ok := <-late
+	assert.False(t, ok)
+}
@@ -0,0 +1,2 @@
+// This file is intentionally left empty, it allows body-less function declarations
+// resolved through go:linkname in shard_selector.go.
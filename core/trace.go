@@ -0,0 +1,203 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/TimeWtr/TurboAlloc/common"
+)
+
+// A trace file starts with traceMagic, the start time of the trace in Unix nanoseconds
+// and the number of dropped events, followed by one record of traceRecordSize bytes
+// per event, oldest first. Every integer is little endian.
+const (
+	traceMagic      = "TATRACE1"
+	traceHeaderSize = len(traceMagic) + 16
+	traceRecordSize = 24
+)
+
+var (
+	// ErrTracingDisabled is returned by WriteTrace when tracing is not enabled.
+	ErrTracingDisabled = errors.New("tracing is disabled")
+	// ErrInvalidTrace is returned by ReadTrace when the input is not a trace file.
+	ErrInvalidTrace = errors.New("invalid trace")
+)
+
+// TraceOp is the operation recorded by a trace event.
+type TraceOp uint8
+
+const (
+	TraceAlloc TraceOp = iota + 1
+	TraceFree
+)
+
+func (o TraceOp) String() string {
+	switch o {
+	case TraceAlloc:
+		return "alloc"
+	case TraceFree:
+		return "free"
+	default:
+		return common.Unknown
+	}
+}
+
+// TraceEvent is an allocation or a free recorded by the tracer.
+type TraceEvent struct {
+	// Time is the offset of the event from the start of the trace.
+	Time time.Duration
+	Op   TraceOp
+	// Size is the size passed by the caller, it is zero for frees without a size.
+	Size  int
+	Class common.SizeClass
+	// Shard is the small or medium shard owning the block, zero for large regions.
+	Shard int
+	// Addr identifies the block among the live ones, it is the block address.
+	Addr uint64
+}
+
+// Trace is a decoded trace file.
+type Trace struct {
+	Start time.Time
+	// Dropped is the number of events overwritten in the ring buffer before the trace
+	// was written, the frees of blocks allocated by dropped events have no allocation.
+	Dropped uint64
+	Events  []TraceEvent
+}
+
+// WithTracing records the last events allocations and frees in a ring buffer, see
+// WriteTrace. Zero disables tracing.
+func WithTracing(events int) Option {
+	return func(m *Manager) {
+		if events > 0 {
+			m.tracer = &tracer{start: time.Now(), slots: make([]traceSlot, events)}
+		}
+	}
+}
+
+// traceSlot holds one event packed in words, seq is the event sequence number plus one
+// once the words are written and zero while they are.
+type traceSlot struct {
+	seq   atomic.Uint64
+	words [3]atomic.Uint64
+}
+
+// tracer is a lock-free ring buffer of events. Writers reserve a slot with the next
+// sequence number, so the oldest events are overwritten once the ring is full.
+type tracer struct {
+	start time.Time
+	slots []traceSlot
+	next  atomic.Uint64
+}
+
+func (t *tracer) record(op TraceOp, ptr unsafe.Pointer, size int, o Owner) {
+	i := t.next.Add(1) - 1
+	s := &t.slots[i%uint64(len(t.slots))]
+	s.seq.Store(0)
+	s.words[0].Store(uint64(time.Since(t.start)))
+	s.words[1].Store(uint64(uintptr(ptr)))
+	s.words[2].Store(uint64(uint32(size)) | uint64(o.Class)<<32 | uint64(op)<<40 | uint64(uint16(o.Shard))<<48)
+	s.seq.Store(i + 1)
+}
+
+// writeTo writes the events of the ring buffer, events being written are dropped.
+func (t *tracer) writeTo(w io.Writer) error {
+	n := t.next.Load()
+	first := n - min(n, uint64(len(t.slots)))
+	records := make([]byte, 0, (n-first)*traceRecordSize)
+	dropped := first
+	for i := first; i < n; i++ {
+		s := &t.slots[i%uint64(len(t.slots))]
+		if s.seq.Load() != i+1 {
+			dropped++
+			continue
+		}
+
+		var words [3]uint64
+		for j := range words {
+			words[j] = s.words[j].Load()
+		}
+		if s.seq.Load() != i+1 {
+			dropped++
+			continue
+		}
+		for _, word := range words {
+			records = binary.LittleEndian.AppendUint64(records, word)
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	header := binary.LittleEndian.AppendUint64([]byte(traceMagic), uint64(t.start.UnixNano()))
+	header = binary.LittleEndian.AppendUint64(header, dropped)
+	if _, err := bw.Write(header); err != nil {
+		return err
+	}
+	if _, err := bw.Write(records); err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// WriteTrace writes the events held by the tracer to w in the trace file format read by
+// ReadTrace.
+func (m *Manager) WriteTrace(w io.Writer) error {
+	if m.tracer == nil {
+		return ErrTracingDisabled
+	}
+
+	return m.tracer.writeTo(w)
+}
+
+// ReadTrace decodes a trace file written by WriteTrace.
+func ReadTrace(r io.Reader) (*Trace, error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, traceHeaderSize)
+	if _, err := io.ReadFull(br, header); err != nil || string(header[:len(traceMagic)]) != traceMagic {
+		return nil, fmt.Errorf("%w: bad header", ErrInvalidTrace)
+	}
+
+	t := &Trace{
+		Start:   time.Unix(0, int64(binary.LittleEndian.Uint64(header[len(traceMagic):]))),
+		Dropped: binary.LittleEndian.Uint64(header[len(traceMagic)+8:]),
+	}
+	record := make([]byte, traceRecordSize)
+	for {
+		if _, err := io.ReadFull(br, record); err != nil {
+			if errors.Is(err, io.EOF) {
+				return t, nil
+			}
+			return nil, fmt.Errorf("%w: truncated record %d", ErrInvalidTrace, len(t.Events))
+		}
+
+		packed := binary.LittleEndian.Uint64(record[16:])
+		t.Events = append(t.Events, TraceEvent{
+			Time:  time.Duration(binary.LittleEndian.Uint64(record)),
+			Addr:  binary.LittleEndian.Uint64(record[8:]),
+			Size:  int(uint32(packed)),
+			Class: common.SizeClass(uint8(packed >> 32)),
+			Op:    TraceOp(uint8(packed >> 40)),
+			Shard: int(uint16(packed >> 48)),
+		})
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"unsafe"
+
+	"github.com/TimeWtr/TurboAlloc/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManager_WriteTrace(t *testing.T) {
+	m, _ := newTestScavengeManager(t)
+	assert.ErrorIs(t, m.WriteTrace(io.Discard), ErrTracingDisabled)
+
+	m, _ = newTestScavengeManager(t, WithTracing(16))
+	sizes := []int{common.B64, common.KB * 16, common.MB * 2}
+	ptrs := make([]unsafe.Pointer, len(sizes))
+	for i, size := range sizes {
+		ptr, err := m.Alloc(size)
+		assert.NoError(t, err)
+		ptrs[i] = ptr
+	}
+	assert.NoError(t, m.Free(ptrs[0], sizes[0]))
+	_, err := m.FreeUnsized(ptrs[1])
+	assert.NoError(t, err)
+	assert.NoError(t, m.Free(ptrs[2], sizes[2]))
+
+	var buf bytes.Buffer
+	assert.NoError(t, m.WriteTrace(&buf))
+	trace, err := ReadTrace(&buf)
+	assert.NoError(t, err)
+	assert.Zero(t, trace.Dropped)
+	assert.Len(t, trace.Events, 6)
+	for i, e := range trace.Events[:3] {
+		sc, _ := common.SizeClassOf(sizes[i])
+		assert.Equal(t, TraceAlloc, e.Op)
+		assert.Equal(t, sizes[i], e.Size)
+		assert.Equal(t, sc, e.Class)
+		assert.Equal(t, uint64(uintptr(ptrs[i])), e.Addr)
+	}
+	for i, e := range trace.Events[3:] {
+		assert.Equal(t, TraceFree, e.Op)
+		assert.Equal(t, trace.Events[i].Addr, e.Addr)
+		assert.Equal(t, trace.Events[i].Class, e.Class)
+		assert.Equal(t, trace.Events[i].Shard, e.Shard)
+		assert.GreaterOrEqual(t, e.Time, trace.Events[i].Time)
+	}
+	assert.Zero(t, trace.Events[4].Size, "unsized frees have no size")
+}
+
+func TestTracer_Overwrite(t *testing.T) {
+	m, _ := newTestScavengeManager(t, WithTracing(4))
+	for range 5 {
+		ptr, err := m.Alloc(common.B64)
+		assert.NoError(t, err)
+		assert.NoError(t, m.Free(ptr, common.B64))
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, m.WriteTrace(&buf))
+	trace, err := ReadTrace(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(6), trace.Dropped)
+	assert.Len(t, trace.Events, 4)
+	assert.Equal(t, TraceAlloc, trace.Events[0].Op)
+}
+
+func TestReadTrace_Invalid(t *testing.T) {
+	_, err := ReadTrace(strings.NewReader("not a trace file at all"))
+	assert.ErrorIs(t, err, ErrInvalidTrace)
+
+	m, _ := newTestScavengeManager(t, WithTracing(4))
+	leakyAlloc(t, m, common.B64)
+	var buf bytes.Buffer
+	assert.NoError(t, m.WriteTrace(&buf))
+	_, err = ReadTrace(bytes.NewReader(buf.Bytes()[:buf.Len()-1]))
+	assert.ErrorIs(t, err, ErrInvalidTrace)
+}
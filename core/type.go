@@ -13,3 +13,27 @@
 // limitations under the License.
 
 package core
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrInvalidSize is returned when the requested size is not positive.
+	ErrInvalidSize = errors.New("invalid allocation size")
+	// ErrSizeTooLarge is returned when the requested size exceeds the largest size class.
+	ErrSizeTooLarge = errors.New("allocation size exceeds the largest size class")
+	// ErrInvalidPointer is returned when a nil pointer is passed to Free.
+	ErrInvalidPointer = errors.New("invalid pointer")
+	// ErrInvalidAlignment is returned when the requested alignment is not a power of two.
+	ErrInvalidAlignment = errors.New("alignment must be a power of two")
+	// ErrDoubleFree is returned when a block is freed while it is not handed out, either
+	// because it was already freed or because it never was allocated.
+	ErrDoubleFree = fmt.Errorf("%w: double free", ErrInvalidPointer)
+	// ErrForeignPointer is returned when a pointer outside of the manager's memory is freed.
+	ErrForeignPointer = fmt.Errorf("%w: pointer not allocated by this manager", ErrInvalidPointer)
+	// ErrSizeMismatch is returned when a block is freed with a size that does not match
+	// the one it was allocated with.
+	ErrSizeMismatch = fmt.Errorf("%w: size mismatch", ErrInvalidPointer)
+)
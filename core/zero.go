@@ -0,0 +1,81 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"unsafe"
+
+	"github.com/TimeWtr/TurboAlloc/common"
+)
+
+// WithZeroOnFree clears every block when it is returned, so that memory never carries
+// data from one user to the next. Large regions are released with MADV_DONTNEED rather
+// than cleared.
+func WithZeroOnFree(enable bool) Option {
+	return func(m *Manager) {
+		m.zeroOnFree = enable
+	}
+}
+
+// enableZeroOnFree propagates the zero-on-free mode to the size category managers.
+func (m *Manager) enableZeroOnFree() {
+	m.sm.zeroOnFree = m.zeroOnFree
+	m.mm.zeroOnFree = m.zeroOnFree
+	m.lm.zeroOnFree = m.zeroOnFree
+}
+
+// AllocZeroed returns a block of at least size bytes whose first size bytes are zero.
+// Blocks carved from freshly mapped or released pages are already zero and are not
+// cleared again, recycled blocks are.
+func (m *Manager) AllocZeroed(size int) (unsafe.Pointer, error) {
+	if m.debug != nil {
+		ptr, err := m.debug.alloc(size)
+		if err == nil {
+			clear(unsafe.Slice((*byte)(ptr), size))
+		}
+		return ptr, err
+	}
+
+	sc, err := m.sizeClassOf(size)
+	if err != nil {
+		return nil, err
+	}
+
+	var ptr unsafe.Pointer
+	var fresh bool
+	switch sc.Category() {
+	case common.SmallSizeCategory:
+		ptr, fresh, err = m.sm.allocFresh(sc)
+	case common.MediumSizeCategory:
+		ptr, fresh, err = m.mm.allocFresh(sc)
+	default:
+		ptr, fresh, err = m.lm.allocFresh(size)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	m.trackAlloc(ptr, size)
+	switch {
+	case sc.Category() == common.SmallSizeCategory && (fresh || m.zeroOnFree):
+		// Small chunks only ever hold blocks of their class, so only the free list link
+		// was written since the block was last zero.
+		blockAt(uintptr(ptr)).next = 0
+	case !fresh:
+		clear(unsafe.Slice((*byte)(ptr), size))
+	}
+
+	return ptr, nil
+}
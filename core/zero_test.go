@@ -0,0 +1,114 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"bytes"
+	"testing"
+	"unsafe"
+
+	"github.com/TimeWtr/TurboAlloc/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func fill(ptr unsafe.Pointer, size int) {
+	data := unsafe.Slice((*byte)(ptr), size)
+	for i := range data {
+		data[i] = 0xFF
+	}
+}
+
+func isZero(ptr unsafe.Pointer, size int) bool {
+	return bytes.Count(unsafe.Slice((*byte)(ptr), size), []byte{0}) == size
+}
+
+func TestManager_AllocZeroed(t *testing.T) {
+	for _, size := range []int{common.B64, common.KB * 16, common.MB} {
+		m, _ := newTestScavengeManager(t)
+		ptr, err := m.AllocZeroed(size)
+		assert.NoError(t, err)
+		assert.True(t, isZero(ptr, size), size)
+
+		// The recycled block is handed out again and cleared.
+		fill(ptr, size)
+		assert.NoError(t, m.Free(ptr, size))
+		again, err := m.AllocZeroed(size)
+		assert.NoError(t, err)
+		assert.Equal(t, ptr, again, size)
+		assert.True(t, isZero(again, size), size)
+		assert.NoError(t, m.Free(again, size))
+	}
+}
+
+func TestManager_AllocFresh(t *testing.T) {
+	m, _ := newTestScavengeManager(t)
+
+	// Blocks of a new chunk are fresh, recycled ones are not.
+	ptr, fresh, err := m.sm.allocFresh(common.SizeClass64B)
+	assert.NoError(t, err)
+	assert.True(t, fresh)
+	_, fresh, err = m.sm.allocFresh(common.SizeClass64B)
+	assert.NoError(t, err)
+	assert.True(t, fresh)
+	assert.NoError(t, m.Free(ptr, common.B64))
+	_, fresh, err = m.sm.allocFresh(common.SizeClass64B)
+	assert.NoError(t, err)
+	assert.False(t, fresh)
+
+	ptr, fresh, err = m.mm.allocFresh(common.SizeClass16KB)
+	assert.NoError(t, err)
+	assert.True(t, fresh)
+	assert.NoError(t, m.Free(ptr, common.KB*16))
+	_, fresh, err = m.mm.allocFresh(common.SizeClass16KB)
+	assert.NoError(t, err)
+	assert.False(t, fresh)
+
+	ptr, fresh, err = m.lm.allocFresh(common.MB)
+	assert.NoError(t, err)
+	assert.True(t, fresh)
+	assert.NoError(t, m.Free(ptr, common.MB))
+	_, fresh, err = m.lm.allocFresh(common.MB)
+	assert.NoError(t, err)
+	assert.False(t, fresh)
+}
+
+func TestManager_ZeroOnFree(t *testing.T) {
+	m, sys := newTestScavengeManager(t, WithZeroOnFree(true))
+
+	small, err := m.Alloc(common.B64)
+	assert.NoError(t, err)
+	fill(small, common.B64)
+	assert.NoError(t, m.Free(small, common.B64))
+	// Only the free list link is left in the block.
+	assert.True(t, isZero(unsafe.Add(small, 8), common.B64-8))
+
+	medium, err := m.Alloc(common.KB * 16)
+	assert.NoError(t, err)
+	fill(medium, common.KB*16)
+	assert.NoError(t, m.Free(medium, common.KB*16))
+	assert.True(t, isZero(unsafe.Add(medium, 8), common.KB*16-8))
+
+	// Large regions are released rather than cleared and are fresh when reused.
+	large, err := m.Alloc(common.MB)
+	assert.NoError(t, err)
+	fill(large, common.MB)
+	assert.NoError(t, m.Free(large, common.MB))
+	assert.Equal(t, common.MB, sys.ReleasedBytes())
+	ptr, fresh, err := m.lm.allocFresh(common.MB)
+	assert.NoError(t, err)
+	assert.Equal(t, large, ptr)
+	assert.True(t, fresh)
+	assert.True(t, isZero(ptr, common.MB))
+}
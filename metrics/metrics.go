@@ -0,0 +1,218 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics exports the statistics of a pool and of the weight subsystem in the
+// Prometheus text exposition format, without depending on the Prometheus client
+// library, and optionally through expvar.
+package metrics
+
+import (
+	"bytes"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/TimeWtr/TurboAlloc/core"
+	"github.com/TimeWtr/TurboAlloc/weight"
+)
+
+// ContentType is the content type of the Prometheus text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Namespace prefixes the name of every metric.
+const Namespace = "turboalloc"
+
+// StatsSource provides the allocator statistics, it is implemented by turboalloc.Pool
+// and core.Manager.
+type StatsSource interface {
+	Stats() core.Stats
+}
+
+// WeightSource provides the counters of the weight subsystem, it is implemented by
+// weight.ManagerImpl.
+type WeightSource interface {
+	Stats() weight.ManagerStats
+}
+
+// Option configures an Exporter.
+type Option func(*Exporter)
+
+// WithWeightManager adds the reload, normalization failure and dispatch timeout counters
+// of m.
+func WithWeightManager(m WeightSource) Option {
+	return func(e *Exporter) {
+		if m != nil {
+			e.weights = m
+		}
+	}
+}
+
+// Exporter collects the metrics on every scrape, it is an http.Handler serving them in
+// the Prometheus text exposition format.
+type Exporter struct {
+	source  StatsSource
+	weights WeightSource
+}
+
+// NewExporter returns an Exporter of the statistics of source, which may be nil to only
+// export the weight subsystem.
+func NewExporter(source StatsSource, opts ...Option) *Exporter {
+	e := &Exporter{source: source}
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	return e
+}
+
+// metricType is the TYPE of a metric family.
+type metricType string
+
+const (
+	counter metricType = "counter"
+	gauge   metricType = "gauge"
+)
+
+type label struct {
+	name, value string
+}
+
+type sample struct {
+	labels []label
+	value  float64
+}
+
+// family is a metric and its samples, the name excludes the namespace.
+type family struct {
+	name    string
+	help    string
+	typ     metricType
+	samples []sample
+}
+
+// collect takes a snapshot of every metric. The alloc and free counters are exported as
+// totals, their rates are computed by the queries.
+func (e *Exporter) collect() []family {
+	var families []family
+	if e.source != nil {
+		families = append(families, classFamilies(e.source.Stats())...)
+	}
+	if e.weights != nil {
+		st := e.weights.Stats()
+		families = append(families,
+			family{name: "weight_reloads_total", help: "Weight configurations normalized and dispatched.",
+				typ: counter, samples: []sample{{value: float64(st.Reloads)}}},
+			family{name: "weight_normalization_failures_total", help: "Weight configurations rejected by the processor.",
+				typ: counter, samples: []sample{{value: float64(st.NormalizationFailures)}}},
+			family{name: "weight_dispatch_timeouts_total", help: "Weight events dropped because a listener did not receive them in time.",
+				typ: counter, samples: []sample{{value: float64(st.DispatchTimeouts)}}},
+		)
+	}
+
+	return families
+}
+
+// classFamilies returns the per size class metrics of st, labelled by class and category.
+func classFamilies(st core.Stats) []family {
+	families := []family{
+		{name: "class_inuse_bytes", help: "Bytes handed out to callers.", typ: gauge},
+		{name: "class_inuse_objects", help: "Blocks handed out to callers.", typ: gauge},
+		{name: "class_cached_bytes", help: "Bytes of the free blocks kept for reuse.", typ: gauge},
+		{name: "class_mapped_bytes", help: "Bytes mapped from the OS and held by the class.", typ: gauge},
+		{name: "class_allocs_total", help: "Successful allocations.", typ: counter},
+		{name: "class_frees_total", help: "Successful frees.", typ: counter},
+		{name: "class_refills_total", help: "Trips to the backing memory.", typ: counter},
+	}
+	for _, cs := range st.Classes {
+		labels := []label{{"class", cs.Class.String()}, {"category", cs.Class.Category().String()}}
+		for i, v := range []float64{
+			float64(cs.InUseBytes), float64(cs.InUseObjects), float64(cs.CachedBytes),
+			float64(cs.MappedBytes), float64(cs.Allocs), float64(cs.Frees), float64(cs.Refills),
+		} {
+			families[i].samples = append(families[i].samples, sample{labels: labels, value: v})
+		}
+	}
+
+	return families
+}
+
+// WriteTo writes every metric to w in the Prometheus text exposition format.
+func (e *Exporter) WriteTo(w io.Writer) (int64, error) {
+	var b bytes.Buffer
+	for _, f := range e.collect() {
+		name := Namespace + "_" + f.name
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, f.help, name, f.typ)
+		for _, s := range f.samples {
+			b.WriteString(name)
+			if len(s.labels) > 0 {
+				b.WriteByte('{')
+				for i, l := range s.labels {
+					if i > 0 {
+						b.WriteByte(',')
+					}
+					fmt.Fprintf(&b, "%s=\"%s\"", l.name, escapeLabel(l.value))
+				}
+				b.WriteByte('}')
+			}
+			fmt.Fprintf(&b, " %s\n", strconv.FormatFloat(s.value, 'g', -1, 64))
+		}
+	}
+
+	return b.WriteTo(w)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	_, _ = e.WriteTo(w)
+}
+
+// Publish exports the metrics as the expvar variable name, a map from the metric name to
+// its value, or to a map from the comma separated label values to the value for the
+// labelled metrics. Like expvar.Publish it panics when name is already registered.
+func (e *Exporter) Publish(name string) {
+	expvar.Publish(name, expvar.Func(e.vars))
+}
+
+func (e *Exporter) vars() any {
+	vars := make(map[string]any)
+	for _, f := range e.collect() {
+		name := Namespace + "_" + f.name
+		if len(f.samples) == 1 && len(f.samples[0].labels) == 0 {
+			vars[name] = f.samples[0].value
+			continue
+		}
+
+		values := make(map[string]float64, len(f.samples))
+		for _, s := range f.samples {
+			keys := make([]string, len(s.labels))
+			for i, l := range s.labels {
+				keys[i] = l.value
+			}
+			values[strings.Join(keys, ",")] = s.value
+		}
+		vars[name] = values
+	}
+
+	return vars
+}
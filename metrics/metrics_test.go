@@ -0,0 +1,103 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	turboalloc "github.com/TimeWtr/TurboAlloc"
+	"github.com/TimeWtr/TurboAlloc/common"
+	"github.com/TimeWtr/TurboAlloc/weight"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestPool(t *testing.T) *turboalloc.Pool {
+	t.Helper()
+	p, err := turboalloc.NewPool(turboalloc.Config{})
+	assert.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, p.Close()) })
+	return p
+}
+
+func TestExporter_ServeHTTP(t *testing.T) {
+	p := newTestPool(t)
+	ptr, err := p.Alloc(common.B64)
+	assert.NoError(t, err)
+	defer func() { assert.NoError(t, p.Free(ptr, common.B64)) }()
+
+	rec := httptest.NewRecorder()
+	NewExporter(p, WithWeightManager(new(weight.ManagerImpl))).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, ContentType, rec.Header().Get("Content-Type"))
+
+	body := rec.Body.String()
+	class := common.SizeClass64B.String()
+	assert.Contains(t, body, "# TYPE turboalloc_class_inuse_bytes gauge\n")
+	assert.Contains(t, body, "# TYPE turboalloc_class_allocs_total counter\n")
+	assert.Contains(t, body, `turboalloc_class_inuse_bytes{class="`+class+`",category="small"} 64`+"\n")
+	assert.Contains(t, body, `turboalloc_class_allocs_total{class="`+class+`",category="small"} 1`+"\n")
+	assert.Contains(t, body, "turboalloc_weight_reloads_total 0\n")
+	assert.Contains(t, body, "turboalloc_weight_normalization_failures_total 0\n")
+	assert.Contains(t, body, "turboalloc_weight_dispatch_timeouts_total 0\n")
+
+	// Every sample of a family must have distinct labels.
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(strings.TrimSpace(body), "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		series := line[:strings.LastIndexByte(line, ' ')]
+		assert.False(t, seen[series], series)
+		seen[series] = true
+	}
+}
+
+// fixedWeights is a WeightSource returning fixed counters.
+type fixedWeights weight.ManagerStats
+
+func (f fixedWeights) Stats() weight.ManagerStats { return weight.ManagerStats(f) }
+
+func TestExporter_WeightOnly(t *testing.T) {
+	var b strings.Builder
+	_, err := NewExporter(nil, WithWeightManager(fixedWeights{Reloads: 3, DispatchTimeouts: 1})).WriteTo(&b)
+	assert.NoError(t, err)
+	assert.NotContains(t, b.String(), "turboalloc_class_")
+	assert.Contains(t, b.String(), "turboalloc_weight_reloads_total 3\n")
+	assert.Contains(t, b.String(), "turboalloc_weight_normalization_failures_total 0\n")
+	assert.Contains(t, b.String(), "turboalloc_weight_dispatch_timeouts_total 1\n")
+}
+
+func TestEscapeLabel(t *testing.T) {
+	assert.Equal(t, `a\\b\"c\nd`, escapeLabel("a\\b\"c\nd"))
+}
+
+func TestExporter_Publish(t *testing.T) {
+	p := newTestPool(t)
+	ptr, err := p.Alloc(common.KB)
+	assert.NoError(t, err)
+	defer func() { assert.NoError(t, p.Free(ptr, common.KB)) }()
+
+	NewExporter(p, WithWeightManager(new(weight.ManagerImpl))).Publish("turboalloc_test")
+	var vars map[string]json.RawMessage
+	assert.NoError(t, json.Unmarshal([]byte(expvar.Get("turboalloc_test").String()), &vars))
+	assert.JSONEq(t, "0", string(vars["turboalloc_weight_reloads_total"]))
+
+	var inUse map[string]float64
+	assert.NoError(t, json.Unmarshal(vars["turboalloc_class_inuse_bytes"], &inUse))
+	assert.Equal(t, float64(common.KB), inUse[common.SizeClass1KB.String()+",small"])
+}
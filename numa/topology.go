@@ -0,0 +1,258 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package numa
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// DefaultSysPath is the sysfs directory describing the NUMA nodes of the machine.
+const DefaultSysPath = "/sys/devices/system/node"
+
+// ErrNoNodes is returned when no NUMA node can be found under the sysfs directory.
+var ErrNoNodes = errors.New("no numa nodes found")
+
+// Node describes a single NUMA node.
+type Node struct {
+	// ID is the kernel node number.
+	ID int
+	// CPUs lists the CPUs attached to the node.
+	CPUs []int
+	// Distances holds the relative access distance from this node to every node,
+	// indexed by node ID. The distance to itself is usually 10.
+	Distances []int
+	// Capacity is the total memory of the node in bytes.
+	Capacity int64
+}
+
+// Topology describes the NUMA nodes of a machine and maps CPUs to nodes.
+type Topology struct {
+	Nodes     []Node
+	cpuToNode map[int]int
+	byID      map[int]int
+}
+
+// NewTopology builds a Topology from the given nodes. It is used to describe a fake
+// topology in tests on single-node machines.
+func NewTopology(nodes []Node) (*Topology, error) {
+	if len(nodes) == 0 {
+		return nil, ErrNoNodes
+	}
+
+	t := &Topology{
+		Nodes:     append([]Node(nil), nodes...),
+		cpuToNode: make(map[int]int),
+		byID:      make(map[int]int, len(nodes)),
+	}
+	sort.Slice(t.Nodes, func(i, j int) bool {
+		return t.Nodes[i].ID < t.Nodes[j].ID
+	})
+	for i, n := range t.Nodes {
+		t.byID[n.ID] = i
+		for _, cpu := range n.CPUs {
+			t.cpuToNode[cpu] = n.ID
+		}
+	}
+
+	return t, nil
+}
+
+// Detect reads the topology of the machine from DefaultSysPath.
+func Detect() (*Topology, error) {
+	return DetectFrom(DefaultSysPath)
+}
+
+// DetectFrom reads the topology from a sysfs style directory containing nodeN
+// subdirectories with cpulist, distance and meminfo files.
+func DetectFrom(root string) (*Topology, error) {
+	dirs, err := filepath.Glob(filepath.Join(root, "node[0-9]*"))
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make([]Node, 0, len(dirs))
+	for _, dir := range dirs {
+		id, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(dir), "node"))
+		if err != nil {
+			continue
+		}
+
+		node, err := readNode(dir, id)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+
+	return NewTopology(nodes)
+}
+
+func readNode(dir string, id int) (Node, error) {
+	node := Node{ID: id}
+	data, err := os.ReadFile(filepath.Join(dir, "cpulist"))
+	if err != nil {
+		return node, err
+	}
+
+	if node.CPUs, err = ParseCPUList(strings.TrimSpace(string(data))); err != nil {
+		return node, fmt.Errorf("node %d: %w", id, err)
+	}
+
+	data, err = os.ReadFile(filepath.Join(dir, "distance"))
+	if err != nil {
+		return node, err
+	}
+
+	for _, field := range strings.Fields(string(data)) {
+		d, err := strconv.Atoi(field)
+		if err != nil {
+			return node, fmt.Errorf("node %d: invalid distance %q", id, field)
+		}
+		node.Distances = append(node.Distances, d)
+	}
+
+	// meminfo is optional, nodes without it are treated as having unlimited capacity.
+	if data, err = os.ReadFile(filepath.Join(dir, "meminfo")); err == nil {
+		node.Capacity = parseMemTotal(string(data))
+	}
+
+	return node, nil
+}
+
+// ParseCPUList parses the kernel cpulist format, such as "0-3,8,10-11".
+func ParseCPUList(list string) ([]int, error) {
+	var cpus []int
+	if list == "" {
+		return cpus, nil
+	}
+
+	for _, part := range strings.Split(list, ",") {
+		lo, hi, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(lo)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cpu list %q", list)
+		}
+
+		end := start
+		if isRange {
+			if end, err = strconv.Atoi(hi); err != nil || end < start {
+				return nil, fmt.Errorf("invalid cpu list %q", list)
+			}
+		}
+
+		for cpu := start; cpu <= end; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+
+	return cpus, nil
+}
+
+// parseMemTotal extracts the "Node N MemTotal: X kB" value of a node meminfo file.
+func parseMemTotal(meminfo string) int64 {
+	const kb = 1024
+	for _, line := range strings.Split(meminfo, "\n") {
+		fields := strings.Fields(line)
+		// Node 0 MemTotal: 4816632 kB
+		const fieldCount = 5
+		if len(fields) < fieldCount || fields[2] != "MemTotal:" {
+			continue
+		}
+
+		v, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			return 0
+		}
+		return v * kb
+	}
+
+	return 0
+}
+
+// NodeOfCPU returns the node the CPU belongs to, or the first node when the CPU is unknown.
+func (t *Topology) NodeOfCPU(cpu int) int {
+	if id, ok := t.cpuToNode[cpu]; ok {
+		return id
+	}
+
+	return t.Nodes[0].ID
+}
+
+// Node returns the node with the given ID.
+func (t *Topology) Node(id int) (Node, bool) {
+	idx, ok := t.byID[id]
+	if !ok {
+		return Node{}, false
+	}
+
+	return t.Nodes[idx], true
+}
+
+// FallbackOrder returns the IDs of every node other than id, nearest first.
+func (t *Topology) FallbackOrder(id int) []int {
+	home, _ := t.Node(id)
+	order := make([]int, 0, len(t.Nodes)-1)
+	for _, n := range t.Nodes {
+		if n.ID != id {
+			order = append(order, n.ID)
+		}
+	}
+
+	distance := func(to int) int {
+		if to < len(home.Distances) {
+			return home.Distances[to]
+		}
+		return int(^uint(0) >> 1)
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return distance(order[i]) < distance(order[j])
+	})
+
+	return order
+}
+
+// Truncate returns a topology limited to the first n nodes, CPUs of dropped nodes
+// are mapped to the first node.
+func (t *Topology) Truncate(n int) *Topology {
+	if n <= 0 || n >= len(t.Nodes) {
+		return t
+	}
+
+	truncated, _ := NewTopology(append([]Node(nil), t.Nodes[:n]...))
+	return truncated
+}
+
+// CurrentCPU returns the CPU the calling thread is running on.
+func CurrentCPU() (int, error) {
+	var cpu, node uint32
+	_, _, errno := syscall.RawSyscall(
+		sysGetCPU,
+		uintptr(unsafe.Pointer(&cpu)),
+		uintptr(unsafe.Pointer(&node)),
+		0)
+	if errno != 0 {
+		return 0, fmt.Errorf("failed to get cpu, errno: %w", errno)
+	}
+
+	return int(cpu), nil
+}
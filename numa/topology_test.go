@@ -0,0 +1,102 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package numa
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeNode(t *testing.T, root string, id, cpulist, distance, meminfo string) {
+	t.Helper()
+	dir := filepath.Join(root, "node"+id)
+	assert.NoError(t, os.MkdirAll(dir, 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "cpulist"), []byte(cpulist+"\n"), 0o600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "distance"), []byte(distance+"\n"), 0o600))
+	if meminfo != "" {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "meminfo"), []byte(meminfo), 0o600))
+	}
+}
+
+func TestDetectFrom(t *testing.T) {
+	root := t.TempDir()
+	writeNode(t, root, "0", "0-1,4", "10 21 31", "Node 0 MemTotal:       1024 kB\nNode 0 MemFree: 512 kB\n")
+	writeNode(t, root, "1", "2-3", "21 10 21", "")
+	writeNode(t, root, "2", "", "31 21 10", "")
+	// Entries not named nodeN are ignored.
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "power"), 0o755))
+
+	topo, err := DetectFrom(root)
+	assert.NoError(t, err)
+	assert.Len(t, topo.Nodes, 3)
+
+	node, ok := topo.Node(0)
+	assert.True(t, ok)
+	assert.Equal(t, []int{0, 1, 4}, node.CPUs)
+	assert.Equal(t, int64(1024*1024), node.Capacity)
+
+	assert.Equal(t, 0, topo.NodeOfCPU(4))
+	assert.Equal(t, 1, topo.NodeOfCPU(3))
+	assert.Equal(t, 0, topo.NodeOfCPU(99))
+
+	assert.Equal(t, []int{1, 2}, topo.FallbackOrder(0))
+	assert.Equal(t, []int{1, 0}, topo.FallbackOrder(2))
+
+	truncated := topo.Truncate(2)
+	assert.Len(t, truncated.Nodes, 2)
+	assert.Equal(t, []int{1}, truncated.FallbackOrder(0))
+}
+
+func TestNewTopology_KeepsCallerNodes(t *testing.T) {
+	nodes := []Node{{ID: 1, CPUs: []int{1}}, {ID: 0, CPUs: []int{0}}}
+	topo, err := NewTopology(nodes)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, topo.Nodes[0].ID)
+	assert.Equal(t, 1, nodes[0].ID)
+}
+
+func TestDetectFrom_NoNodes(t *testing.T) {
+	_, err := DetectFrom(t.TempDir())
+	assert.ErrorIs(t, err, ErrNoNodes)
+}
+
+func TestParseCPUList(t *testing.T) {
+	testCases := []struct {
+		list    string
+		want    []int
+		wantErr bool
+	}{
+		{list: "", want: nil},
+		{list: "0", want: []int{0}},
+		{list: "0-3,8,10-11", want: []int{0, 1, 2, 3, 8, 10, 11}},
+		{list: "3-1", wantErr: true},
+		{list: "a", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.list, func(t *testing.T) {
+			cpus, err := ParseCPUList(tc.list)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, cpus)
+		})
+	}
+}
@@ -0,0 +1,272 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package offheap
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+)
+
+const (
+	rootPath = "github.com/TimeWtr/TurboAlloc"
+	corePath = rootPath + "/core"
+)
+
+// typedFuncs are the generic entry points of the root package whose type argument is
+// stored off-heap.
+var typedFuncs = map[string]bool{
+	"AllocSlice": true,
+	"FreeSlice":  true,
+	"New":        true,
+	"Delete":     true,
+	"ArenaNew":   true,
+	"ArenaSlice": true,
+}
+
+// rawAllocs are the methods returning raw off-heap memory as an unsafe.Pointer, keyed by
+// package path, receiver type name and method name.
+var rawAllocs = map[string]bool{
+	rootPath + ".Pool.Alloc":           true,
+	rootPath + ".Pool.AllocAligned":    true,
+	rootPath + ".Pool.AllocZeroed":     true,
+	rootPath + ".Pool.Realloc":         true,
+	corePath + ".Manager.Alloc":        true,
+	corePath + ".Manager.AllocAligned": true,
+	corePath + ".Manager.AllocZeroed":  true,
+	corePath + ".Manager.Realloc":      true,
+}
+
+// Diagnostic reports a call site storing a GC-visible type off-heap.
+type Diagnostic struct {
+	Pos     token.Pos
+	Message string
+}
+
+// Analyze reports the call sites of a type-checked package that store types holding Go
+// pointers in pool memory: instantiations of the typed helpers with such a type, and
+// conversions of an unsafe.Pointer obtained from Pool.Alloc or Manager.Alloc to a
+// pointer to such a type. info must record Types, Defs, Uses and Instances.
+func Analyze(files []*ast.File, info *types.Info) []Diagnostic {
+	var diags []Diagnostic
+	for _, file := range files {
+		raw := rawPointers(file, info)
+		ast.Inspect(file, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.Ident:
+				if d, ok := checkInstance(n, info); ok {
+					diags = append(diags, d)
+				}
+			case *ast.CallExpr:
+				if d, ok := checkConversion(n, info, raw); ok {
+					diags = append(diags, d)
+				}
+			}
+			return true
+		})
+	}
+
+	return diags
+}
+
+// checkInstance reports an instantiation of a typed helper with a GC-visible type.
+func checkInstance(id *ast.Ident, info *types.Info) (Diagnostic, bool) {
+	inst, ok := info.Instances[id]
+	if !ok || inst.TypeArgs.Len() == 0 {
+		return Diagnostic{}, false
+	}
+
+	fn, ok := info.Uses[id].(*types.Func)
+	if !ok || fn.Pkg() == nil || fn.Pkg().Path() != rootPath || !typedFuncs[fn.Name()] {
+		return Diagnostic{}, false
+	}
+
+	arg := inst.TypeArgs.At(0)
+	path, kind, found := findType(arg, "")
+	if !found {
+		return Diagnostic{}, false
+	}
+
+	return Diagnostic{
+		Pos: id.Pos(),
+		Message: fmt.Sprintf("turboalloc.%s instantiated with %s: %s%s is a %s, which the garbage collector can not see off-heap",
+			fn.Name(), typeString(arg), typeString(arg), path, kind),
+	}, true
+}
+
+// checkConversion reports a conversion of raw pool memory to a pointer to a GC-visible type.
+func checkConversion(call *ast.CallExpr, info *types.Info, raw map[types.Object]bool) (Diagnostic, bool) {
+	tv, ok := info.Types[call.Fun]
+	if !ok || !tv.IsType() || len(call.Args) != 1 {
+		return Diagnostic{}, false
+	}
+
+	ptr, ok := tv.Type.Underlying().(*types.Pointer)
+	if !ok || !isRaw(call.Args[0], info, raw) {
+		return Diagnostic{}, false
+	}
+
+	elem := ptr.Elem()
+	path, kind, found := findType(elem, "")
+	if !found {
+		return Diagnostic{}, false
+	}
+
+	return Diagnostic{
+		Pos: call.Pos(),
+		Message: fmt.Sprintf("pool memory converted to %s: %s%s is a %s, which the garbage collector can not see off-heap",
+			typeString(tv.Type), typeString(elem), path, kind),
+	}, true
+}
+
+// typeString formats t with package names instead of import paths.
+func typeString(t types.Type) string {
+	return types.TypeString(t, func(p *types.Package) string {
+		return p.Name()
+	})
+}
+
+// rawPointers returns the variables of file assigned the memory returned by a raw
+// allocation method.
+func rawPointers(file *ast.File, info *types.Info) map[types.Object]bool {
+	raw := make(map[types.Object]bool)
+	record := func(lhs []ast.Expr, rhs []ast.Expr) {
+		if len(rhs) != 1 || len(lhs) == 0 || !isRawAlloc(rhs[0], info) {
+			return
+		}
+
+		if id, ok := lhs[0].(*ast.Ident); ok {
+			if obj := objectOf(id, info); obj != nil {
+				raw[obj] = true
+			}
+		}
+	}
+
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			record(n.Lhs, n.Rhs)
+		case *ast.ValueSpec:
+			lhs := make([]ast.Expr, len(n.Names))
+			for i, name := range n.Names {
+				lhs[i] = name
+			}
+			record(lhs, n.Values)
+		}
+		return true
+	})
+
+	return raw
+}
+
+func objectOf(id *ast.Ident, info *types.Info) types.Object {
+	if obj := info.Defs[id]; obj != nil {
+		return obj
+	}
+
+	return info.Uses[id]
+}
+
+// isRaw reports whether expr is raw pool memory, a variable assigned from a raw
+// allocation method.
+func isRaw(expr ast.Expr, info *types.Info, raw map[types.Object]bool) bool {
+	if id, ok := ast.Unparen(expr).(*ast.Ident); ok {
+		return raw[info.Uses[id]]
+	}
+
+	return false
+}
+
+// isRawAlloc reports whether expr calls one of the raw allocation methods.
+func isRawAlloc(expr ast.Expr, info *types.Info) bool {
+	call, ok := ast.Unparen(expr).(*ast.CallExpr)
+	if !ok {
+		return false
+	}
+
+	sel, ok := ast.Unparen(call.Fun).(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+
+	fn, ok := info.Uses[sel.Sel].(*types.Func)
+	if !ok || fn.Pkg() == nil {
+		return false
+	}
+
+	recv := fn.Type().(*types.Signature).Recv()
+	if recv == nil {
+		return false
+	}
+
+	t := recv.Type()
+	if p, ok := t.(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	named, ok := t.(*types.Named)
+	if !ok {
+		return false
+	}
+
+	return rawAllocs[fn.Pkg().Path()+"."+named.Obj().Name()+"."+fn.Name()]
+}
+
+// findType is the go/types counterpart of find, type parameters are not reported since
+// their type arguments are checked where they are instantiated.
+func findType(t types.Type, path string) (string, string, bool) {
+	if _, ok := t.(*types.TypeParam); ok {
+		return "", "", false
+	}
+
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch u.Kind() {
+		case types.String, types.UntypedString:
+			return path, "string", true
+		case types.UnsafePointer:
+			return path, "unsafe.Pointer", true
+		default:
+			return "", "", false
+		}
+	case *types.Array:
+		if u.Len() == 0 {
+			return "", "", false
+		}
+		return findType(u.Elem(), path+"[0]")
+	case *types.Struct:
+		for i := 0; i < u.NumFields(); i++ {
+			f := u.Field(i)
+			if p, kind, ok := findType(f.Type(), path+"."+f.Name()); ok {
+				return p, kind, true
+			}
+		}
+		return "", "", false
+	case *types.Pointer:
+		return path, "ptr", true
+	case *types.Slice:
+		return path, "slice", true
+	case *types.Map:
+		return path, "map", true
+	case *types.Chan:
+		return path, "chan", true
+	case *types.Signature:
+		return path, "func", true
+	case *types.Interface:
+		return path, "interface", true
+	default:
+		return "", "", false
+	}
+}
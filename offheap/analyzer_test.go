@@ -0,0 +1,133 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package offheap
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stubRoot declares the signatures of the root package the analyzer looks for.
+const stubRoot = `package turboalloc
+
+import "unsafe"
+
+type Pool struct{}
+
+func (p *Pool) Alloc(size int) (unsafe.Pointer, error) { return nil, nil }
+
+func AllocSlice[T any](p *Pool, n int) ([]T, error) { return nil, nil }
+func FreeSlice[T any](p *Pool, s []T) error         { return nil }
+func New[T any](p *Pool) (*T, error)                { return nil, nil }
+func Delete[T any](p *Pool, v *T) error             { return nil }
+
+type Arena struct{}
+
+func ArenaNew[T any](a *Arena) (*T, error)          { return nil, nil }
+func ArenaSlice[T any](a *Arena, n int) ([]T, error) { return nil, nil }
+`
+
+const source = `package app
+
+import (
+	"unsafe"
+
+	turboalloc "github.com/TimeWtr/TurboAlloc"
+)
+
+type user struct {
+	ID   int
+	Name string
+}
+
+type point struct{ X, Y float64 }
+
+func use(p *turboalloc.Pool, a *turboalloc.Arena, other unsafe.Pointer) {
+	_, _ = turboalloc.New[user](p)
+	_, _ = turboalloc.AllocSlice[point](p, 4)
+	_, _ = turboalloc.AllocSlice[[]byte](p, 4)
+	_ = turboalloc.Delete(p, &point{})
+
+	ptr, _ := p.Alloc(64)
+	_ = (*point)(ptr)
+	_ = (*user)(ptr)
+	_ = unsafe.Slice((*map[int]int)(ptr), 1)
+	_ = (*user)(other)
+
+	_, _ = turboalloc.ArenaNew[point](a)
+	_, _ = turboalloc.ArenaSlice[*point](a, 2)
+	_, _ = turboalloc.ArenaNew[user](a)
+}
+`
+
+// stubImporter serves the root package from stubRoot and everything else from export data.
+type stubImporter struct {
+	fset *token.FileSet
+	root *types.Package
+}
+
+func (s *stubImporter) Import(path string) (*types.Package, error) {
+	if path != rootPath {
+		return importer.Default().Import(path)
+	}
+
+	if s.root == nil {
+		f, err := parser.ParseFile(s.fset, "turboalloc.go", stubRoot, 0)
+		if err != nil {
+			return nil, err
+		}
+		conf := types.Config{Importer: importer.Default()}
+		if s.root, err = conf.Check(rootPath, s.fset, []*ast.File{f}, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.root, nil
+}
+
+func TestAnalyze(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "app.go", source, 0)
+	assert.NoError(t, err)
+
+	info := &types.Info{
+		Types:     make(map[ast.Expr]types.TypeAndValue),
+		Defs:      make(map[*ast.Ident]types.Object),
+		Uses:      make(map[*ast.Ident]types.Object),
+		Instances: make(map[*ast.Ident]types.Instance),
+	}
+	conf := types.Config{Importer: &stubImporter{fset: fset}}
+	_, err = conf.Check("app", fset, []*ast.File{f}, info)
+	assert.NoError(t, err)
+
+	diags := Analyze([]*ast.File{f}, info)
+	lines := make([]int, len(diags))
+	for i, d := range diags {
+		lines[i] = fset.Position(d.Pos).Line
+	}
+	assert.Equal(t, []int{17, 19, 24, 25, 29, 30}, lines)
+	assert.Equal(t, "turboalloc.New instantiated with app.user: app.user.Name is a string, "+
+		"which the garbage collector can not see off-heap", diags[0].Message)
+	assert.Contains(t, diags[2].Message, "pool memory converted to *app.user")
+	assert.Contains(t, diags[3].Message, "map")
+	assert.Contains(t, diags[4].Message, "turboalloc.ArenaSlice instantiated with *app.point")
+	assert.Contains(t, diags[5].Message, "turboalloc.ArenaNew instantiated with app.user")
+}
@@ -0,0 +1,105 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package offheap checks whether Go types can be stored in memory the garbage collector
+// does not scan, such as the mmap regions handed out by the allocator. A value stored
+// off-heap must not hold pointers, maps, slices, strings, interfaces, channels or funcs,
+// because the collector would neither keep their targets alive nor update them.
+package offheap
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// ErrPointerType is returned for types holding memory the garbage collector must scan.
+var ErrPointerType = errors.New("type contains go pointers")
+
+// cache maps every checked reflect.Type to its *TypeError, nil for valid types.
+var cache sync.Map
+
+// TypeError describes why a type can not live off-heap.
+type TypeError struct {
+	// Type is the checked type.
+	Type reflect.Type
+	// Path locates the offending component inside Type, such as ".Items[0].Name", it is
+	// empty when Type itself is the offending type.
+	Path string
+	// Kind is the kind of the offending component.
+	Kind reflect.Kind
+}
+
+func (e *TypeError) Error() string {
+	return fmt.Sprintf("%s: %s%s is a %s", ErrPointerType, e.Type, e.Path, e.Kind)
+}
+
+func (e *TypeError) Unwrap() error {
+	return ErrPointerType
+}
+
+// Check returns nil when values of typ can be stored off-heap, and a *TypeError wrapping
+// ErrPointerType otherwise. Results are cached per type.
+func Check(typ reflect.Type) error {
+	if typ == nil {
+		return fmt.Errorf("%w: nil type", ErrPointerType)
+	}
+
+	te, ok := cache.Load(typ)
+	if !ok {
+		var result *TypeError
+		if path, kind, found := find(typ, ""); found {
+			result = &TypeError{Type: typ, Path: path, Kind: kind}
+		}
+		te, _ = cache.LoadOrStore(typ, result)
+	}
+
+	// A nil *TypeError must not be returned as a non-nil error.
+	if result := te.(*TypeError); result != nil {
+		return result
+	}
+
+	return nil
+}
+
+// CheckType is Check for the type argument T.
+func CheckType[T any]() error {
+	return Check(reflect.TypeFor[T]())
+}
+
+// find walks typ depth first and returns the path and kind of the first component the
+// garbage collector must scan.
+func find(typ reflect.Type, path string) (string, reflect.Kind, bool) {
+	switch typ.Kind() {
+	case reflect.Array:
+		if typ.Len() == 0 {
+			return "", 0, false
+		}
+		return find(typ.Elem(), path+"[0]")
+	case reflect.Struct:
+		for i := 0; i < typ.NumField(); i++ {
+			f := typ.Field(i)
+			if p, kind, ok := find(f.Type, path+"."+f.Name); ok {
+				return p, kind, true
+			}
+		}
+		return "", 0, false
+	case reflect.Pointer, reflect.UnsafePointer, reflect.Map, reflect.Slice, reflect.String,
+		reflect.Interface, reflect.Chan, reflect.Func:
+		return path, typ.Kind(), true
+	default:
+		return "", 0, false
+	}
+}
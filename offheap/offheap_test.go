@@ -0,0 +1,92 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package offheap
+
+import (
+	"reflect"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type header struct {
+	ID    uint64
+	Flags [4]uint8
+}
+
+type record struct {
+	Header header
+	Items  [2]struct {
+		Key  int
+		Name string
+	}
+}
+
+func TestCheck(t *testing.T) {
+	valid := []reflect.Type{
+		reflect.TypeFor[int](),
+		reflect.TypeFor[float64](),
+		reflect.TypeFor[complex128](),
+		reflect.TypeFor[header](),
+		reflect.TypeFor[[8]header](),
+		reflect.TypeFor[[0]*int](),
+		reflect.TypeFor[uintptr](),
+	}
+	for _, typ := range valid {
+		assert.NoError(t, Check(typ), typ.String())
+	}
+
+	invalid := []struct {
+		typ  reflect.Type
+		path string
+		kind reflect.Kind
+	}{
+		{reflect.TypeFor[*int](), "", reflect.Pointer},
+		{reflect.TypeFor[unsafe.Pointer](), "", reflect.UnsafePointer},
+		{reflect.TypeFor[map[int]int](), "", reflect.Map},
+		{reflect.TypeFor[[]byte](), "", reflect.Slice},
+		{reflect.TypeFor[string](), "", reflect.String},
+		{reflect.TypeFor[any](), "", reflect.Interface},
+		{reflect.TypeFor[chan int](), "", reflect.Chan},
+		{reflect.TypeFor[func()](), "", reflect.Func},
+		{reflect.TypeFor[record](), ".Items[0].Name", reflect.String},
+	}
+	for _, tc := range invalid {
+		err := Check(tc.typ)
+		assert.ErrorIs(t, err, ErrPointerType, tc.typ.String())
+
+		var te *TypeError
+		assert.ErrorAs(t, err, &te)
+		assert.Equal(t, tc.path, te.Path)
+		assert.Equal(t, tc.kind, te.Kind)
+	}
+
+	assert.ErrorIs(t, Check(nil), ErrPointerType)
+}
+
+func TestCheck_Cached(t *testing.T) {
+	typ := reflect.TypeFor[record]()
+	first := Check(typ)
+	assert.Same(t, first, Check(typ))
+
+	type uncached struct{ A int32 }
+	_, ok := cache.Load(reflect.TypeFor[uncached]())
+	assert.False(t, ok)
+	assert.NoError(t, CheckType[uncached]())
+	v, ok := cache.Load(reflect.TypeFor[uncached]())
+	assert.True(t, ok)
+	assert.Nil(t, v)
+}
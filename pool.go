@@ -15,11 +15,17 @@
 package turboalloc
 
 import (
+	"fmt"
+	"io"
 	"sync/atomic"
+	"unsafe"
 
+	"github.com/TimeWtr/TurboAlloc/common"
 	"github.com/TimeWtr/TurboAlloc/core"
 	"github.com/TimeWtr/TurboAlloc/eviction"
 	"github.com/TimeWtr/TurboAlloc/guardian"
+	"github.com/TimeWtr/TurboAlloc/syscall"
+	"github.com/TimeWtr/TurboAlloc/weight"
 )
 
 type Pool struct {
@@ -28,4 +34,258 @@ type Pool struct {
 	evict     eviction.Eviction
 	totalSize atomic.Uint64
 	pageSize  atomic.Uint64
+	cfg       Config
+}
+
+// NewPool creates a Pool whose small and medium managers are sharded according to
+// the default global weights.
+func NewPool(cfg Config) (*Pool, error) {
+	sys, err := syscall.NewLinuxSyscall(cfg.PageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	topo, err := cfg.numaTopology()
+	if err != nil {
+		return nil, err
+	}
+
+	global := weight.DefaultGlobalWeightConfig()
+	m, err := core.NewManager(global.Small, global.Medium, global.Large,
+		core.WithSyscall(sys),
+		core.WithHugePage(cfg.EnableHugePage),
+		core.WithShardSelector(cfg.ShardSelector),
+		core.WithLargeRetainedBytes(cfg.LargeRetainedBytes),
+		core.WithNUMA(topo, cfg.NumaPolicy),
+		core.WithScavenger(cfg.CompactionRatio, cfg.scavengeInterval(), cfg.LazyRelease),
+		core.WithZeroOnFree(cfg.ZeroOnFree),
+		core.WithFreeCheck(cfg.FreeCheck, cfg.OnFreeError),
+		core.WithLeakTracking(cfg.LeakTracking),
+		core.WithHeapProfile(cfg.HeapProfileRate),
+		core.WithTracing(cfg.TraceEvents),
+		core.WithDebug(cfg.DebugMode, cfg.DebugQuarantineBytes, cfg.OnViolation),
+		core.WithStatsEmitter(cfg.StatsInterval, cfg.OnStats))
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Pool{
+		m:   m,
+		cfg: cfg,
+	}
+	p.pageSize.Store(uint64(sys.PageSize()))
+	return p, nil
+}
+
+// Alloc returns a pointer to at least size bytes of off-heap memory. The memory is
+// not tracked by the Go garbage collector and must be returned with Free.
+func (p *Pool) Alloc(size int) (unsafe.Pointer, error) {
+	ptr, err := p.m.Alloc(size)
+	if err != nil {
+		return nil, err
+	}
+
+	p.totalSize.Add(uint64(p.m.UsableSize(size)))
+	return ptr, nil
+}
+
+// Free returns memory obtained from Alloc, size must match the size passed to Alloc.
+func (p *Pool) Free(ptr unsafe.Pointer, size int) error {
+	if err := p.m.Free(ptr, size); err != nil {
+		return err
+	}
+
+	p.totalSize.Add(^uint64(p.m.UsableSize(size) - 1))
+	return nil
+}
+
+// AllocZeroed returns a pointer to at least size bytes of zeroed off-heap memory, it
+// must be returned with Free.
+func (p *Pool) AllocZeroed(size int) (unsafe.Pointer, error) {
+	ptr, err := p.m.AllocZeroed(size)
+	if err != nil {
+		return nil, err
+	}
+
+	p.totalSize.Add(uint64(p.m.UsableSize(size)))
+	return ptr, nil
+}
+
+// AllocAligned returns a pointer to at least size bytes of off-heap memory aligned to
+// align, which must be a power of two. The memory must be returned with FreeAligned.
+func (p *Pool) AllocAligned(size, align int) (unsafe.Pointer, error) {
+	ptr, err := p.m.AllocAligned(size, align)
+	if err != nil {
+		return nil, err
+	}
+
+	p.totalSize.Add(uint64(p.m.UsableSizeAligned(size, align)))
+	return ptr, nil
+}
+
+// FreeAligned returns memory obtained from AllocAligned, size and align must match the
+// values passed to AllocAligned.
+func (p *Pool) FreeAligned(ptr unsafe.Pointer, size, align int) error {
+	if err := p.m.FreeAligned(ptr, size, align); err != nil {
+		return err
+	}
+
+	p.totalSize.Add(^uint64(p.m.UsableSizeAligned(size, align) - 1))
+	return nil
+}
+
+// Realloc resizes memory obtained from Alloc from oldSize to newSize bytes and returns
+// its new address, the first min(oldSize, newSize) bytes are preserved. oldSize must
+// match the size passed to Alloc. A nil ptr allocates newSize bytes.
+func (p *Pool) Realloc(ptr unsafe.Pointer, oldSize, newSize int) (unsafe.Pointer, error) {
+	moved, err := p.m.Realloc(ptr, oldSize, newSize)
+	if err != nil {
+		return nil, err
+	}
+
+	if ptr != nil {
+		p.totalSize.Add(^uint64(p.m.UsableSize(oldSize) - 1))
+	}
+	p.totalSize.Add(uint64(p.m.UsableSize(newSize)))
+	return moved, nil
+}
+
+// AllocBatch fills out with pointers to at least size bytes of off-heap memory each.
+// On error none of the entries is filled. The memory must be returned with Free or
+// FreeBatch.
+func (p *Pool) AllocBatch(size int, out []unsafe.Pointer) error {
+	if err := p.m.AllocBatch(size, out); err != nil {
+		return err
+	}
+
+	p.totalSize.Add(uint64(p.m.UsableSize(size) * len(out)))
+	return nil
+}
+
+// FreeBatch returns memory obtained from Alloc or AllocBatch, every pointer must have
+// been allocated with size bytes.
+func (p *Pool) FreeBatch(size int, ptrs []unsafe.Pointer) error {
+	n, err := p.m.FreeBatch(size, ptrs)
+	if n > 0 {
+		p.totalSize.Add(^uint64(p.m.UsableSize(size)*n - 1))
+	}
+
+	return err
+}
+
+// FreeUnsized returns memory obtained from any allocation method of the pool without
+// its size, which is looked up from the address.
+func (p *Pool) FreeUnsized(ptr unsafe.Pointer) error {
+	size, err := p.m.FreeUnsized(ptr)
+	if err != nil {
+		return err
+	}
+
+	p.totalSize.Add(^uint64(size - 1))
+	return nil
+}
+
+// SizeOf returns the usable size of the memory starting at ptr, which is at least the
+// size it was allocated with. It fails with core.ErrInvalidPointer when ptr was not
+// returned by the pool.
+func (p *Pool) SizeOf(ptr unsafe.Pointer) (int, error) {
+	return p.m.SizeOf(ptr)
+}
+
+// Owns reports whether ptr is the start of memory currently or previously handed out
+// by the pool.
+func (p *Pool) Owns(ptr unsafe.Pointer) bool {
+	_, err := p.m.SizeOf(ptr)
+	return err == nil
+}
+
+// TotalSize returns the number of bytes currently allocated from the pool, counting the
+// usable size of every block, see SizeOf.
+func (p *Pool) TotalSize() uint64 {
+	return p.totalSize.Load()
+}
+
+// SmallShardStats returns the per-shard hit and steal counters of every small size class.
+func (p *Pool) SmallShardStats() map[common.SizeClass][]core.ShardStats {
+	return p.m.SmallShardStats()
+}
+
+// MediumShardStats returns the per-shard hit and steal counters of the medium manager.
+func (p *Pool) MediumShardStats() []core.ShardStats {
+	return p.m.MediumShardStats()
+}
+
+// HugePageStats reports how many bytes of the pool are backed by huge pages, it is
+// empty unless Config.EnableHugePage is set.
+func (p *Pool) HugePageStats() (core.HugePageStats, error) {
+	return p.m.HugePageStats()
+}
+
+// NodeStats reports the bytes mapped on every NUMA node, it is empty unless
+// Config.NumaNodes is positive.
+func (p *Pool) NodeStats() []core.NodeStats {
+	return p.m.NodeStats()
+}
+
+// Scavenge returns the fully free pages of the size classes whose free-to-used ratio
+// exceeds Config.CompactionRatio to the OS, it returns the number of bytes released.
+func (p *Pool) Scavenge() uint64 {
+	return p.m.Scavenge()
+}
+
+// ScavengeStats returns the cumulative counters of the scavenger.
+func (p *Pool) ScavengeStats() core.ScavengeStats {
+	return p.m.ScavengeStats()
+}
+
+// Stats returns a snapshot of the per size class and per size category statistics.
+func (p *Pool) Stats() core.Stats {
+	return p.m.Stats()
+}
+
+// SubscribeStats returns a channel receiving a snapshot every Config.StatsInterval and a
+// function cancelling the subscription. Snapshots are dropped while the channel's buffer
+// of buffer snapshots is full.
+func (p *Pool) SubscribeStats(buffer int) (<-chan core.Stats, func()) {
+	return p.m.SubscribeStats(buffer)
+}
+
+// LiveAllocations returns the bytes not freed yet grouped by the call site that
+// allocated them, largest first. It is nil unless Config.LeakTracking is set.
+func (p *Pool) LiveAllocations() []core.LiveAllocation {
+	return p.m.LiveAllocations()
+}
+
+// CheckLeaks returns an error wrapping core.ErrLeak when memory of the pool is still
+// allocated, listing the call sites when Config.LeakTracking is set. Tests call it at
+// teardown, for instance from t.Cleanup.
+func (p *Pool) CheckLeaks() error {
+	if !p.cfg.LeakTracking {
+		if n := p.TotalSize(); n > 0 {
+			return fmt.Errorf("%w: %d bytes, set Config.LeakTracking to find their call sites", core.ErrLeak, n)
+		}
+		return nil
+	}
+
+	return p.m.CheckLeaks()
+}
+
+// WriteHeapProfile writes a gzip compressed pprof profile of the pool allocations to w,
+// with the alloc_objects, alloc_space, inuse_objects and inuse_space sample types of the
+// Go heap profile. It fails with core.ErrProfilingDisabled unless Config.HeapProfileRate
+// is positive.
+func (p *Pool) WriteHeapProfile(w io.Writer) error {
+	return p.m.WriteHeapProfile(w)
+}
+
+// WriteTrace writes the allocations and frees kept by the tracer to w, oldest first, in
+// the format read by core.ReadTrace. It fails with core.ErrTracingDisabled unless
+// Config.TraceEvents is positive.
+func (p *Pool) WriteTrace(w io.Writer) error {
+	return p.m.WriteTrace(w)
+}
+
+// Close stops the background goroutines of the pool. Memory handed out stays valid.
+func (p *Pool) Close() error {
+	return p.m.Close()
 }
@@ -0,0 +1,347 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turboalloc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/TimeWtr/TurboAlloc/common"
+	"github.com/TimeWtr/TurboAlloc/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestPool(t *testing.T) *Pool {
+	t.Helper()
+	p, err := NewPool(Config{})
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, p.Close())
+	})
+	return p
+}
+
+func TestPool_AllocFree_AllSizeClasses(t *testing.T) {
+	p := newTestPool(t)
+	for sc := common.SizeClass8B; sc <= common.SizeClassMax; sc++ {
+		size := sc.Size()
+		ptr, err := p.Alloc(size)
+		assert.NoError(t, err, sc.String())
+		assert.NotNil(t, ptr)
+
+		data := unsafe.Slice((*byte)(ptr), size)
+		data[0], data[size-1] = 0xAB, 0xCD
+		assert.Equal(t, byte(0xAB), data[0])
+		assert.Equal(t, byte(0xCD), data[size-1])
+
+		assert.NoError(t, p.Free(ptr, size))
+	}
+	assert.Equal(t, uint64(0), p.TotalSize())
+}
+
+func TestPool_Alloc_InvalidSize(t *testing.T) {
+	p := newTestPool(t)
+	_, err := p.Alloc(0)
+	assert.ErrorIs(t, err, core.ErrInvalidSize)
+	_, err = p.Alloc(-1)
+	assert.ErrorIs(t, err, core.ErrInvalidSize)
+	_, err = p.Alloc(common.SizeClassMax.Size() + 1)
+	assert.ErrorIs(t, err, core.ErrSizeTooLarge)
+}
+
+func TestPool_Free_NilPointer(t *testing.T) {
+	p := newTestPool(t)
+	assert.ErrorIs(t, p.Free(nil, common.B64), core.ErrInvalidPointer)
+}
+
+func TestPool_Scavenge(t *testing.T) {
+	p, err := NewPool(Config{CompactionRatio: 0.5, ScavengeInterval: time.Hour})
+	assert.NoError(t, err)
+	defer func() {
+		assert.NoError(t, p.Close())
+	}()
+
+	ptr, err := p.Alloc(common.MB)
+	assert.NoError(t, err)
+	assert.NoError(t, p.Free(ptr, common.MB))
+
+	assert.Equal(t, uint64(common.MB), p.Scavenge())
+	assert.Equal(t, core.ScavengeStats{Cycles: 1, ReleasedBytes: common.MB}, p.ScavengeStats())
+}
+
+func TestPool_Stats(t *testing.T) {
+	snapshots := make(chan core.Stats, 1)
+	p, err := NewPool(Config{StatsInterval: time.Millisecond, OnStats: func(st core.Stats) {
+		select {
+		case snapshots <- st:
+		default:
+		}
+	}})
+	assert.NoError(t, err)
+	defer func() {
+		assert.NoError(t, p.Close())
+	}()
+
+	ptr, err := p.Alloc(common.KB)
+	assert.NoError(t, err)
+	st := p.Stats()
+	assert.Equal(t, int64(common.KB), st.Classes[common.SizeClass1KB].InUseBytes)
+	assert.Equal(t, int64(common.KB), st.Categories[common.SmallSizeCategory].InUseBytes)
+	assert.NoError(t, p.Free(ptr, common.KB))
+
+	select {
+	case st = <-snapshots:
+		assert.Equal(t, uint64(1), st.Categories[common.AllSizeCategory].Allocs)
+	case <-time.After(time.Second):
+		t.Fatal("no snapshot emitted")
+	}
+}
+
+func TestPool_Realloc(t *testing.T) {
+	p := newTestPool(t)
+	ptr, err := p.Realloc(nil, 0, common.KB)
+	assert.NoError(t, err)
+	*(*uint64)(ptr) = 42
+
+	ptr, err = p.Realloc(ptr, common.KB, common.MB*2)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(common.MB*2), p.TotalSize())
+	ptr, err = p.Realloc(ptr, common.MB*2, common.MB*8)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(42), *(*uint64)(ptr))
+
+	assert.NoError(t, p.Free(ptr, common.MB*8))
+	assert.Zero(t, p.TotalSize())
+}
+
+func TestPool_AllocAligned_AllSizeClasses(t *testing.T) {
+	p := newTestPool(t)
+	aligns := []int{common.B8, common.B64, common.B512, common.KB * 4, common.KB * 64, common.MB * 2}
+	for sc := common.SizeClass8B; sc <= common.SizeClassMax; sc++ {
+		size := sc.Size()
+		for _, align := range aligns {
+			ptr, err := p.AllocAligned(size, align)
+			assert.NoError(t, err, "%s/%d", sc, align)
+			assert.Zero(t, uintptr(ptr)%uintptr(align), "%s/%d", sc, align)
+
+			data := unsafe.Slice((*byte)(ptr), size)
+			data[0], data[size-1] = 0xAB, 0xCD
+			assert.NoError(t, p.FreeAligned(ptr, size, align), "%s/%d", sc, align)
+		}
+	}
+	assert.Zero(t, p.TotalSize())
+
+	_, err := p.AllocAligned(common.B64, 48)
+	assert.ErrorIs(t, err, core.ErrInvalidAlignment)
+	_, err = p.AllocAligned(common.B64, 0)
+	assert.ErrorIs(t, err, core.ErrInvalidAlignment)
+}
+
+func TestPool_AllocZeroed(t *testing.T) {
+	p, err := NewPool(Config{ZeroOnFree: true})
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, p.Close())
+	})
+
+	for _, size := range []int{common.B64, common.KB * 10, common.MB} {
+		ptr, err := p.AllocZeroed(size)
+		assert.NoError(t, err)
+		data := unsafe.Slice((*byte)(ptr), size)
+		assert.Equal(t, make([]byte, size), data)
+		for i := range data {
+			data[i] = 0xFF
+		}
+		assert.NoError(t, p.Free(ptr, size))
+
+		ptr, err = p.AllocZeroed(size)
+		assert.NoError(t, err)
+		assert.Equal(t, make([]byte, size), unsafe.Slice((*byte)(ptr), size))
+		assert.NoError(t, p.Free(ptr, size))
+	}
+	assert.Zero(t, p.TotalSize())
+}
+
+func TestPool_AllocFreeBatch(t *testing.T) {
+	p := newTestPool(t)
+	for _, size := range []int{common.B64, common.KB * 16} {
+		ptrs := make([]unsafe.Pointer, 100)
+		assert.NoError(t, p.AllocBatch(size, ptrs))
+		assert.Equal(t, uint64(size*len(ptrs)), p.TotalSize())
+		assert.NoError(t, p.FreeBatch(size, ptrs))
+		assert.Zero(t, p.TotalSize())
+	}
+}
+
+// benchmarkBatchSize is the number of blocks handled per tick by the batch benchmarks.
+const benchmarkBatchSize = 256
+
+func BenchmarkPool_AllocFree(b *testing.B) {
+	p, err := NewPool(Config{})
+	assert.NoError(b, err)
+	defer p.Close()
+
+	ptrs := make([]unsafe.Pointer, benchmarkBatchSize)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := range ptrs {
+			ptrs[j], _ = p.Alloc(common.B64)
+		}
+		for _, ptr := range ptrs {
+			_ = p.Free(ptr, common.B64)
+		}
+	}
+}
+
+func BenchmarkPool_AllocFreeBatch(b *testing.B) {
+	p, err := NewPool(Config{})
+	assert.NoError(b, err)
+	defer p.Close()
+
+	ptrs := make([]unsafe.Pointer, benchmarkBatchSize)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = p.AllocBatch(common.B64, ptrs)
+		_ = p.FreeBatch(common.B64, ptrs)
+	}
+}
+
+func TestPool_FreeUnsized(t *testing.T) {
+	p := newTestPool(t)
+	ptr, err := p.Alloc(common.KB * 2)
+	assert.NoError(t, err)
+	assert.True(t, p.Owns(ptr))
+	size, err := p.SizeOf(ptr)
+	assert.NoError(t, err)
+	assert.Equal(t, common.KB*2, size)
+
+	assert.NoError(t, p.FreeUnsized(ptr))
+	assert.Zero(t, p.TotalSize())
+
+	// Sized and unsized frees of blocks that are not a size class account alike.
+	ptrs := make([]unsafe.Pointer, 0, 4)
+	for _, size := range []int{100, 100, common.KB * 200, common.KB * 200} {
+		ptr, err = p.Alloc(size)
+		assert.NoError(t, err)
+		ptrs = append(ptrs, ptr)
+	}
+	assert.Equal(t, uint64(common.B128*2+common.KB*200*2), p.TotalSize())
+	assert.NoError(t, p.FreeUnsized(ptrs[0]))
+	assert.NoError(t, p.Free(ptrs[1], 100))
+	assert.NoError(t, p.FreeUnsized(ptrs[2]))
+	assert.NoError(t, p.Free(ptrs[3], common.KB*200))
+	assert.Zero(t, p.TotalSize())
+
+	var local [16]byte
+	assert.False(t, p.Owns(unsafe.Pointer(&local)))
+	assert.ErrorIs(t, p.FreeUnsized(unsafe.Pointer(&local)), core.ErrInvalidPointer)
+}
+
+func TestPool_DebugMode(t *testing.T) {
+	p, err := NewPool(Config{DebugMode: true})
+	assert.NoError(t, err)
+	defer p.Close()
+
+	buf, err := AllocSlice[byte](p, 10)
+	assert.NoError(t, err)
+	*(*byte)(unsafe.Add(unsafe.Pointer(&buf[0]), len(buf))) = 1
+	assert.ErrorIs(t, FreeSlice(p, buf), core.ErrCorruption)
+}
+
+func TestPool_FreeCheck(t *testing.T) {
+	var reported []error
+	p, err := NewPool(Config{FreeCheck: core.FreeCheckExact, OnFreeError: func(err error) {
+		reported = append(reported, err)
+	}})
+	assert.NoError(t, err)
+	defer p.Close()
+
+	ptr, err := p.Alloc(100)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, p.Free(ptr, 120), core.ErrSizeMismatch)
+	assert.NoError(t, p.Free(ptr, 100))
+	assert.ErrorIs(t, p.Free(ptr, 100), core.ErrDoubleFree)
+	assert.Len(t, reported, 2)
+	assert.Zero(t, p.TotalSize())
+}
+
+func TestPool_CheckLeaks(t *testing.T) {
+	for _, tracking := range []bool{false, true} {
+		p, err := NewPool(Config{LeakTracking: tracking})
+		assert.NoError(t, err)
+
+		buf, err := AllocSlice[int64](p, 100)
+		assert.NoError(t, err)
+		err = p.CheckLeaks()
+		assert.ErrorIs(t, err, core.ErrLeak)
+		if tracking {
+			assert.Contains(t, err.Error(), "TestPool_CheckLeaks")
+			assert.Len(t, p.LiveAllocations(), 1)
+		} else {
+			assert.Nil(t, p.LiveAllocations())
+		}
+
+		assert.NoError(t, FreeSlice(p, buf))
+		assert.NoError(t, p.CheckLeaks())
+		assert.NoError(t, p.Close())
+	}
+}
+
+func TestPool_WriteHeapProfile(t *testing.T) {
+	p := newTestPool(t)
+	assert.ErrorIs(t, p.WriteHeapProfile(io.Discard), core.ErrProfilingDisabled)
+
+	p, err := NewPool(Config{HeapProfileRate: 1})
+	assert.NoError(t, err)
+	defer p.Close()
+	ptr, err := p.Alloc(common.KB)
+	assert.NoError(t, err)
+	defer func() { assert.NoError(t, p.Free(ptr, common.KB)) }()
+
+	var buf bytes.Buffer
+	assert.NoError(t, p.WriteHeapProfile(&buf))
+	zr, err := gzip.NewReader(&buf)
+	assert.NoError(t, err)
+	data, err := io.ReadAll(zr)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "TestPool_WriteHeapProfile")
+}
+
+func TestPool_WriteTrace(t *testing.T) {
+	p := newTestPool(t)
+	assert.ErrorIs(t, p.WriteTrace(io.Discard), core.ErrTracingDisabled)
+
+	p, err := NewPool(Config{TraceEvents: 16})
+	assert.NoError(t, err)
+	defer p.Close()
+	ptr, err := p.Alloc(common.KB)
+	assert.NoError(t, err)
+	assert.NoError(t, p.Free(ptr, common.KB))
+
+	var buf bytes.Buffer
+	assert.NoError(t, p.WriteTrace(&buf))
+	trace, err := core.ReadTrace(&buf)
+	assert.NoError(t, err)
+	assert.Len(t, trace.Events, 2)
+	assert.Equal(t, core.TraceAlloc, trace.Events[0].Op)
+	assert.Equal(t, core.TraceFree, trace.Events[1].Op)
+	assert.Equal(t, trace.Events[0].Addr, trace.Events[1].Addr)
+}
@@ -0,0 +1,471 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package syscall
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// ErrInjectedFailure is returned by FakeSyscall.AllocPages once the failure budget set
+// with FailAfter is exhausted.
+var ErrInjectedFailure = errors.New("injected allocation failure")
+
+type fakeRange struct {
+	offset int
+	size   int
+}
+
+// FakeSyscall is an in-memory Syscall for tests. It reserves a single region up front
+// and hands out pages from it first-fit by lowest address, so allocation sequences
+// produce the same offsets on every run. Like munmap, FreePages accepts any page range,
+// but it rejects ranges containing a page that is not allocated. Page protections are
+// recorded instead of applied, and allocations can be told to fail after a number of
+// successful calls.
+type FakeSyscall struct {
+	mu sync.Mutex
+	// region is the reserved mapping, base is its first pageSize aligned address.
+	region   unsafe.Pointer
+	base     unsafe.Pointer
+	capacity int
+	pageSize int
+	// free holds the unused ranges of the region sorted by offset.
+	free []fakeRange
+	// live marks the allocated pages.
+	live        []bool
+	liveBytes   int
+	protections map[int]int
+	allocs      int
+	frees       int
+	// released is the total number of bytes passed to ReleasePages.
+	released int
+	remaps   int
+	// transparent holds the ranges handed out as transparent huge page regions.
+	transparent  []fakeRange
+	hugeTLBPages int
+	// nodes maps the page index of bound pages to their node.
+	nodes map[int]int
+	// failAfter is the number of allocations left before AllocPages fails, negative
+	// means never.
+	failAfter int
+}
+
+// NewFakeSyscall reserves capacity bytes, rounded up to whole pages, for allocations
+// of pageSize bytes pages. pageSize must be a power of two.
+func NewFakeSyscall(pageSize, capacity int) (*FakeSyscall, error) {
+	if pageSize <= 0 || pageSize&(pageSize-1) != 0 {
+		return nil, fmt.Errorf("invalid page size: %d", pageSize)
+	}
+
+	capacity = AlignUp(capacity, pageSize)
+	if capacity <= 0 {
+		return nil, fmt.Errorf("invalid capacity: %d", capacity)
+	}
+
+	// Over-reserve by one page so the region can be aligned to pageSize.
+	base, err := mmap(capacity+pageSize, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FakeSyscall{
+		region:      base,
+		base:        unsafe.Add(base, AlignUp(int(uintptr(base)), pageSize)-int(uintptr(base))),
+		capacity:    capacity,
+		pageSize:    pageSize,
+		free:        []fakeRange{{offset: 0, size: capacity}},
+		live:        make([]bool, capacity/pageSize),
+		protections: make(map[int]int),
+		nodes:       make(map[int]int),
+		failAfter:   -1,
+	}, nil
+}
+
+func (f *FakeSyscall) AllocPages(size int) (unsafe.Pointer, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid alloc size: %d", size)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ptr, err := f.allocLocked(AlignUp(size, f.pageSize), f.pageSize)
+	if err == nil {
+		f.allocs++
+	}
+	return ptr, err
+}
+
+// allocLocked takes the lowest free range that fits size bytes at an address aligned
+// to align, splitting off the unaligned head and the tail.
+func (f *FakeSyscall) allocLocked(size, align int) (unsafe.Pointer, error) {
+	if f.failAfter == 0 {
+		return nil, ErrInjectedFailure
+	}
+
+	baseAddr := int(uintptr(f.base))
+	for i, r := range f.free {
+		offset := AlignUp(baseAddr+r.offset, align) - baseAddr
+		head := offset - r.offset
+		if r.size-head < size {
+			continue
+		}
+
+		var parts []fakeRange
+		if head > 0 {
+			parts = append(parts, fakeRange{offset: r.offset, size: head})
+		}
+		if tail := r.size - head - size; tail > 0 {
+			parts = append(parts, fakeRange{offset: offset + size, size: tail})
+		}
+		f.free = append(f.free[:i], append(parts, f.free[i+1:]...)...)
+
+		if f.failAfter > 0 {
+			f.failAfter--
+		}
+		f.liveBytes += size
+		for p := offset; p < offset+size; p += f.pageSize {
+			f.live[p/f.pageSize] = true
+		}
+		return unsafe.Add(f.base, offset), nil
+	}
+
+	return nil, fmt.Errorf("failed to alloc pages, errno: %w", syscall.ENOMEM)
+}
+
+// AllocHugePages hands out a HugePageSize aligned range. It reports HugePageHugeTLB
+// while pages reserved with SetHugeTLBPages remain, HugePageTransparent otherwise.
+func (f *FakeSyscall) AllocHugePages(size int, hugeTLB bool) (unsafe.Pointer, HugePageKind, error) {
+	if size <= 0 {
+		return nil, HugePageNone, fmt.Errorf("invalid alloc size: %d", size)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	size = AlignUp(size, HugePageSize)
+	ptr, err := f.allocLocked(size, HugePageSize)
+	if err != nil {
+		return nil, HugePageNone, err
+	}
+	f.allocs++
+
+	if hugeTLB && f.hugeTLBPages >= size/HugePageSize {
+		f.hugeTLBPages -= size / HugePageSize
+		return ptr, HugePageHugeTLB, nil
+	}
+
+	f.transparent = append(f.transparent, fakeRange{offset: f.Offset(ptr), size: size})
+	return ptr, HugePageTransparent, nil
+}
+
+// HugePageBytes reports every byte of a region that overlaps a transparent huge page
+// allocation as backed by huge pages.
+func (f *FakeSyscall) HugePageBytes(regions []Region) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	total := 0
+	for _, r := range regions {
+		start := f.Offset(r.Ptr)
+		end := start + r.Size
+		for _, t := range f.transparent {
+			if overlap := min(end, t.offset+t.size) - max(start, t.offset); overlap > 0 {
+				total += overlap
+			}
+		}
+	}
+
+	return total, nil
+}
+
+// SetHugeTLBPages sets the number of hugetlbfs pages AllocHugePages can hand out.
+func (f *FakeSyscall) SetHugeTLBPages(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.hugeTLBPages = n
+}
+
+func (f *FakeSyscall) FreePages(ptr unsafe.Pointer, size int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.freeLocked(ptr, size); err != nil {
+		return err
+	}
+
+	f.frees++
+	return nil
+}
+
+// freeLocked returns the pages of the range to the free ranges.
+func (f *FakeSyscall) freeLocked(ptr unsafe.Pointer, size int) error {
+	offset, err := f.offsetOf(ptr)
+	if err != nil {
+		return err
+	}
+
+	size = AlignUp(size, f.pageSize)
+	if size <= 0 || offset+size > f.capacity {
+		return fmt.Errorf("failed to free pages, errno: %w", syscall.EINVAL)
+	}
+
+	for p := offset; p < offset+size; p += f.pageSize {
+		if !f.live[p/f.pageSize] {
+			return fmt.Errorf("failed to free pages, errno: %w", syscall.EINVAL)
+		}
+	}
+
+	// Drop the contents so the range is zero-filled when handed out again, like a
+	// fresh mapping.
+	if err = madvise(ptr, size, syscall.MADV_DONTNEED); err != nil {
+		return err
+	}
+
+	f.liveBytes -= size
+	f.dropTransparent(offset, size)
+	for p := offset; p < offset+size; p += f.pageSize {
+		f.live[p/f.pageSize] = false
+		delete(f.protections, p)
+		delete(f.nodes, p/f.pageSize)
+	}
+
+	idx := sort.Search(len(f.free), func(i int) bool { return f.free[i].offset > offset })
+	f.free = append(f.free, fakeRange{})
+	copy(f.free[idx+1:], f.free[idx:])
+	f.free[idx] = fakeRange{offset: offset, size: size}
+	f.coalesce(idx)
+	return nil
+}
+
+// dropTransparent removes the freed range from the transparent huge page ranges.
+func (f *FakeSyscall) dropTransparent(offset, size int) {
+	kept := make([]fakeRange, 0, len(f.transparent))
+	for _, t := range f.transparent {
+		if head := offset - t.offset; head > 0 {
+			kept = append(kept, fakeRange{offset: t.offset, size: min(head, t.size)})
+		}
+		if tail := t.offset + t.size - (offset + size); tail > 0 {
+			kept = append(kept, fakeRange{offset: max(offset+size, t.offset), size: min(tail, t.size)})
+		}
+	}
+	f.transparent = kept
+}
+
+// coalesce merges the free range at idx with its neighbours.
+func (f *FakeSyscall) coalesce(idx int) {
+	if idx+1 < len(f.free) && f.free[idx].offset+f.free[idx].size == f.free[idx+1].offset {
+		f.free[idx].size += f.free[idx+1].size
+		f.free = append(f.free[:idx+1], f.free[idx+2:]...)
+	}
+
+	if idx > 0 && f.free[idx-1].offset+f.free[idx-1].size == f.free[idx].offset {
+		f.free[idx-1].size += f.free[idx].size
+		f.free = append(f.free[:idx], f.free[idx+1:]...)
+	}
+}
+
+// RemapPages moves the range to the lowest free range that fits newSize bytes and copies
+// its contents, like mremap with MREMAP_MAYMOVE when the range can not grow in place.
+// Remaps are counted separately from allocations and frees.
+func (f *FakeSyscall) RemapPages(ptr unsafe.Pointer, oldSize, newSize int) (unsafe.Pointer, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	offset, err := f.offsetOf(ptr)
+	if err != nil {
+		return nil, err
+	}
+
+	oldSize, newSize = AlignUp(oldSize, f.pageSize), AlignUp(newSize, f.pageSize)
+	if oldSize <= 0 || newSize <= 0 || offset+oldSize > f.capacity {
+		return nil, fmt.Errorf("failed to remap pages, errno: %w", syscall.EINVAL)
+	}
+	for p := offset; p < offset+oldSize; p += f.pageSize {
+		if !f.live[p/f.pageSize] {
+			return nil, fmt.Errorf("failed to remap pages, errno: %w", syscall.EFAULT)
+		}
+	}
+
+	moved, err := f.allocLocked(newSize, f.pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	copy(unsafe.Slice((*byte)(moved), newSize), unsafe.Slice((*byte)(ptr), min(oldSize, newSize)))
+	if err = f.freeLocked(ptr, oldSize); err != nil {
+		return nil, err
+	}
+
+	f.remaps++
+	return moved, nil
+}
+
+// Remaps returns the number of successful RemapPages calls.
+func (f *FakeSyscall) Remaps() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.remaps
+}
+
+// ReleasePages drops the contents of the range like MADV_DONTNEED, whether lazy is set
+// or not, so tests observe the worst case of MADV_FREE.
+func (f *FakeSyscall) ReleasePages(ptr unsafe.Pointer, size int, _ bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	offset, err := f.offsetOf(ptr)
+	if err != nil {
+		return err
+	}
+
+	size = AlignUp(size, f.pageSize)
+	if size <= 0 || offset+size > f.capacity {
+		return fmt.Errorf("failed to release pages, errno: %w", syscall.EINVAL)
+	}
+
+	for p := offset; p < offset+size; p += f.pageSize {
+		if !f.live[p/f.pageSize] {
+			return fmt.Errorf("failed to release pages, errno: %w", syscall.EINVAL)
+		}
+	}
+
+	if err = madvise(ptr, size, syscall.MADV_DONTNEED); err != nil {
+		return err
+	}
+
+	f.released += size
+	return nil
+}
+
+func (f *FakeSyscall) SetProtection(ptr unsafe.Pointer, prot int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	offset, err := f.offsetOf(ptr)
+	if err != nil {
+		return err
+	}
+
+	f.protections[offset] = prot
+	return nil
+}
+
+func (f *FakeSyscall) PageSize() int {
+	return f.pageSize
+}
+
+// Protection returns the protection recorded for the page at ptr, pages that were never
+// changed report ProtRead|ProtWrite.
+func (f *FakeSyscall) Protection(ptr unsafe.Pointer) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	offset, err := f.offsetOf(ptr)
+	if err != nil {
+		return ProtNone
+	}
+
+	if prot, ok := f.protections[offset]; ok {
+		return prot
+	}
+
+	return ProtRead | ProtWrite
+}
+
+// BindNode records node as the node of every page in the range.
+func (f *FakeSyscall) BindNode(ptr unsafe.Pointer, size, node int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	offset, err := f.offsetOf(ptr)
+	if err != nil {
+		return err
+	}
+
+	for p := offset; p < offset+AlignUp(size, f.pageSize); p += f.pageSize {
+		f.nodes[p/f.pageSize] = node
+	}
+
+	return nil
+}
+
+// NodeOf returns the node recorded for the page containing ptr, pages that were never
+// bound report node 0.
+func (f *FakeSyscall) NodeOf(ptr unsafe.Pointer) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	offset := int(uintptr(ptr) - uintptr(f.base))
+	if uintptr(ptr) < uintptr(f.base) || offset >= f.capacity {
+		return 0, fmt.Errorf("invalid pointer: %p", ptr)
+	}
+
+	return f.nodes[offset/f.pageSize], nil
+}
+
+// FailAfter makes AllocPages fail once n more allocations succeeded, a negative n
+// disables failure injection.
+func (f *FakeSyscall) FailAfter(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failAfter = n
+}
+
+// LiveBytes returns the number of bytes currently allocated.
+func (f *FakeSyscall) LiveBytes() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.liveBytes
+}
+
+// Calls returns the number of successful AllocPages and FreePages calls.
+func (f *FakeSyscall) Calls() (allocs, frees int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.allocs, f.frees
+}
+
+// ReleasedBytes returns the total number of bytes passed to ReleasePages.
+func (f *FakeSyscall) ReleasedBytes() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.released
+}
+
+// Offset returns the offset of ptr from the start of the reserved region.
+func (f *FakeSyscall) Offset(ptr unsafe.Pointer) int {
+	return int(uintptr(ptr) - uintptr(f.base))
+}
+
+// Close releases the reserved region, every pointer handed out becomes invalid.
+func (f *FakeSyscall) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return freePages(f.region, f.capacity+f.pageSize)
+}
+
+func (f *FakeSyscall) offsetOf(ptr unsafe.Pointer) (int, error) {
+	offset := int(uintptr(ptr) - uintptr(f.base))
+	if uintptr(ptr) < uintptr(f.base) || offset >= f.capacity || offset%f.pageSize != 0 {
+		return 0, fmt.Errorf("invalid pointer: %p", ptr)
+	}
+
+	return offset, nil
+}
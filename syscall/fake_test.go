@@ -0,0 +1,160 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package syscall
+
+import (
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestFake(t *testing.T, capacity int) *FakeSyscall {
+	t.Helper()
+	f, err := NewFakeSyscall(pageSize, capacity)
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, f.Close())
+	})
+	return f
+}
+
+func TestFakeSyscall_DeterministicFirstFit(t *testing.T) {
+	f := newTestFake(t, pageSize*16)
+	a, err := f.AllocPages(1)
+	assert.NoError(t, err)
+	b, err := f.AllocPages(pageSize * 2)
+	assert.NoError(t, err)
+	c, err := f.AllocPages(pageSize)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, f.Offset(a))
+	assert.Equal(t, pageSize, f.Offset(b))
+	assert.Equal(t, pageSize*3, f.Offset(c))
+	assert.Equal(t, pageSize*4, f.LiveBytes())
+
+	// The freed hole is reused by the next allocation that fits.
+	assert.NoError(t, f.FreePages(b, pageSize*2))
+	d, err := f.AllocPages(pageSize)
+	assert.NoError(t, err)
+	assert.Equal(t, pageSize, f.Offset(d))
+
+	allocs, frees := f.Calls()
+	assert.Equal(t, 4, allocs)
+	assert.Equal(t, 1, frees)
+}
+
+func TestFakeSyscall_ReusedPagesAreZeroed(t *testing.T) {
+	f := newTestFake(t, pageSize*4)
+	ptr, err := f.AllocPages(pageSize)
+	assert.NoError(t, err)
+	writeTestData(ptr, pageSize)
+	assert.NoError(t, f.FreePages(ptr, pageSize))
+
+	ptr, err = f.AllocPages(pageSize)
+	assert.NoError(t, err)
+	for _, v := range unsafe.Slice((*byte)(ptr), pageSize) {
+		assert.Equal(t, byte(0), v)
+	}
+}
+
+func TestFakeSyscall_FreeSpanningAllocations(t *testing.T) {
+	f := newTestFake(t, pageSize*4)
+	a, err := f.AllocPages(pageSize)
+	assert.NoError(t, err)
+	_, err = f.AllocPages(pageSize * 2)
+	assert.NoError(t, err)
+
+	// Like munmap, a single call may release several adjacent allocations.
+	assert.NoError(t, f.FreePages(a, pageSize*3))
+	assert.Equal(t, 0, f.LiveBytes())
+	all, err := f.AllocPages(pageSize * 4)
+	assert.NoError(t, err)
+	assert.Equal(t, a, all)
+}
+
+func TestFakeSyscall_InvalidFree(t *testing.T) {
+	f := newTestFake(t, pageSize*4)
+	ptr, err := f.AllocPages(pageSize)
+	assert.NoError(t, err)
+
+	assert.Error(t, f.FreePages(unsafe.Add(ptr, 1), pageSize))
+	assert.Error(t, f.FreePages(ptr, pageSize*2))
+	var v int
+	assert.Error(t, f.FreePages(unsafe.Pointer(&v), pageSize))
+	assert.NoError(t, f.FreePages(ptr, pageSize))
+	assert.Error(t, f.FreePages(ptr, pageSize))
+}
+
+func TestFakeSyscall_FailAfterAndExhaustion(t *testing.T) {
+	f := newTestFake(t, pageSize*2)
+	f.FailAfter(1)
+	_, err := f.AllocPages(pageSize)
+	assert.NoError(t, err)
+	_, err = f.AllocPages(pageSize)
+	assert.ErrorIs(t, err, ErrInjectedFailure)
+
+	f.FailAfter(-1)
+	_, err = f.AllocPages(pageSize)
+	assert.NoError(t, err)
+	_, err = f.AllocPages(pageSize)
+	assert.Error(t, err)
+}
+
+func TestFakeSyscall_RecordsProtection(t *testing.T) {
+	f := newTestFake(t, pageSize*2)
+	ptr, err := f.AllocPages(pageSize)
+	assert.NoError(t, err)
+	assert.Equal(t, ProtRead|ProtWrite, f.Protection(ptr))
+	assert.NoError(t, f.SetProtection(ptr, ProtNone))
+	assert.Equal(t, ProtNone, f.Protection(ptr))
+	assert.NoError(t, f.FreePages(ptr, pageSize))
+	assert.Equal(t, ProtRead|ProtWrite, f.Protection(ptr))
+}
+
+func TestFakeSyscall_ReleasePages(t *testing.T) {
+	f := newTestFake(t, pageSize*4)
+	ptr, err := f.AllocPages(pageSize * 2)
+	assert.NoError(t, err)
+	writeTestData(ptr, pageSize*2)
+
+	assert.NoError(t, f.ReleasePages(ptr, pageSize*2, true))
+	assert.Equal(t, pageSize*2, f.ReleasedBytes())
+	assert.Equal(t, pageSize*2, f.LiveBytes())
+	for _, v := range unsafe.Slice((*byte)(ptr), pageSize*2) {
+		assert.Equal(t, byte(0), v)
+	}
+
+	// Only pages that are allocated can be released.
+	assert.Error(t, f.ReleasePages(unsafe.Add(ptr, pageSize*2), pageSize, false))
+}
+
+func TestFakeSyscall_RemapPages(t *testing.T) {
+	f := newTestFake(t, pageSize*8)
+	ptr, err := f.AllocPages(pageSize)
+	assert.NoError(t, err)
+	writeTestData(ptr, pageSize)
+
+	moved, err := f.RemapPages(ptr, pageSize, pageSize*3)
+	assert.NoError(t, err)
+	assert.NoError(t, verifyTestData(moved, pageSize))
+	assert.Equal(t, pageSize*3, f.LiveBytes())
+	assert.Equal(t, 1, f.Remaps())
+	allocs, frees := f.Calls()
+	assert.Equal(t, 1, allocs)
+	assert.Zero(t, frees)
+
+	_, err = f.RemapPages(ptr, pageSize, pageSize*2)
+	assert.Error(t, err)
+}
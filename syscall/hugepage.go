@@ -0,0 +1,222 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package syscall
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// HugePageSize is the size of the huge pages requested by AllocHugePages.
+const HugePageSize = 2 * 1024 * 1024
+
+const (
+	// mapHugeTLB is MAP_HUGETLB, which the standard syscall package does not export
+	// on every architecture.
+	mapHugeTLB = 0x40000
+	// madvHugePage is MADV_HUGEPAGE.
+	madvHugePage = 14
+)
+
+const (
+	freeHugePagesPath = "/sys/kernel/mm/hugepages/hugepages-2048kB/free_hugepages"
+	smapsPath         = "/proc/self/smaps"
+)
+
+// HugePageKind reports how a region returned by AllocHugePages is backed.
+type HugePageKind int
+
+const (
+	// HugePageNone means the region is aligned but uses regular pages, because
+	// neither hugetlbfs pages nor transparent huge pages are available.
+	HugePageNone HugePageKind = iota
+	// HugePageTransparent means the region was advised with MADV_HUGEPAGE, the kernel
+	// backs it with transparent huge pages as they become available.
+	HugePageTransparent
+	// HugePageHugeTLB means the region is mapped with MAP_HUGETLB from the pages
+	// reserved in hugetlbfs.
+	HugePageHugeTLB
+)
+
+// Region describes a mapped memory range.
+type Region struct {
+	Ptr  unsafe.Pointer
+	Size int
+}
+
+// HugePageSyscall is implemented by Syscall implementations that can back memory with
+// huge pages.
+type HugePageSyscall interface {
+	Syscall
+	// AllocHugePages maps size bytes, rounded up to HugePageSize, at a HugePageSize
+	// aligned address. When hugeTLB is true and enough hugetlbfs pages are free the
+	// region is mapped with MAP_HUGETLB, such regions can only be unmapped as a whole.
+	// Otherwise transparent huge pages are requested with madvise.
+	AllocHugePages(size int, hugeTLB bool) (unsafe.Pointer, HugePageKind, error)
+	// HugePageBytes returns how many bytes of the transparent huge page regions are
+	// currently backed by huge pages.
+	HugePageBytes(regions []Region) (int, error)
+}
+
+func (l *LinuxSyscall) AllocHugePages(size int, hugeTLB bool) (unsafe.Pointer, HugePageKind, error) {
+	if size <= 0 {
+		return nil, HugePageNone, fmt.Errorf("invalid alloc size: %d", size)
+	}
+
+	size = AlignUp(size, HugePageSize)
+	if hugeTLB && freeHugePages() >= size/HugePageSize {
+		ptr, err := mmap(size, syscall.MAP_ANON|syscall.MAP_PRIVATE|mapHugeTLB)
+		if err == nil {
+			return ptr, HugePageHugeTLB, nil
+		}
+	}
+
+	ptr, err := mmapAligned(size, HugePageSize)
+	if err != nil {
+		return nil, HugePageNone, err
+	}
+
+	if err = madvise(ptr, size, madvHugePage); err != nil {
+		return ptr, HugePageNone, nil
+	}
+
+	return ptr, HugePageTransparent, nil
+}
+
+func (l *LinuxSyscall) HugePageBytes(regions []Region) (int, error) {
+	data, err := os.ReadFile(smapsPath)
+	if err != nil {
+		return 0, err
+	}
+
+	return anonHugePageBytes(data, regions), nil
+}
+
+// mmapAligned maps size bytes at an address aligned to align by over-reserving and
+// unmapping the unaligned head and the tail.
+func mmapAligned(size, align int) (unsafe.Pointer, error) {
+	ptr, err := mmap(size+align, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+	if err != nil {
+		return nil, err
+	}
+
+	head := AlignUp(int(uintptr(ptr)), align) - int(uintptr(ptr))
+	if head > 0 {
+		if err = freePages(ptr, head); err != nil {
+			return nil, err
+		}
+	}
+
+	aligned := unsafe.Add(ptr, head)
+	if tail := align - head; tail > 0 {
+		if err = freePages(unsafe.Add(aligned, size), tail); err != nil {
+			return nil, err
+		}
+	}
+
+	return aligned, nil
+}
+
+// freeHugePages returns the number of free 2MB pages reserved in hugetlbfs.
+func freeHugePages() int {
+	data, err := os.ReadFile(freeHugePagesPath)
+	if err != nil {
+		return 0
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0
+	}
+
+	return n
+}
+
+// anonHugePageBytes sums the AnonHugePages of the smaps mappings overlapping regions.
+// A mapping usually covers several adjacent regions, so its huge pages are attributed
+// to each region in proportion to the overlap.
+func anonHugePageBytes(smaps []byte, regions []Region) int {
+	var (
+		total      float64
+		start, end uintptr
+	)
+
+	scanner := bufio.NewScanner(bytes.NewReader(smaps))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if s, e, ok := parseMappingRange(line); ok {
+			start, end = s, e
+			continue
+		}
+
+		if !strings.HasPrefix(line, "AnonHugePages:") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		const kb = 1024
+		const valueField = 1
+		if len(fields) <= valueField {
+			continue
+		}
+
+		huge, err := strconv.Atoi(fields[valueField])
+		if err != nil || huge == 0 {
+			continue
+		}
+
+		for _, r := range regions {
+			rs := uintptr(r.Ptr)
+			re := rs + uintptr(r.Size)
+			overlap := min(re, end) - max(rs, start)
+			if rs < end && re > start && overlap > 0 {
+				total += float64(huge*kb) * float64(overlap) / float64(end-start)
+			}
+		}
+	}
+
+	return int(total)
+}
+
+// parseMappingRange parses the "start-end perms ..." header line of a smaps entry.
+func parseMappingRange(line string) (start, end uintptr, ok bool) {
+	rng, _, found := strings.Cut(line, " ")
+	if !found {
+		return 0, 0, false
+	}
+
+	s, e, found := strings.Cut(rng, "-")
+	if !found {
+		return 0, 0, false
+	}
+
+	startVal, err := strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	endVal, err := strconv.ParseUint(e, 16, 64)
+	if err != nil || endVal <= startVal {
+		return 0, 0, false
+	}
+
+	return uintptr(startVal), uintptr(endVal), true
+}
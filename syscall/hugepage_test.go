@@ -0,0 +1,89 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package syscall
+
+import (
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLinuxSyscall_AllocHugePages(t *testing.T) {
+	l, err := NewLinuxSyscall(0)
+	assert.NoError(t, err)
+
+	ptr, kind, err := l.AllocHugePages(HugePageSize+1, false)
+	assert.NoError(t, err)
+	assert.NotEqual(t, HugePageHugeTLB, kind)
+	assert.Zero(t, uintptr(ptr)%HugePageSize)
+
+	size := HugePageSize * 2
+	writeTestData(ptr, size)
+	assert.NoError(t, verifyTestData(ptr, size))
+
+	backed, err := l.HugePageBytes([]Region{{Ptr: ptr, Size: size}})
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, backed, 0)
+	assert.LessOrEqual(t, backed, size)
+	t.Logf("huge page kind %d, %d of %d bytes backed by huge pages", kind, backed, size)
+
+	assert.NoError(t, l.FreePages(ptr, size))
+}
+
+func TestAnonHugePageBytes(t *testing.T) {
+	smaps := []byte(`7f0000000000-7f0000400000 rw-p 00000000 00:00 0
+Size:               4096 kB
+AnonHugePages:      2048 kB
+7f0000400000-7f0000600000 rw-p 00000000 00:00 0
+AnonHugePages:         0 kB
+7f1000000000-7f1000200000 rw-p 00000000 00:00 0 [heap]
+AnonHugePages:      2048 kB
+`)
+	base := uintptr(0x7f0000000000)
+	region := func(offset, size uintptr) Region {
+		addr := base + offset
+		return Region{Ptr: *(*unsafe.Pointer)(unsafe.Pointer(&addr)), Size: int(size)}
+	}
+
+	// A region covering half of the first mapping is attributed half of its huge pages.
+	assert.Equal(t, HugePageSize/2, anonHugePageBytes(smaps, []Region{region(0, HugePageSize)}))
+	assert.Equal(t, HugePageSize, anonHugePageBytes(smaps, []Region{region(0, HugePageSize*3)}))
+	assert.Zero(t, anonHugePageBytes(smaps, []Region{region(HugePageSize*2, HugePageSize)}))
+}
+
+func TestFakeSyscall_AllocHugePages(t *testing.T) {
+	f := newTestFake(t, HugePageSize*4)
+	f.SetHugeTLBPages(1)
+	_, err := f.AllocPages(pageSize)
+	assert.NoError(t, err)
+
+	ptr, kind, err := f.AllocHugePages(1, true)
+	assert.NoError(t, err)
+	assert.Equal(t, HugePageHugeTLB, kind)
+	assert.Zero(t, uintptr(ptr)%HugePageSize)
+
+	ptr, kind, err = f.AllocHugePages(HugePageSize, true)
+	assert.NoError(t, err)
+	assert.Equal(t, HugePageTransparent, kind)
+	backed, err := f.HugePageBytes([]Region{{Ptr: ptr, Size: HugePageSize}})
+	assert.NoError(t, err)
+	assert.Equal(t, HugePageSize, backed)
+
+	assert.NoError(t, f.FreePages(ptr, HugePageSize))
+	backed, err = f.HugePageBytes([]Region{{Ptr: ptr, Size: HugePageSize}})
+	assert.NoError(t, err)
+	assert.Zero(t, backed)
+}
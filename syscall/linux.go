@@ -0,0 +1,95 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package syscall
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// madvFree is MADV_FREE, which the standard syscall package does not export.
+const madvFree = 8
+
+// LinuxSyscall implements Syscall with anonymous private mmap regions.
+type LinuxSyscall struct {
+	pageSize int
+}
+
+// NewLinuxSyscall creates a LinuxSyscall handling pages of pageSize bytes. A zero
+// pageSize selects the OS page size, otherwise it must be a power of two multiple of it.
+func NewLinuxSyscall(pageSize int) (*LinuxSyscall, error) {
+	osPageSize := os.Getpagesize()
+	if pageSize == 0 {
+		pageSize = osPageSize
+	}
+
+	if pageSize < osPageSize || pageSize&(pageSize-1) != 0 {
+		return nil, fmt.Errorf("invalid page size %d, must be a power of two multiple of %d",
+			pageSize, osPageSize)
+	}
+
+	return &LinuxSyscall{pageSize: pageSize}, nil
+}
+
+func (l *LinuxSyscall) AllocPages(size int) (unsafe.Pointer, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid alloc size: %d", size)
+	}
+
+	size = AlignUp(size, l.pageSize)
+	if l.pageSize > os.Getpagesize() {
+		// mmap only aligns to the OS page, the pointer checks of SetProtection,
+		// ReleasePages and RemapPages expect pageSize alignment.
+		return mmapAligned(size, l.pageSize)
+	}
+
+	return mmap(size, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+}
+
+func (l *LinuxSyscall) FreePages(ptr unsafe.Pointer, size int) error {
+	return freePages(ptr, AlignUp(size, l.pageSize))
+}
+
+func (l *LinuxSyscall) SetProtection(ptr unsafe.Pointer, prot int) error {
+	if ptr == nil || uintptr(ptr)%uintptr(l.pageSize) != 0 {
+		return fmt.Errorf("invalid pointer: %p", ptr)
+	}
+
+	return mprotect(ptr, l.pageSize, prot)
+}
+
+func (l *LinuxSyscall) PageSize() int {
+	return l.pageSize
+}
+
+// ReleasePages advises the kernel with MADV_DONTNEED, or MADV_FREE when lazy is set.
+// Kernels older than 4.5 reject MADV_FREE, the range is then released eagerly.
+func (l *LinuxSyscall) ReleasePages(ptr unsafe.Pointer, size int, lazy bool) error {
+	if ptr == nil || uintptr(ptr)%uintptr(l.pageSize) != 0 {
+		return fmt.Errorf("invalid pointer: %p", ptr)
+	}
+
+	size = AlignUp(size, l.pageSize)
+	if lazy {
+		if err := madvise(ptr, size, madvFree); !errors.Is(err, syscall.EINVAL) {
+			return err
+		}
+	}
+
+	return madvise(ptr, size, syscall.MADV_DONTNEED)
+}
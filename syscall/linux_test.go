@@ -0,0 +1,189 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package syscall
+
+import (
+	"os"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewLinuxSyscall_PageSize(t *testing.T) {
+	osPageSize := os.Getpagesize()
+	tests := []struct {
+		name     string
+		pageSize int
+		expected int
+		wantErr  bool
+	}{
+		{"default", 0, osPageSize, false},
+		{"os page size", osPageSize, osPageSize, false},
+		{"multiple", osPageSize * 4, osPageSize * 4, false},
+		{"smaller than os page", osPageSize / 2, 0, true},
+		{"not power of two", osPageSize * 3, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := NewLinuxSyscall(tt.pageSize)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, l.PageSize())
+		})
+	}
+}
+
+func TestLinuxSyscall_AllocRoundsToPageSize(t *testing.T) {
+	l, err := NewLinuxSyscall(os.Getpagesize() * 4)
+	assert.NoError(t, err)
+
+	ptr, err := l.AllocPages(1)
+	assert.NoError(t, err)
+	writeTestData(ptr, l.PageSize())
+	assert.NoError(t, verifyTestData(ptr, l.PageSize()))
+	assert.NoError(t, l.FreePages(ptr, 1))
+
+	_, err = l.AllocPages(0)
+	assert.Error(t, err)
+}
+
+func TestLinuxSyscall_SetProtection(t *testing.T) {
+	l, err := NewLinuxSyscall(0)
+	assert.NoError(t, err)
+	ptr, err := l.AllocPages(l.PageSize())
+	assert.NoError(t, err)
+	defer func() {
+		assert.NoError(t, l.FreePages(ptr, l.PageSize()))
+	}()
+
+	*(*byte)(ptr) = 42
+	assert.NoError(t, l.SetProtection(ptr, ProtRead))
+	assert.Equal(t, byte(42), *(*byte)(ptr))
+	assert.NoError(t, l.SetProtection(ptr, ProtRead|ProtWrite))
+	*(*byte)(ptr) = 43
+	assert.Equal(t, byte(43), *(*byte)(ptr))
+
+	assert.Error(t, l.SetProtection(nil, ProtRead))
+}
+
+func TestLinuxSyscall_BindNode(t *testing.T) {
+	l, err := NewLinuxSyscall(0)
+	assert.NoError(t, err)
+
+	ptr, err := l.AllocPages(l.PageSize())
+	assert.NoError(t, err)
+	defer func() {
+		assert.NoError(t, l.FreePages(ptr, l.PageSize()))
+	}()
+
+	if err = l.BindNode(ptr, l.PageSize(), 0); err != nil {
+		t.Skipf("mbind is not available: %v", err)
+	}
+	writeTestData(ptr, l.PageSize())
+	node, err := l.NodeOf(ptr)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, node)
+
+	assert.Error(t, l.BindNode(ptr, l.PageSize(), -1))
+}
+
+func TestLinuxSyscall_ReleasePages(t *testing.T) {
+	l, err := NewLinuxSyscall(0)
+	assert.NoError(t, err)
+
+	size := l.PageSize() * 2
+	ptr, err := l.AllocPages(size)
+	assert.NoError(t, err)
+	defer func() {
+		assert.NoError(t, l.FreePages(ptr, size))
+	}()
+
+	writeTestData(ptr, size)
+	assert.NoError(t, l.ReleasePages(ptr, size, false))
+	for _, v := range unsafe.Slice((*byte)(ptr), size) {
+		assert.Equal(t, byte(0), v)
+	}
+
+	// The range stays mapped and usable after a lazy release.
+	writeTestData(ptr, size)
+	assert.NoError(t, l.ReleasePages(ptr, size, true))
+	writeTestData(ptr, size)
+	assert.NoError(t, verifyTestData(ptr, size))
+
+	assert.Error(t, l.ReleasePages(unsafe.Add(ptr, 1), size, false))
+}
+
+func TestLinuxSyscall_RemapPages(t *testing.T) {
+	l, err := NewLinuxSyscall(0)
+	assert.NoError(t, err)
+
+	size := l.PageSize() * 4
+	ptr, err := l.AllocPages(size)
+	assert.NoError(t, err)
+	writeTestData(ptr, size)
+
+	moved, err := l.RemapPages(ptr, size, size*64)
+	assert.NoError(t, err)
+	assert.NoError(t, verifyTestData(moved, size))
+	last := unsafe.Add(moved, size*64-1)
+	*(*byte)(last) = 1
+	assert.NoError(t, l.FreePages(moved, size*64))
+
+	_, err = l.RemapPages(unsafe.Add(ptr, 1), size, size)
+	assert.Error(t, err)
+}
+
+func TestLinuxSyscall_LargePageSizeAlignment(t *testing.T) {
+	const pageSize = 64 * 1024
+	if os.Getpagesize() > pageSize {
+		t.Skipf("OS page size %d exceeds %d", os.Getpagesize(), pageSize)
+	}
+	l, err := NewLinuxSyscall(pageSize)
+	assert.NoError(t, err)
+
+	ptrs := make([]unsafe.Pointer, 0, 20)
+	for range 20 {
+		ptr, err := l.AllocPages(200 * 1024)
+		assert.NoError(t, err)
+		assert.Zero(t, uintptr(ptr)%pageSize)
+		writeTestData(ptr, 200*1024)
+		ptrs = append(ptrs, ptr)
+	}
+
+	ptr := ptrs[0]
+	assert.NoError(t, l.SetProtection(ptr, ProtRead))
+	assert.NoError(t, l.SetProtection(ptr, ProtRead|ProtWrite))
+	assert.NoError(t, l.ReleasePages(ptr, pageSize, false))
+
+	// Growing a region past its neighbours may move it.
+	moved, err := l.RemapPages(ptrs[1], 200*1024, 4*1024*1024)
+	assert.NoError(t, err)
+	assert.Zero(t, uintptr(moved)%pageSize)
+	assert.NoError(t, verifyTestData(moved, 200*1024))
+	ptrs[1] = moved
+
+	for i, p := range ptrs {
+		size := 200 * 1024
+		if i == 1 {
+			size = 4 * 1024 * 1024
+		}
+		assert.NoError(t, l.FreePages(p, size))
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package syscall
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// mpolPreferred is MPOL_PREFERRED: allocate on the node, fall back to other
+	// nodes when it runs out of memory.
+	mpolPreferred = 1
+	// mpolFNode and mpolFAddr make get_mempolicy return the node backing an address.
+	mpolFNode = 1
+	mpolFAddr = 2
+	// maxNodes is the number of nodes representable in the node mask passed to mbind.
+	maxNodes = 64
+)
+
+// NUMASyscall is implemented by Syscall implementations that can place memory on a
+// specific NUMA node.
+type NUMASyscall interface {
+	Syscall
+	// BindNode sets the memory policy of size bytes starting at ptr to prefer node.
+	BindNode(ptr unsafe.Pointer, size, node int) error
+	// NodeOf returns the node backing the page at ptr.
+	NodeOf(ptr unsafe.Pointer) (int, error)
+}
+
+func (l *LinuxSyscall) BindNode(ptr unsafe.Pointer, size, node int) error {
+	if node < 0 || node >= maxNodes {
+		return fmt.Errorf("invalid numa node: %d", node)
+	}
+
+	mask := uint64(1) << node
+	_, _, errno := syscall.Syscall6(
+		syscall.SYS_MBIND,
+		uintptr(ptr),
+		uintptr(AlignUp(size, l.pageSize)),
+		mpolPreferred,
+		uintptr(unsafe.Pointer(&mask)),
+		maxNodes+1,
+		0)
+	if errno != 0 {
+		return fmt.Errorf("failed to bind pages to node %d, errno: %w", node, errno)
+	}
+
+	return nil
+}
+
+func (l *LinuxSyscall) NodeOf(ptr unsafe.Pointer) (int, error) {
+	var node int32
+	_, _, errno := syscall.Syscall6(
+		syscall.SYS_GET_MEMPOLICY,
+		uintptr(unsafe.Pointer(&node)),
+		0,
+		0,
+		uintptr(ptr),
+		mpolFNode|mpolFAddr,
+		0)
+	if errno != 0 {
+		return 0, fmt.Errorf("failed to get node of %p, errno: %w", ptr, errno)
+	}
+
+	return int(node), nil
+}
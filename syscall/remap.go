@@ -0,0 +1,88 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package syscall
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// mremapMayMove is MREMAP_MAYMOVE: the kernel may move the mapping when it can not
+	// be resized in place.
+	mremapMayMove = 1
+	// mremapFixed is MREMAP_FIXED: the mapping is moved to the given target address.
+	mremapFixed = 2
+)
+
+// RemapSyscall is implemented by Syscall implementations that can resize a mapping
+// without copying its contents.
+type RemapSyscall interface {
+	Syscall
+	// RemapPages resizes the oldSize bytes mapped at ptr to newSize bytes, possibly moving
+	// them, and returns the new address. The old range must not be used afterwards.
+	RemapPages(ptr unsafe.Pointer, oldSize, newSize int) (unsafe.Pointer, error)
+}
+
+// RemapPages resizes the mapping with mremap, moving the pages by rewriting page tables
+// rather than copying their contents. The range must lie within a single mapping.
+func (l *LinuxSyscall) RemapPages(ptr unsafe.Pointer, oldSize, newSize int) (unsafe.Pointer, error) {
+	if ptr == nil || uintptr(ptr)%uintptr(l.pageSize) != 0 || oldSize <= 0 || newSize <= 0 {
+		return nil, fmt.Errorf("invalid remap of %p from %d to %d bytes", ptr, oldSize, newSize)
+	}
+
+	oldSize = AlignUp(oldSize, l.pageSize)
+	newSize = AlignUp(newSize, l.pageSize)
+	if l.pageSize <= os.Getpagesize() {
+		return mremap(ptr, oldSize, newSize, mremapMayMove, nil)
+	}
+
+	// A mapping moved by the kernel is only OS page aligned, so it is resized in place
+	// when possible and otherwise moved onto a pageSize aligned reservation.
+	if moved, err := mremap(ptr, oldSize, newSize, 0, nil); err == nil || newSize <= oldSize {
+		return moved, err
+	}
+
+	target, err := mmapAligned(newSize, l.pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	moved, err := mremap(ptr, oldSize, newSize, mremapMayMove|mremapFixed, target)
+	if err != nil {
+		_ = freePages(target, newSize)
+		return nil, err
+	}
+
+	return moved, nil
+}
+
+func mremap(ptr unsafe.Pointer, oldSize, newSize, flags int, target unsafe.Pointer) (unsafe.Pointer, error) {
+	addr, _, errno := syscall.Syscall6(
+		syscall.SYS_MREMAP,
+		uintptr(ptr),
+		uintptr(oldSize),
+		uintptr(newSize),
+		uintptr(flags),
+		uintptr(target),
+		0)
+	if errno != 0 {
+		return nil, fmt.Errorf("failed to remap pages, errno: %w", errno)
+	}
+
+	return *(*unsafe.Pointer)(unsafe.Pointer(&addr)), nil
+}
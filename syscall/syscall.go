@@ -29,13 +29,17 @@ func allocPages(numPages int) (unsafe.Pointer, error) {
 		return nil, fmt.Errorf("invalid number of pages: %d", numPages)
 	}
 
-	allocSize := numPages * pageSize
+	return mmap(numPages*pageSize, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+}
+
+// mmap maps size bytes of readable and writable memory with the given flags.
+func mmap(size, flags int) (unsafe.Pointer, error) {
 	memPtr, _, errno := syscall.Syscall6(
 		syscall.SYS_MMAP,
 		0,
-		uintptr(allocSize),
+		uintptr(size),
 		syscall.PROT_READ|syscall.PROT_WRITE,
-		syscall.MAP_ANON|syscall.MAP_PRIVATE,
+		uintptr(flags),
 		^uintptr(0),
 		0)
 	if errno != 0 {
@@ -46,7 +50,7 @@ func allocPages(numPages int) (unsafe.Pointer, error) {
 		return nil, fmt.Errorf("memory not page-aligned: %x", memPtr)
 	}
 
-	return unsafe.Pointer(memPtr), nil
+	return *(*unsafe.Pointer)(unsafe.Pointer(&memPtr)), nil
 }
 
 func freePages(ptr unsafe.Pointer, pageSize int) error {
@@ -65,3 +69,34 @@ func freePages(ptr unsafe.Pointer, pageSize int) error {
 
 	return nil
 }
+
+func mprotect(ptr unsafe.Pointer, size, prot int) error {
+	_, _, errno := syscall.Syscall(
+		syscall.SYS_MPROTECT,
+		uintptr(ptr),
+		uintptr(size),
+		uintptr(prot))
+	if errno != 0 {
+		return fmt.Errorf("failed to protect pages, errno: %w", errno)
+	}
+
+	return nil
+}
+
+func madvise(ptr unsafe.Pointer, size, advice int) error {
+	_, _, errno := syscall.Syscall(
+		syscall.SYS_MADVISE,
+		uintptr(ptr),
+		uintptr(size),
+		uintptr(advice))
+	if errno != 0 {
+		return fmt.Errorf("failed to advise pages, errno: %w", errno)
+	}
+
+	return nil
+}
+
+// AlignUp rounds size up to a multiple of align, which must be a power of two.
+func AlignUp(size, align int) int {
+	return (size + align - 1) &^ (align - 1)
+}
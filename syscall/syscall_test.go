@@ -107,7 +107,7 @@ func TestNegativePagesAllocation(t *testing.T) {
 }
 
 func TestFreeInvalidPointer(t *testing.T) {
-	invalidPtr := unsafe.Pointer(uintptr(0xdeadbeef))
+	invalidPtr := unsafe.Add(nil, 0xdeadbeef)
 	err := freePages(invalidPtr, pageSize)
 	if err == nil {
 		t.Error("expected error for freeing invalid pointer, got nil")
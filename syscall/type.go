@@ -14,10 +14,32 @@
 
 package syscall
 
-import "unsafe"
+import (
+	"syscall"
+	"unsafe"
+)
 
+// Syscall abstracts the OS memory primitives used by the allocator, so the managers
+// can run against a fake in tests.
 type Syscall interface {
+	// AllocPages maps size bytes, rounded up to whole pages, of zero-filled memory.
 	AllocPages(size int) (unsafe.Pointer, error)
+	// FreePages unmaps size bytes starting at ptr.
 	FreePages(ptr unsafe.Pointer, size int) error
+	// SetProtection changes the access protection of the page starting at ptr to prot,
+	// a combination of the Prot constants.
 	SetProtection(ptr unsafe.Pointer, prot int) error
+	// PageSize returns the size in bytes of the pages handled by the implementation.
+	PageSize() int
+	// ReleasePages returns the physical memory backing size bytes starting at ptr to the
+	// OS while keeping the range mapped. The range reads as zero afterwards, unless lazy
+	// is set, in which case the kernel may reclaim it only under memory pressure and the
+	// old contents can survive until then.
+	ReleasePages(ptr unsafe.Pointer, size int, lazy bool) error
 }
+
+const (
+	ProtNone  = syscall.PROT_NONE
+	ProtRead  = syscall.PROT_READ
+	ProtWrite = syscall.PROT_WRITE
+)
@@ -0,0 +1,131 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turboalloc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"unsafe"
+
+	"github.com/TimeWtr/TurboAlloc/offheap"
+)
+
+var (
+	// ErrPointerType is returned when a type holding Go pointers is allocated off-heap,
+	// the garbage collector would not see the pointers and free their targets.
+	ErrPointerType = offheap.ErrPointerType
+	// ErrZeroSizeType is returned when a zero-sized type is allocated off-heap.
+	ErrZeroSizeType = errors.New("type has zero size")
+	// ErrMisaligned is returned when the memory handed out does not satisfy the alignment
+	// of the type.
+	ErrMisaligned = errors.New("misaligned allocation")
+)
+
+// AllocSlice returns a zeroed slice of n values of T backed by pool memory. T must not
+// contain Go pointers. The slice must be returned with FreeSlice, without reslicing its
+// start.
+func AllocSlice[T any](p *Pool, n int) ([]T, error) {
+	size, err := sizeOf[T](n)
+	if err != nil {
+		return nil, err
+	}
+
+	ptr, err := p.allocTyped(size, unsafe.Alignof(*new(T)))
+	if err != nil {
+		return nil, err
+	}
+
+	return unsafe.Slice((*T)(ptr), n), nil
+}
+
+// FreeSlice returns a slice obtained from AllocSlice to the pool. The capacity of s must
+// be the one returned by AllocSlice.
+func FreeSlice[T any](p *Pool, s []T) error {
+	if cap(s) == 0 {
+		return nil
+	}
+
+	size, err := sizeOf[T](cap(s))
+	if err != nil {
+		return err
+	}
+
+	return p.Free(unsafe.Pointer(unsafe.SliceData(s)), size)
+}
+
+// New returns a pointer to a zeroed T backed by pool memory, the off-heap counterpart
+// of the new builtin. T must not contain Go pointers. The value must be returned with
+// Delete.
+func New[T any](p *Pool) (*T, error) {
+	size, err := sizeOf[T](1)
+	if err != nil {
+		return nil, err
+	}
+
+	ptr, err := p.allocTyped(size, unsafe.Alignof(*new(T)))
+	if err != nil {
+		return nil, err
+	}
+
+	return (*T)(ptr), nil
+}
+
+// Delete returns a value obtained from New to the pool.
+func Delete[T any](p *Pool, v *T) error {
+	size, err := sizeOf[T](1)
+	if err != nil {
+		return err
+	}
+
+	return p.Free(unsafe.Pointer(v), size)
+}
+
+// sizeOf returns the size in bytes of n values of T, checking that T can live off-heap.
+func sizeOf[T any](n int) (int, error) {
+	typ := reflect.TypeFor[T]()
+	if err := offheap.Check(typ); err != nil {
+		return 0, err
+	}
+
+	elem := int(typ.Size())
+	if elem == 0 {
+		return 0, fmt.Errorf("%w: %s", ErrZeroSizeType, typ)
+	}
+
+	if n <= 0 || n > math.MaxInt/elem {
+		return 0, fmt.Errorf("invalid length %d of %s", n, typ)
+	}
+
+	return n * elem, nil
+}
+
+// allocTyped allocates size zeroed bytes and checks the result against align. Blocks of every
+// size class are aligned to the smaller of their size and the page size, which covers
+// the alignment of every Go type.
+func (p *Pool) allocTyped(size int, align uintptr) (unsafe.Pointer, error) {
+	ptr, err := p.AllocZeroed(size)
+	if err != nil {
+		return nil, err
+	}
+
+	if uintptr(ptr)%align != 0 {
+		_ = p.Free(ptr, size)
+		return nil, fmt.Errorf("%w: %p is not aligned to %d", ErrMisaligned, ptr, align)
+	}
+
+	return ptr, nil
+}
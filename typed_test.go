@@ -0,0 +1,96 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package turboalloc
+
+import (
+	"testing"
+	"unsafe"
+
+	"github.com/TimeWtr/TurboAlloc/common"
+	"github.com/stretchr/testify/assert"
+)
+
+type point struct {
+	X, Y float64
+	Tag  [4]byte
+}
+
+func TestAllocSlice(t *testing.T) {
+	p := newTestPool(t)
+
+	for _, n := range []int{1, 7, 1000, common.KB * 64} {
+		s, err := AllocSlice[point](p, n)
+		assert.NoError(t, err)
+		assert.Len(t, s, n)
+		assert.Zero(t, uintptr(unsafe.Pointer(&s[0]))%unsafe.Alignof(point{}))
+		for i := range s {
+			assert.Equal(t, point{}, s[i])
+		}
+
+		s[n-1] = point{X: 1, Y: 2}
+		assert.NoError(t, FreeSlice(p, s))
+	}
+	assert.Zero(t, p.TotalSize())
+
+	// Recycled memory is zeroed again.
+	s, err := AllocSlice[uint64](p, 8)
+	assert.NoError(t, err)
+	for i := range s {
+		s[i] = ^uint64(0)
+	}
+	assert.NoError(t, FreeSlice(p, s))
+	s, err = AllocSlice[uint64](p, 8)
+	assert.NoError(t, err)
+	assert.Equal(t, make([]uint64, 8), s)
+	assert.NoError(t, FreeSlice(p, s))
+}
+
+func TestNewDelete(t *testing.T) {
+	p := newTestPool(t)
+
+	v, err := New[point](p)
+	assert.NoError(t, err)
+	assert.Equal(t, point{}, *v)
+	v.X = 3
+	size, err := p.SizeOf(unsafe.Pointer(v))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(size), p.TotalSize())
+	assert.NoError(t, Delete(p, v))
+	assert.Zero(t, p.TotalSize())
+}
+
+func TestTyped_RejectsInvalidTypes(t *testing.T) {
+	p := newTestPool(t)
+
+	_, err := New[*int](p)
+	assert.ErrorIs(t, err, ErrPointerType)
+	_, err = New[struct {
+		ID   int
+		Name string
+	}](p)
+	assert.ErrorIs(t, err, ErrPointerType)
+	_, err = AllocSlice[[2][]byte](p, 1)
+	assert.ErrorIs(t, err, ErrPointerType)
+	_, err = AllocSlice[map[int]int](p, 1)
+	assert.ErrorIs(t, err, ErrPointerType)
+
+	_, err = New[struct{}](p)
+	assert.ErrorIs(t, err, ErrZeroSizeType)
+	_, err = AllocSlice[int](p, 0)
+	assert.Error(t, err)
+	_, err = AllocSlice[[common.MB]byte](p, 64)
+	assert.Error(t, err)
+	assert.NoError(t, FreeSlice[int](p, nil))
+}
@@ -17,6 +17,7 @@ package weight
 import (
 	"context"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/TimeWtr/TurboAlloc/common"
@@ -39,6 +40,9 @@ type (
 	}
 )
 
+// dispatchTimeout is how long Dispatch waits for a listener to receive an event.
+const dispatchTimeout = time.Second
+
 // EventHubImpl manages event listeners and broadcasts events to them
 type EventHubImpl struct {
 	// Slice of listeners identified by tags
@@ -53,6 +57,8 @@ type EventHubImpl struct {
 	l log.Logger
 	// RWMutex for concurrent access protection
 	mu sync.RWMutex
+	// Number of events dropped because a listener did not receive them in time
+	timeouts atomic.Uint64
 }
 
 // newEventHubImpl creates a new EventHubImpl instance
@@ -116,7 +122,8 @@ func (d *EventHubImpl) Dispatch(ev Event) {
 			select {
 			case listener.ch <- ev:
 				// Event successfully sent
-			case <-time.After(time.Second):
+			case <-time.After(dispatchTimeout):
+				d.timeouts.Add(1)
 				d.l.Error("dispatch event error",
 					log.StringField("listener", listener.tag),
 					log.ErrorField(context.DeadlineExceeded))
@@ -128,6 +135,12 @@ func (d *EventHubImpl) Dispatch(ev Event) {
 	}
 }
 
+// DispatchTimeouts returns the number of events dropped because a listener did not
+// receive them within a second.
+func (d *EventHubImpl) DispatchTimeouts() uint64 {
+	return d.timeouts.Load()
+}
+
 // Close shuts down the dispatcher
 func (d *EventHubImpl) Close() {
 	d.once.Do(func() {
@@ -120,3 +120,19 @@ func TestClose(t *testing.T) {
 		t.Error("channel should be closed after Close()")
 	}
 }
+
+func TestDispatchTimeout(t *testing.T) {
+	logger := log.NewZapAdapter(zap.NewNop())
+	hub, _ := newEventHubImpl(logger).(*EventHubImpl)
+	hub.Register("tag1", common.SizeCategory(1))
+
+	hub.Dispatch(Event{category: common.SizeCategory(2)})
+	if n := hub.DispatchTimeouts(); n != 0 {
+		t.Errorf("expected no timeout for another category, got %d", n)
+	}
+
+	hub.Dispatch(Event{category: common.SizeCategory(1)})
+	if n := hub.DispatchTimeouts(); n != 1 {
+		t.Errorf("expected 1 timeout, got %d", n)
+	}
+}
@@ -36,6 +36,17 @@ type (
 		Close()
 	}
 
+	// ManagerStats holds the counters of a ManagerImpl.
+	ManagerStats struct {
+		// Reloads counts the configurations normalized and dispatched to the listeners
+		Reloads uint64
+		// NormalizationFailures counts the configurations rejected by the processor
+		NormalizationFailures uint64
+		// DispatchTimeouts counts the events dropped by the event hub because a listener
+		// did not receive them in time, it is only reported by EventHubImpl
+		DispatchTimeouts uint64
+	}
+
 	ManagerImpl struct {
 		// Configuration provider for watching config file changes
 		provider Provider
@@ -59,6 +70,9 @@ type (
 		state atomic.Int32
 		// WaitGroup to track background goroutines
 		wg sync.WaitGroup
+		// Counters reported by Stats
+		reloads               atomic.Uint64
+		normalizationFailures atomic.Uint64
 	}
 )
 
@@ -119,6 +133,7 @@ func (m *ManagerImpl) asyncLoop() {
 			// Normalize the raw configuration data
 			normalizeConf, err := m.processor.Normalize(rawData)
 			if err != nil {
+				m.normalizationFailures.Add(1)
 				m.l.Error("the original data normalization failed", log.ErrorField(err))
 				continue
 			}
@@ -130,6 +145,7 @@ func (m *ManagerImpl) asyncLoop() {
 			// Dispatch configuration change events to notify listeners
 			m.dispatchGlobalEvent(global)
 			m.dispatchSizeClassEvent(sizeClasses)
+			m.reloads.Add(1)
 		case <-m.closeCh:
 			// Handle manager shutdown request
 			m.l.Info("receive stop manager signal")
@@ -192,6 +208,20 @@ func (m *ManagerImpl) dispatchSizeClassEvent(sizeClasses map[common.SizeCategory
 	}
 }
 
+// Stats returns the reload, normalization failure and dispatch timeout counters of the
+// manager.
+func (m *ManagerImpl) Stats() ManagerStats {
+	st := ManagerStats{
+		Reloads:               m.reloads.Load(),
+		NormalizationFailures: m.normalizationFailures.Load(),
+	}
+	if hub, ok := m.eventHub.(*EventHubImpl); ok {
+		st.DispatchTimeouts = hub.DispatchTimeouts()
+	}
+
+	return st
+}
+
 // Close gracefully shuts down the ManagerImpl instance, ensuring all background processes are terminated
 // and resources are released. It performs the following steps:
 //  1. Attempts to switch the state from RunningState to StoppedState using atomic CAS.
@@ -0,0 +1,57 @@
+// Copyright 2025 TimeWtr
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package weight
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/TimeWtr/TurboAlloc/common"
+	"github.com/TimeWtr/TurboAlloc/utils/log"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	"go.uber.org/zap"
+)
+
+func TestManagerImpl_Stats(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	watcher := make(chan common.Config)
+	provider := NewMockProvider(ctrl)
+	provider.EXPECT().Watch().Return((<-chan common.Config)(watcher), nil)
+	closed := make(chan struct{})
+	provider.EXPECT().Close().Do(func() { close(closed) })
+	processor := NewMockProcessor(ctrl)
+	gomock.InOrder(
+		processor.EXPECT().Normalize(gomock.Any()).Return(common.Config{}, errors.New("invalid weights")),
+		processor.EXPECT().Normalize(gomock.Any()).Return(common.Config{}, nil),
+	)
+	processor.EXPECT().BuildGlobalStruct(gomock.Any()).Return(map[common.SizeCategory]float64{})
+	processor.EXPECT().BuildSizeClassStruct(gomock.Any()).Return(map[common.SizeCategory][]float64{})
+
+	logger := log.NewZapAdapter(zap.NewNop())
+	manager, err := NewManager(provider, processor, newEventHubImpl(logger), logger)
+	assert.NoError(t, err)
+	m, _ := manager.(*ManagerImpl)
+
+	watcher <- common.Config{}
+	watcher <- common.Config{}
+	assert.Eventually(t, func() bool {
+		return m.Stats() == ManagerStats{Reloads: 1, NormalizationFailures: 1}
+	}, time.Second, time.Millisecond)
+
+	close(watcher)
+	<-closed
+}